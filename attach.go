@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// attachURL turns an -attach argument such as "pi.local:8080" into the URL of the
+// running instance's update stream.
+func attachURL(addr string) (string, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid -attach address '%s'; use the status_listen address, e.g. 127.0.0.1:8080", addr)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/updates"
+	}
+	return u.String(), nil
+}
+
+// formatUpdate renders a streamed update as one line for the terminal.
+func formatUpdate(entry HistoryEntry) string {
+	p := entry.Payload
+	line := fmt.Sprintf("%s  %-14s %-6s", entry.Time.Local().Format(time.TimeOnly), formatFrequency(float64(p.Frequency), "mhz", 0), p.Mode)
+	if p.FrequencyRX != 0 {
+		line += fmt.Sprintf("  RX %s %s", formatFrequency(float64(p.FrequencyRX), "mhz", 0), p.ModeRX)
+	}
+	if p.Power != nil {
+		line += fmt.Sprintf("  %v W", p.Power)
+	}
+	return line + "  " + p.Radio
+}
+
+// runAttach connects to the status server of a running instance and prints each update
+// it sends to Wavelog until ctx is cancelled or the instance goes away.
+func runAttach(ctx context.Context, addr string, out io.Writer) error {
+	streamURL, err := attachURL(addr)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", streamURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to attach to %s: %w", streamURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to attach to %s: %s", streamURL, resp.Status)
+	}
+	fmt.Fprintf(out, "Attached to %s; waiting for updates (Ctrl-C to detach).\n", streamURL)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Debugf("Ignoring malformed update '%s': %v", scanner.Text(), err)
+			continue
+		}
+		fmt.Fprintln(out, formatUpdate(entry))
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("lost the connection to %s: %w", streamURL, err)
+	}
+	return fmt.Errorf("%s closed the connection", streamURL)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttachURL(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{"127.0.0.1:8080", "http://127.0.0.1:8080/updates", false},
+		{"pi.local:8080", "http://pi.local:8080/updates", false},
+		{"http://pi.local:8080/", "http://pi.local:8080/updates", false},
+		{"https://shack.example.com/waveloggoat/updates", "https://shack.example.com/waveloggoat/updates", false},
+		{"http://", "", true},
+	}
+	for _, tt := range tests {
+		got, err := attachURL(tt.addr)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("attachURL(%q) = %q, %v; want %q, error %v", tt.addr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFormatUpdate(t *testing.T) {
+	at := time.Date(2026, 1, 1, 11, 13, 54, 0, time.Local)
+	split := HistoryEntry{Time: at, Payload: WavelogJSONRequest{
+		Radio: "IC-7300", Frequency: 14076000, Mode: "USB", FrequencyRX: 14074000, ModeRX: "DATA", Power: 100.0,
+	}}
+	if got, want := formatUpdate(split), "11:13:54  14.076000 MHz  USB     RX 14.074000 MHz DATA  100 W  IC-7300"; got != want {
+		t.Errorf("formatUpdate(split) = %q, want %q", got, want)
+	}
+	simplex := HistoryEntry{Time: at, Payload: WavelogJSONRequest{Radio: "IC-705", Frequency: 7074000, Mode: "LSB"}}
+	if got, want := formatUpdate(simplex), "11:13:54  7.074000 MHz   LSB     IC-705"; got != want {
+		t.Errorf("formatUpdate(simplex) = %q, want %q", got, want)
+	}
+}
+
+// waitForSubscribers waits until n followers are subscribed to the history.
+func waitForSubscribers(t *testing.T, h *History, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.mu.Lock()
+		got := len(h.subscribers)
+		h.mu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers, want %d", got, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAttachStreamsUpdates(t *testing.T) {
+	status := NewStatus(defaultHistorySize)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/updates", status.handleUpdates)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Updates sent before attaching are not streamed
+	status.History().Add(time.Now(), WavelogJSONRequest{Key: "secret", Radio: "IC-7300", Frequency: 3573000, Mode: "USB"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() { done <- runAttach(ctx, server.URL, out) }()
+	waitForSubscribers(t, status.History(), 1)
+
+	status.History().Add(time.Now(), WavelogJSONRequest{Key: "secret", Radio: "IC-7300", Frequency: 14074000, Mode: "USB"})
+	status.History().Add(time.Now(), WavelogJSONRequest{Key: "secret", Radio: "IC-7300", Frequency: 7074000, Mode: "LSB"})
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "IC-7300") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "Attached to "+server.URL+"/updates") ||
+		!strings.Contains(lines[1], "14.074000 MHz") || !strings.Contains(lines[2], "7.074000 MHz") {
+		t.Errorf("attach output:\n%s\nwant the banner and the two updates sent after attaching", out)
+	}
+	if strings.Contains(out.String(), "secret") || strings.Contains(out.String(), "3.573000") {
+		t.Errorf("attach output includes the API key or an earlier update:\n%s", out)
+	}
+
+	// Detaching ends the stream without an error and unsubscribes
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runAttach after detaching = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runAttach did not return after detaching")
+	}
+	waitForSubscribers(t, status.History(), 0)
+}
+
+func TestAttachInstanceGoesAway(t *testing.T) {
+	status := NewStatus(defaultHistorySize)
+	server := httptest.NewServer(http.HandlerFunc(status.handleUpdates))
+	done := make(chan error, 1)
+	go func() { done <- runAttach(context.Background(), server.URL, &syncBuffer{}) }()
+	waitForSubscribers(t, status.History(), 1)
+	server.CloseClientConnections()
+	server.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("runAttach returned no error when the instance went away")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runAttach did not return when the instance went away")
+	}
+
+	if err := runAttach(context.Background(), server.URL, &syncBuffer{}); err == nil || !strings.Contains(err.Error(), "failed to attach") {
+		t.Errorf("runAttach with no instance = %v, want a failure to attach", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// AutoClient implements RadioClient for data_source "auto": it probes the configured flrig
+// and rigctld ports until one of them answers, then reads that backend for the rest of the
+// session.
+type AutoClient struct {
+	Names   []string
+	Clients []RadioClient
+
+	detected     RadioClient // the backend that answered first, nil until then
+	detectedName string
+}
+
+// newAutoClient creates the flrig and hamlib clients probed by data_source "auto".
+func newAutoClient(config ProfileConfig) (*AutoClient, error) {
+	a := &AutoClient{}
+	for _, source := range []string{"flrig", "hamlib"} {
+		sourceConfig := config
+		sourceConfig.DataSource = source
+		client, err := newRadioClient(sourceConfig)
+		if err != nil {
+			return nil, err
+		}
+		a.Names = append(a.Names, source)
+		a.Clients = append(a.Clients, client)
+	}
+	return a, nil
+}
+
+// probe sends a trivial query, reading the VFO A frequency, to check that flrig answers.
+func (f *FlrigClient) probe() error {
+	var vfo string
+	return f.call("rig.get_vfo", nil, &vfo)
+}
+
+// probe sends a trivial query, reading the frequency, to check that rigctld answers.
+func (h *HamlibClient) probe() error {
+	sess, err := h.session()
+	if err != nil {
+		return err
+	}
+	defer h.release(sess)
+	_, err = sess.query("f", 1)
+	return err
+}
+
+// detect returns the backend in use, probing each in turn until one answers.
+func (a *AutoClient) detect() (RadioClient, error) {
+	if a.detected != nil {
+		return a.detected, nil
+	}
+	var errs []error
+	for i, client := range a.Clients {
+		prober, ok := client.(interface{ probe() error })
+		if !ok {
+			continue
+		}
+		err := prober.probe()
+		if err == nil {
+			log.Infof("Detected %s on the configured port; using it for this session", a.Names[i])
+			a.detected, a.detectedName = client, a.Names[i]
+			for j, other := range a.Clients {
+				if closer, ok := other.(io.Closer); ok && j != i {
+					closer.Close()
+				}
+			}
+			return client, nil
+		}
+		log.Debugf("No %s answering: %v", a.Names[i], err)
+		errs = append(errs, fmt.Errorf("%s: %w", a.Names[i], err))
+	}
+	return nil, fmt.Errorf("no data source detected: %w", errors.Join(errs...))
+}
+
+func (a *AutoClient) GetData() (RigData, error) {
+	client, err := a.detect()
+	if err != nil {
+		return RigData{}, err
+	}
+	data, err := client.GetData()
+	data.Source = a.detectedName
+	return data, err
+}
+
+// GetRadioModel asks the detected data source for the rig model, if it can report one.
+func (a *AutoClient) GetRadioModel() (string, error) {
+	client, err := a.detect()
+	if err != nil {
+		return "", err
+	}
+	identifier, ok := client.(RadioIdentifier)
+	if !ok {
+		return "", errors.New("the detected data source cannot report the radio model")
+	}
+	return identifier.GetRadioModel()
+}
+
+// GetClock reads the clock of the detected data source, if it can read one.
+func (a *AutoClient) GetClock() (time.Time, error) {
+	client, err := a.detect()
+	if err != nil {
+		return time.Time{}, err
+	}
+	reader, ok := client.(ClockReader)
+	if !ok {
+		return time.Time{}, errors.New("the detected data source cannot read the rig clock")
+	}
+	return reader.GetClock()
+}
+
+// Close releases the connections of the probed data sources.
+func (a *AutoClient) Close() error {
+	var errs []error
+	for _, client := range a.Clients {
+		if closer, ok := client.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// closedPort returns a local port with nothing listening on it.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+// newAutoTestClient returns the client for data_source "auto" probing flrig and rigctld on
+// the given ports.
+func newAutoTestClient(t *testing.T, flrigPort, hamlibPort int) *AutoClient {
+	t.Helper()
+	radio, err := newRadioClient(ProfileConfig{
+		DataSource: "auto",
+		FlrigHost:  "127.0.0.1", FlrigPort: flrigPort,
+		HamlibHost: "127.0.0.1", HamlibPort: hamlibPort,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := radio.(*AutoClient)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestAutoDetectFlrig(t *testing.T) {
+	flrig := newFakeFlrig(t, simplexFlrig())
+	u, _ := url.Parse(flrig.URL)
+	port, _ := strconv.Atoi(u.Port())
+	client := newAutoTestClient(t, port, closedPort(t))
+
+	data, err := client.GetData()
+	if err != nil || data.Source != "flrig" || data.FreqVFOA != 14074000 {
+		t.Fatalf("GetData with flrig answering = %+v, %v; want data from flrig", data, err)
+	}
+	if model, err := client.GetRadioModel(); err != nil || model != "FT-891" {
+		t.Errorf("GetRadioModel = %q, %v; want FT-891 from flrig", model, err)
+	}
+}
+
+func TestAutoDetectHamlib(t *testing.T) {
+	// flrig is running but answers every call with a fault, as when it has no rig
+	flrig := newFakeFlrig(t, map[string]interface{}{})
+	u, _ := url.Parse(flrig.URL)
+	flrigPort, _ := strconv.Atoi(u.Port())
+	rig, hamlib := listenFakeRigctld(t, map[string]string{"f": "7074000", "m": "LSB\n2400", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA"})
+	client := newAutoTestClient(t, flrigPort, hamlib.Port)
+
+	data, err := client.GetData()
+	if err != nil || data.Source != "hamlib" || data.FreqVFOA != 7074000 {
+		t.Fatalf("GetData with rigctld answering = %+v, %v; want data from hamlib", data, err)
+	}
+
+	// The decision is kept for the session: flrig is not probed again
+	probes := flrig.count("rig.get_vfo")
+	for i := 0; i < 3; i++ {
+		if data, err := client.GetData(); err != nil || data.Source != "hamlib" {
+			t.Errorf("poll %d = %+v, %v; want data from hamlib", i, data, err)
+		}
+	}
+	if n := flrig.count("rig.get_vfo"); n != probes {
+		t.Errorf("flrig probed %d more times after detecting rigctld", n-probes)
+	}
+	if len(rig.sent()) == 0 {
+		t.Error("no commands reached rigctld")
+	}
+}
+
+func TestAutoDetectNothing(t *testing.T) {
+	client := newAutoTestClient(t, closedPort(t), closedPort(t))
+	_, err := client.GetData()
+	if err == nil {
+		t.Fatal("GetData with no backend running succeeded")
+	}
+	for _, want := range []string{"no data source detected", "flrig:", "hamlib:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
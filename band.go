@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Band describes an amateur radio band by its Wavelog/ADIF name and edges in Hz.
+type Band struct {
+	Name string
+	Low  float64
+	High float64
+}
+
+// bands lists the amateur allocations, using the widest edges across ITU regions
+// so that a frequency legal anywhere maps to its band.
+var bands = []Band{
+	{"2200m", 135700, 137800},
+	{"630m", 472000, 479000},
+	{"160m", 1800000, 2000000},
+	{"80m", 3500000, 4000000},
+	{"60m", 5060000, 5450000},
+	{"40m", 7000000, 7300000},
+	{"30m", 10100000, 10150000},
+	{"20m", 14000000, 14350000},
+	{"17m", 18068000, 18168000},
+	{"15m", 21000000, 21450000},
+	{"12m", 24890000, 24990000},
+	{"10m", 28000000, 29700000},
+	{"6m", 50000000, 54000000},
+	{"4m", 70000000, 71000000},
+	{"2m", 144000000, 148000000},
+	{"1.25m", 222000000, 225000000},
+	{"70cm", 420000000, 450000000},
+	{"33cm", 902000000, 928000000},
+	{"23cm", 1240000000, 1300000000},
+	{"13cm", 2300000000, 2450000000},
+	{"9cm", 3300000000, 3500000000},
+	{"6cm", 5650000000, 5925000000},
+	{"3cm", 10000000000, 10500000000},
+	{"1.25cm", 24000000000, 24250000000},
+}
+
+// bandForFrequency returns the band name for a frequency in Hz, or "" when the
+// frequency is outside all amateur bands.
+func bandForFrequency(freq float64) string {
+	for _, b := range bands {
+		if freq >= b.Low && freq <= b.High {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// isBandChange reports whether moving from the frequency last sent, last, to freq (both
+// in Hz) is a band change rather than tuning: it crosses a band boundary, or moves more
+// than thresholdHz when that is set. The first update, with last 0, is a band change.
+func isBandChange(freq, last, thresholdHz float64) bool {
+	if last == 0 || bandForFrequency(freq) != bandForFrequency(last) {
+		return true
+	}
+	return thresholdHz > 0 && math.Abs(freq-last) > thresholdHz
+}
+
+// isVHFOrAbove reports whether a frequency in Hz is at or above the start of VHF (30 MHz).
+func isVHFOrAbove(freq float64) bool {
+	return freq >= 30000000
+}
+
+// isCrossBandSplit reports whether the rig is in split with VFO A and VFO B on
+// different VHF/UHF bands, as is typical for satellite uplink/downlink operation.
+func isCrossBandSplit(data RigData) bool {
+	if data.Split == 0 {
+		return false
+	}
+	if !isVHFOrAbove(data.FreqVFOA) || !isVHFOrAbove(data.FreqVFOB) {
+		return false
+	}
+	bandA := bandForFrequency(data.FreqVFOA)
+	bandB := bandForFrequency(data.FreqVFOB)
+	return bandA != "" && bandB != "" && bandA != bandB
+}
+
+// conventionalSideband returns the sideband customarily used for SSB at freq: LSB
+// below 10 MHz and USB above, except on 60m where channelized USB is the rule.
+func conventionalSideband(freq float64) string {
+	if bandForFrequency(freq) == "60m" {
+		return "USB"
+	}
+	if freq < 10000000 {
+		return "LSB"
+	}
+	return "USB"
+}
+
+// refineSSB replaces a bare "SSB" mode with USB or LSB. sideband is the profile's
+// ssb_sideband setting: "" or "auto" to follow the band convention, "usb" or "lsb" to
+// force one, or "off" to leave the mode alone.
+func refineSSB(mode string, freq float64, sideband string) string {
+	if !strings.EqualFold(mode, "SSB") {
+		return mode
+	}
+	switch strings.ToLower(sideband) {
+	case "off":
+		return mode
+	case "usb":
+		return "USB"
+	case "lsb":
+		return "LSB"
+	}
+	return conventionalSideband(freq)
+}
+
+// freqRange is an inclusive frequency range in Hz from freq_ranges.
+type freqRange struct {
+	Low, High float64
+}
+
+// parseFreqRanges parses ranges written as "low-high" in Hz, e.g. "14000000-14350000".
+func parseFreqRanges(specs []string) ([]freqRange, error) {
+	var ranges []freqRange
+	for _, spec := range specs {
+		lowStr, highStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid frequency range '%s'. Must be low-high in Hz", spec)
+		}
+		low, err := strconv.ParseFloat(strings.TrimSpace(lowStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frequency range '%s': %w", spec, err)
+		}
+		high, err := strconv.ParseFloat(strings.TrimSpace(highStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frequency range '%s': %w", spec, err)
+		}
+		if low > high {
+			return nil, fmt.Errorf("invalid frequency range '%s'. The low edge is above the high edge", spec)
+		}
+		ranges = append(ranges, freqRange{Low: low, High: high})
+	}
+	return ranges, nil
+}
+
+// frequencyAllowed reports whether freq is on one of the allowed bands or within one of
+// the allowed ranges. With neither configured every frequency is allowed.
+func frequencyAllowed(freq float64, allowedBands []string, ranges []freqRange) bool {
+	if len(allowedBands) == 0 && len(ranges) == 0 {
+		return true
+	}
+	if band := bandForFrequency(freq); band != "" {
+		for _, allowed := range allowedBands {
+			if strings.EqualFold(strings.TrimSpace(allowed), band) {
+				return true
+			}
+		}
+	}
+	for _, r := range ranges {
+		if freq >= r.Low && freq <= r.High {
+			return true
+		}
+	}
+	return false
+}
+
+// frequencyUnits are the log_frequency_unit values with their size in Hz and the
+// decimals that show the frequency to the Hz.
+var frequencyUnits = map[string]struct {
+	Name     string
+	Hz       float64
+	Decimals int
+}{
+	"hz":  {"Hz", 1, 0},
+	"khz": {"kHz", 1e3, 3},
+	"mhz": {"MHz", 1e6, 6},
+}
+
+// formatFrequency renders a frequency in Hz for log messages in unit ("hz", "khz" or
+// "mhz", default Hz) with the given number of decimals, or as many as show whole Hz
+// when decimals is 0, e.g. "14.074000 MHz".
+func formatFrequency(freq float64, unit string, decimals int) string {
+	u, ok := frequencyUnits[strings.ToLower(strings.TrimSpace(unit))]
+	if !ok {
+		u = frequencyUnits["hz"]
+	}
+	if decimals <= 0 {
+		decimals = u.Decimals
+	}
+	return fmt.Sprintf("%.*f %s", decimals, freq/u.Hz, u.Name)
+}
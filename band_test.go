@@ -0,0 +1,257 @@
+package main
+
+import "testing"
+
+func TestIsCrossBandSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		data RigData
+		want bool
+	}{
+		{"2m up 70cm down", RigData{FreqVFOA: 435800000, FreqVFOB: 145850000, Split: 1}, true},
+		{"70cm up 2m down", RigData{FreqVFOA: 145960000, FreqVFOB: 436795000, Split: 1}, true},
+		{"split off", RigData{FreqVFOA: 435800000, FreqVFOB: 145850000}, false},
+		{"same band split", RigData{FreqVFOA: 145800000, FreqVFOB: 145200000, Split: 1}, false},
+		{"HF cross-band", RigData{FreqVFOA: 14074000, FreqVFOB: 21074000, Split: 1}, false},
+		{"HF and VHF", RigData{FreqVFOA: 28400000, FreqVFOB: 145900000, Split: 1}, false},
+		{"outside the bands", RigData{FreqVFOA: 162550000, FreqVFOB: 145850000, Split: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCrossBandSplit(tt.data); got != tt.want {
+				t.Errorf("isCrossBandSplit(%+v) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPayloadSatellite(t *testing.T) {
+	data := RigData{FreqVFOA: 435800000, FreqVFOB: 145850000, Mode: "FM", ModeB: "FM", Split: 1}
+	config := ProfileConfig{RadioName: "IC-9700", Satellite: true, SatName: "SO-50"}
+
+	payload := buildPayload(config, data)
+	if payload.PropMode != "SAT" || payload.SatName != "SO-50" {
+		t.Errorf("cross-band split sent prop_mode %q, sat_name %q; want SAT, SO-50", payload.PropMode, payload.SatName)
+	}
+	if payload.Frequency != 145850000 || payload.FrequencyRX != 435800000 {
+		t.Errorf("frequency = %d, frequency_rx = %d; want uplink 145850000, downlink 435800000", payload.Frequency, payload.FrequencyRX)
+	}
+
+	data.Split = 0
+	if payload := buildPayload(config, data); payload.PropMode != "" || payload.SatName != "" {
+		t.Errorf("simplex sent prop_mode %q, sat_name %q; want neither", payload.PropMode, payload.SatName)
+	}
+
+	config.Satellite = false
+	data.Split = 1
+	if payload := buildPayload(config, data); payload.PropMode != "" {
+		t.Errorf("non-satellite profile sent prop_mode %q", payload.PropMode)
+	}
+}
+
+func TestBandForFrequency(t *testing.T) {
+	edges := []struct {
+		band      string
+		low, high float64
+	}{
+		{"2200m", 135700, 137800},
+		{"630m", 472000, 479000},
+		{"160m", 1800000, 2000000},
+		{"80m", 3500000, 4000000},
+		{"60m", 5060000, 5450000},
+		{"40m", 7000000, 7300000},
+		{"30m", 10100000, 10150000},
+		{"20m", 14000000, 14350000},
+		{"17m", 18068000, 18168000},
+		{"15m", 21000000, 21450000},
+		{"12m", 24890000, 24990000},
+		{"10m", 28000000, 29700000},
+		{"6m", 50000000, 54000000},
+		{"4m", 70000000, 71000000},
+		{"2m", 144000000, 148000000},
+		{"1.25m", 222000000, 225000000},
+		{"70cm", 420000000, 450000000},
+		{"33cm", 902000000, 928000000},
+		{"23cm", 1240000000, 1300000000},
+		{"13cm", 2300000000, 2450000000},
+		{"9cm", 3300000000, 3500000000},
+		{"6cm", 5650000000, 5925000000},
+		{"3cm", 10000000000, 10500000000},
+		{"1.25cm", 24000000000, 24250000000},
+	}
+	for _, e := range edges {
+		t.Run(e.band, func(t *testing.T) {
+			for _, tt := range []struct {
+				freq float64
+				want string
+			}{
+				{e.low, e.band},
+				{e.high, e.band},
+				{(e.low + e.high) / 2, e.band},
+				{e.low - 1, ""},
+				{e.high + 1, ""},
+			} {
+				if got := bandForFrequency(tt.freq); got != tt.want {
+					t.Errorf("bandForFrequency(%.0f) = %q, want %q", tt.freq, got, tt.want)
+				}
+			}
+		})
+	}
+	for _, freq := range []float64{0, 100000, 162550000, 30e9} {
+		if got := bandForFrequency(freq); got != "" {
+			t.Errorf("bandForFrequency(%.0f) = %q, want none", freq, got)
+		}
+	}
+}
+
+func TestRefineSSB(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		freq     float64
+		sideband string
+		want     string
+	}{
+		{"160m", "SSB", 1843000, "auto", "LSB"},
+		{"80m", "SSB", 3790000, "auto", "LSB"},
+		{"60m is USB", "SSB", 5357000, "auto", "USB"},
+		{"just below 60m", "SSB", 5059999, "auto", "LSB"},
+		{"40m", "SSB", 7150000, "", "LSB"},
+		{"just below 10 MHz", "SSB", 9999999, "auto", "LSB"},
+		{"at 10 MHz", "SSB", 10000000, "auto", "USB"},
+		{"20m", "SSB", 14250000, "auto", "USB"},
+		{"2m", "SSB", 144300000, "auto", "USB"},
+		{"lower case", "ssb", 7150000, "auto", "LSB"},
+		{"forced USB", "SSB", 7150000, "usb", "USB"},
+		{"forced LSB", "SSB", 14250000, "LSB", "LSB"},
+		{"off", "SSB", 7150000, "off", "SSB"},
+		{"explicit sideband kept", "USB", 7150000, "auto", "USB"},
+		{"other modes kept", "CW", 7030000, "lsb", "CW"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refineSSB(tt.mode, tt.freq, tt.sideband); got != tt.want {
+				t.Errorf("refineSSB(%q, %.0f, %q) = %q, want %q", tt.mode, tt.freq, tt.sideband, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFreqRanges(t *testing.T) {
+	ranges, err := parseFreqRanges([]string{"14074000-14077000", " 7000000 - 7040000 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []freqRange{{14074000, 14077000}, {7000000, 7040000}}
+	if len(ranges) != len(want) || ranges[0] != want[0] || ranges[1] != want[1] {
+		t.Errorf("parseFreqRanges = %+v, want %+v", ranges, want)
+	}
+	for _, spec := range []string{"14074000", "14077000-14074000", "a-b", "14074000-"} {
+		if _, err := parseFreqRanges([]string{spec}); err == nil {
+			t.Errorf("parseFreqRanges(%q) accepted", spec)
+		}
+	}
+}
+
+func TestFrequencyAllowed(t *testing.T) {
+	bands := []string{"20m", " 40M "}
+	ranges := []freqRange{{Low: 144174000, High: 144176000}}
+	tests := []struct {
+		name   string
+		freq   float64
+		bands  []string
+		ranges []freqRange
+		want   bool
+	}{
+		{"nothing configured", 162550000, nil, nil, true},
+		{"allowed band", 14074000, bands, nil, true},
+		{"allowed band, any case", 7074000, bands, nil, true},
+		{"band edge", 14350000, bands, nil, true},
+		{"other band", 3573000, bands, nil, false},
+		{"outside every band", 162550000, bands, nil, false},
+		{"in a range", 144174000, nil, ranges, true},
+		{"range edge", 144176000, nil, ranges, true},
+		{"same band, outside the range", 144300000, nil, ranges, false},
+		{"band or range", 144175000, bands, ranges, true},
+		{"neither", 28074000, bands, ranges, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := frequencyAllowed(tt.freq, tt.bands, tt.ranges); got != tt.want {
+				t.Errorf("frequencyAllowed(%v) = %v, want %v", tt.freq, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatFrequency(t *testing.T) {
+	tests := []struct {
+		freq     float64
+		unit     string
+		decimals int
+		want     string
+	}{
+		{14074000, "", 0, "14074000 Hz"},
+		{14074000, "hz", 0, "14074000 Hz"},
+		{14074000.4, "Hz", 0, "14074000 Hz"},
+		{14074000, "khz", 0, "14074.000 kHz"},
+		{14074260, " kHz ", 1, "14074.3 kHz"},
+		{14074000, "mhz", 0, "14.074000 MHz"},
+		{14074000, "MHz", 3, "14.074 MHz"},
+		{144300000, "mhz", 2, "144.30 MHz"},
+		{14074000, "ghz", 0, "14074000 Hz"},
+	}
+	for _, tt := range tests {
+		if got := formatFrequency(tt.freq, tt.unit, tt.decimals); got != tt.want {
+			t.Errorf("formatFrequency(%g, %q, %d) = %q, want %q", tt.freq, tt.unit, tt.decimals, got, tt.want)
+		}
+	}
+
+	valid := ProfileConfig{WavelogKey: "key", WavelogURL: "http://localhost/index.php", Interval: "1s"}
+	for _, unit := range []string{"", "hz", "kHz", " MHZ "} {
+		config := valid
+		config.LogFrequencyUnit = unit
+		if err := validateProfile(config, ""); err != nil {
+			t.Errorf("log_frequency_unit %q rejected: %v", unit, err)
+		}
+	}
+	config := valid
+	config.LogFrequencyUnit = "ghz"
+	if err := validateProfile(config, ""); err == nil {
+		t.Error("log_frequency_unit \"ghz\" accepted")
+	}
+}
+
+func TestIsBandChange(t *testing.T) {
+	tests := []struct {
+		name        string
+		freq, last  float64
+		thresholdHz float64
+		want        bool
+	}{
+		{"first update", 14074000, 0, 0, true},
+		{"tuning within 20m", 14075000, 14074000, 0, false},
+		{"20m to 15m", 21074000, 14074000, 0, true},
+		{"across the top edge of 20m", 14350001, 14350000, 0, true},
+		{"at the bottom edge of 20m", 14000000, 14000500, 0, false},
+		{"below the bottom edge of 40m", 6999999, 7000000, 0, true},
+		{"outside every band", 162560000, 162550000, 0, false},
+		{"80m sweep without a threshold", 3800000, 3500000, 0, false},
+		{"80m sweep above the threshold", 3800000, 3500000, 100000, true},
+		{"move at the threshold", 3600000, 3500000, 100000, false},
+		{"move down above the threshold", 3500000, 3700000, 100000, true},
+		{"crossing below the threshold", 14000000, 13999000, 100000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBandChange(tt.freq, tt.last, tt.thresholdHz); got != tt.want {
+				t.Errorf("isBandChange(%g, %g, %g) = %v, want %v", tt.freq, tt.last, tt.thresholdHz, got, tt.want)
+			}
+		})
+	}
+
+	config := ProfileConfig{WavelogKey: "key", WavelogURL: "http://localhost/index.php", Interval: "1s", BandChangeHz: -1}
+	if err := validateProfile(config, ""); err == nil {
+		t.Error("negative band_change_hz accepted")
+	}
+}
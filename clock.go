@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clockCheckInterval is how often the rig clock is compared with the system clock.
+const clockCheckInterval = 10 * time.Minute
+
+// defaultClockSkew is the skew warned about when clock_skew is not set. FT8 decodes
+// become unreliable beyond about two seconds.
+const defaultClockSkew = 2 * time.Second
+
+// implemented by radio sources that can read the connected rig's clock
+type ClockReader interface {
+	GetClock() (time.Time, error)
+}
+
+// hamlibClockLayouts are the forms of \get_clock replies seen from hamlib releases. A
+// fractional second after the seconds is accepted by time.Parse with any of them.
+var hamlibClockLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05-07",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05-0700",
+	"2006-01-02 15:04:05-07",
+}
+
+// parseHamlibClock parses a \get_clock reply. A time without a UTC offset is taken as UTC.
+func parseHamlibClock(resp string) (time.Time, error) {
+	resp = strings.TrimSpace(resp)
+	for _, layout := range hamlibClockLayouts {
+		if t, err := time.Parse(layout, resp); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, resp, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &ParseError{What: "rig clock", Value: resp}
+}
+
+// clockSkew returns how far the rig clock is ahead of the system clock (negative when it
+// is behind), measuring against the middle of the time the read took.
+func clockSkew(rig, before, after time.Time) time.Duration {
+	return rig.Sub(before.Add(after.Sub(before) / 2))
+}
+
+func (h *HamlibClient) GetClock() (time.Time, error) {
+	sess, err := h.session()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer h.release(sess)
+
+	// The time itself contains colons, so only a leading label such as "Clock: " is removed
+	resp, err := sess.queryLines("\\get_clock", 1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(resp) == 0 {
+		return time.Time{}, fmt.Errorf("empty clock response from hamlib")
+	}
+	value := resp[0]
+	if label, rest, ok := strings.Cut(value, ": "); ok && !strings.ContainsAny(label, "0123456789") {
+		value = rest
+	}
+	return parseHamlibClock(value)
+}
+
+// GetClock reads the rig clock through the private rigctld.
+func (s *SerialClient) GetClock() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.start(); err != nil {
+		return time.Time{}, err
+	}
+	return s.hamlib.GetClock()
+}
+
+// GetClock reads the clock of the active data source, if it can read one.
+func (f *FailoverClient) GetClock() (time.Time, error) {
+	reader, ok := f.Clients[f.active].(ClockReader)
+	if !ok {
+		return time.Time{}, fmt.Errorf("data source %s cannot read the rig clock", f.Active())
+	}
+	return reader.GetClock()
+}
+
+// checkClock compares the rig clock with the system clock and warns when they are more
+// than threshold apart.
+func checkClock(reader ClockReader, threshold time.Duration) {
+	before := time.Now()
+	rig, err := reader.GetClock()
+	after := time.Now()
+	if err != nil {
+		log.Debugf("Failed to read the rig clock: %v", err)
+		return
+	}
+	skew := clockSkew(rig, before, after)
+	if skew.Abs() > threshold {
+		log.Warnf("Rig clock is %s off the system clock (rig %s). Digital modes such as FT8 need them within a second or two.", skew.Round(10*time.Millisecond), rig.Format(time.RFC3339))
+		return
+	}
+	log.Debugf("Rig clock is within %s of the system clock", skew.Abs().Round(10*time.Millisecond))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseHamlibClock(t *testing.T) {
+	want := time.Date(2026, 3, 1, 12, 30, 15, 0, time.UTC)
+	tests := []struct {
+		resp string
+		want time.Time
+	}{
+		{"2026-03-01T12:30:15Z", want},
+		{"2026-03-01T12:30:15+00:00", want},
+		{"2026-03-01T13:30:15+0100", want},
+		{"2026-03-01T07:30:15-05", want},
+		{"2026-03-01 12:30:15Z", want},
+		{"2026-03-01T12:30:15.250+00", want.Add(250 * time.Millisecond)},
+		{"2026-03-01T12:30:15", want},
+		{"2026-03-01 12:30:15\n", want},
+	}
+	for _, tt := range tests {
+		got, err := parseHamlibClock(tt.resp)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseHamlibClock(%q) = %s, %v; want %s", tt.resp, got, err, tt.want)
+		}
+	}
+	var parseErr *ParseError
+	if _, err := parseHamlibClock("12:30:15"); !errors.As(err, &parseErr) {
+		t.Errorf("parseHamlibClock without a date = %v, want a ParseError", err)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	before := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		rig      time.Time
+		readTook time.Duration
+		want     time.Duration
+	}{
+		{"in sync", before, 0, 0},
+		{"ahead", before.Add(3 * time.Second), 0, 3 * time.Second},
+		{"behind", before.Add(-1500 * time.Millisecond), 0, -1500 * time.Millisecond},
+		{"slow read measured from its middle", before.Add(time.Second), 2 * time.Second, 0},
+		{"ahead with a slow read", before.Add(3 * time.Second), 200 * time.Millisecond, 2900 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := clockSkew(tt.rig, before, before.Add(tt.readTook)); got != tt.want {
+			t.Errorf("%s: clockSkew = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHamlibGetClock(t *testing.T) {
+	for name, resp := range map[string]string{
+		"plain":    "2026-03-01T12:30:15+00:00",
+		"labelled": "Clock: 2026-03-01T12:30:15+00:00",
+	} {
+		_, client := newFakeRigctld(t, map[string]string{`\get_clock`: resp}, false)
+		got, err := client.GetClock()
+		if want := time.Date(2026, 3, 1, 12, 30, 15, 0, time.UTC); err != nil || !got.Equal(want) {
+			t.Errorf("%s: GetClock = %s, %v; want %s", name, got, err, want)
+		}
+	}
+	_, client := newFakeRigctld(t, map[string]string{}, false)
+	if _, err := client.GetClock(); err == nil {
+		t.Error("GetClock on a rig without a clock succeeded")
+	}
+}
+
+// offsetClock is a rig clock offset from the system clock.
+type offsetClock struct {
+	offset time.Duration
+	err    error
+}
+
+func (c offsetClock) GetClock() (time.Time, error) {
+	return time.Now().Add(c.offset), c.err
+}
+
+func TestCheckClock(t *testing.T) {
+	tests := []struct {
+		name  string
+		clock offsetClock
+		warn  bool
+	}{
+		{"in sync", offsetClock{}, false},
+		{"within the threshold", offsetClock{offset: time.Second}, false},
+		{"ahead", offsetClock{offset: 5 * time.Second}, true},
+		{"behind", offsetClock{offset: -5 * time.Second}, true},
+		{"unreadable", offsetClock{offset: time.Hour, err: errors.New("RPRT -11")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged := captureLog(t, logrus.WarnLevel)
+			checkClock(tt.clock, defaultClockSkew)
+			if warned := strings.Contains(logged.String(), "Rig clock is"); warned != tt.warn {
+				t.Errorf("warned %v, want %v (log %q)", warned, tt.warn, logged.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Failover tuning: how many consecutive failures make a source count as down, and how
+// often the preferred source is retried while a fallback is in use.
+const (
+	failoverThreshold     = 3
+	failoverProbeInterval = 30 * time.Second
+)
+
+// FailoverClient implements RadioClient over an ordered list of data sources. It reads
+// from the first source that works, moves on after persistent failures, and switches back
+// to the preferred (first) source once it recovers.
+type FailoverClient struct {
+	Names   []string
+	Clients []RadioClient
+
+	active    int       // index of the source currently read
+	failures  int       // consecutive failures of the active source
+	nextProbe time.Time // when to next retry the preferred source while failed over
+}
+
+// newFailoverClient creates the clients for each named data source, using config for
+// their connection settings.
+func newFailoverClient(config ProfileConfig, sources []string) (*FailoverClient, error) {
+	f := &FailoverClient{}
+	for _, source := range sources {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source == "" {
+			continue
+		}
+		sourceConfig := config
+		sourceConfig.DataSource = source
+		sourceConfig.DataSources = nil
+		client, err := newRadioClient(sourceConfig)
+		if err != nil {
+			return nil, err
+		}
+		f.Names = append(f.Names, source)
+		f.Clients = append(f.Clients, client)
+	}
+	if len(f.Clients) == 0 {
+		return nil, errors.New("no data sources configured")
+	}
+	return f, nil
+}
+
+// Active returns the name of the data source currently in use.
+func (f *FailoverClient) Active() string {
+	return f.Names[f.active]
+}
+
+func (f *FailoverClient) GetData() (RigData, error) {
+	if f.active != 0 && !time.Now().Before(f.nextProbe) {
+		f.nextProbe = time.Now().Add(failoverProbeInterval)
+		data, err := f.Clients[0].GetData()
+		if err == nil {
+			log.Infof("Data source %s recovered; switching back from %s", f.Names[0], f.Active())
+			f.active = 0
+			f.failures = 0
+			data.Source = f.Active()
+			return data, nil
+		}
+		log.Debugf("Preferred data source %s still failing: %v", f.Names[0], err)
+	}
+
+	data, err := f.Clients[f.active].GetData()
+	if err == nil {
+		f.failures = 0
+		data.Source = f.Active()
+		return data, nil
+	}
+	f.failures++
+	if f.failures < failoverThreshold || len(f.Clients) == 1 {
+		return RigData{}, fmt.Errorf("%s: %w", f.Active(), err)
+	}
+
+	failed := f.Active()
+	f.active = (f.active + 1) % len(f.Clients)
+	f.failures = 0
+	f.nextProbe = time.Now().Add(failoverProbeInterval)
+	log.Warnf("Data source %s failed %d times in a row (%v); failing over to %s", failed, failoverThreshold, err, f.Active())
+	if data, err = f.Clients[f.active].GetData(); err != nil {
+		f.failures++
+		return RigData{}, fmt.Errorf("%s: %w", f.Active(), err)
+	}
+	data.Source = f.Active()
+	return data, nil
+}
+
+// GetRadioModel asks the active data source for the rig model, if it can report one.
+func (f *FailoverClient) GetRadioModel() (string, error) {
+	identifier, ok := f.Clients[f.active].(RadioIdentifier)
+	if !ok {
+		return "", fmt.Errorf("data source %s cannot report the radio model", f.Active())
+	}
+	return identifier.GetRadioModel()
+}
+
+// Close releases the connections of all data sources.
+func (f *FailoverClient) Close() error {
+	var errs []error
+	for _, client := range f.Clients {
+		if closer, ok := client.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubClient is a RadioClient returning fixed data, or err when set.
+type stubClient struct {
+	data  RigData
+	err   error
+	calls int
+}
+
+func (s *stubClient) GetData() (RigData, error) {
+	s.calls++
+	if s.err != nil {
+		return RigData{}, s.err
+	}
+	return s.data, nil
+}
+
+func TestFailoverClient(t *testing.T) {
+	primary := &stubClient{data: RigData{FreqVFOA: 14074000}}
+	secondary := &stubClient{data: RigData{FreqVFOA: 7074000}}
+	f := &FailoverClient{Names: []string{"flrig", "hamlib"}, Clients: []RadioClient{primary, secondary}}
+
+	if data, err := f.GetData(); err != nil || data.Source != "flrig" {
+		t.Fatalf("GetData = %+v, %v; want data from flrig", data, err)
+	}
+
+	// The primary goes down: errors until the threshold, then the secondary takes over
+	primary.err = errors.New("connection refused")
+	for i := 1; i < failoverThreshold; i++ {
+		if _, err := f.GetData(); err == nil {
+			t.Fatalf("failure %d was not reported", i)
+		}
+	}
+	data, err := f.GetData()
+	if err != nil || data.Source != "hamlib" || data.FreqVFOA != 7074000 {
+		t.Fatalf("after %d failures GetData = %+v, %v; want data from hamlib", failoverThreshold, data, err)
+	}
+
+	// The primary is only probed once the probe interval has passed
+	primary.err = nil
+	calls := primary.calls
+	if data, _ := f.GetData(); data.Source != "hamlib" || primary.calls != calls {
+		t.Errorf("the primary was probed before the probe interval (source %s)", data.Source)
+	}
+	f.nextProbe = time.Now().Add(-time.Second)
+	if data, err := f.GetData(); err != nil || data.Source != "flrig" || f.Active() != "flrig" {
+		t.Errorf("after recovery GetData = %+v, %v; want data from flrig", data, err)
+	}
+}
+
+func TestFailoverClientPrimaryStillDown(t *testing.T) {
+	primary := &stubClient{err: errors.New("connection refused")}
+	secondary := &stubClient{data: RigData{FreqVFOA: 7074000}}
+	f := &FailoverClient{Names: []string{"flrig", "hamlib"}, Clients: []RadioClient{primary, secondary}, active: 1}
+
+	// A failed probe keeps reading the secondary without an error
+	if data, err := f.GetData(); err != nil || data.Source != "hamlib" {
+		t.Errorf("GetData with the primary still down = %+v, %v; want data from hamlib", data, err)
+	}
+	if primary.calls != 1 || !f.nextProbe.After(time.Now()) {
+		t.Errorf("primary probed %d times, next probe %s; want one probe and the next one scheduled", primary.calls, f.nextProbe)
+	}
+}
@@ -3,8 +3,15 @@ module waveloggoat
 go 1.25
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.5.1
 	github.com/kolo/xmlrpc v0.0.0-20220921171641-a4b6fa1dd06b
 	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/sys v0.36.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
 
-require golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+require (
+	github.com/gorilla/websocket v1.5.3 // indirect
+	golang.org/x/net v0.44.0 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+)
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GpsdClient reads the current position from gpsd and converts it to a Maidenhead grid square.
+type GpsdClient struct {
+	Host string
+	Port int // 0 uses defaultGpsdPort
+
+	mu          sync.Mutex
+	lastGrid    string
+	lastErr     error
+	lastAttempt time.Time
+	refreshing  bool
+}
+
+// gpsdRefreshInterval limits how often gpsd is queried; position changes slowly compared to the radio.
+const gpsdRefreshInterval = time.Minute
+
+// defaultGpsdPort is the standard gpsd port, used when a profile does not set gpsd_port.
+const defaultGpsdPort = 2947
+
+// gpsdTPV holds the fields used from a gpsd JSON TPV (time-position-velocity) report.
+type gpsdTPV struct {
+	Class string  `json:"class"`
+	Mode  int     `json:"mode"` // 0/1: no fix, 2: 2D fix, 3: 3D fix
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+}
+
+// GridSquare returns the last known grid square without waiting for gpsd. When the
+// cached position is older than the refresh interval, a query is started in the
+// background; failed queries are retried no more often than successful ones. The error
+// from a failed query is returned once, on the next call after it completes.
+func (g *GpsdClient) GridSquare() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.refreshing && (g.lastAttempt.IsZero() || time.Since(g.lastAttempt) >= gpsdRefreshInterval) {
+		g.refreshing = true
+		g.lastAttempt = time.Now()
+		go g.refresh()
+	}
+	err := g.lastErr
+	g.lastErr = nil
+	return g.lastGrid, err
+}
+
+// Address returns the gpsd host:port, applying the default port when none is set.
+func (g *GpsdClient) Address() string {
+	port := g.Port
+	if port == 0 {
+		port = defaultGpsdPort
+	}
+	return net.JoinHostPort(g.Host, strconv.Itoa(port))
+}
+
+// refresh queries gpsd and stores the result for GridSquare.
+func (g *GpsdClient) refresh() {
+	lat, lon, err := g.readPosition()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refreshing = false
+	if err != nil {
+		g.lastErr = err
+		return
+	}
+	g.lastGrid = maidenhead(lat, lon)
+	log.Debugf("gpsd position %.5f, %.5f is grid %s", lat, lon, g.lastGrid)
+}
+
+// readPosition connects to gpsd, enables watching and waits for the first report with a fix.
+func (g *GpsdClient) readPosition() (float64, float64, error) {
+	conn, err := net.DialTimeout("tcp", g.Address(), 5*time.Second)
+	if err != nil {
+		return 0, 0, fmt.Errorf("gpsd connection error: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Fprint(conn, `?WATCH={"enable":true,"json":true,"nmea":true};`); err != nil {
+		return 0, 0, fmt.Errorf("failed to send WATCH command to gpsd: %w", err)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if lat, lon, ok := parseGpsdLine(scanner.Text()); ok {
+			return lat, lon, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read position from gpsd: %w", err)
+	}
+	return 0, 0, fmt.Errorf("gpsd closed the connection without a position fix")
+}
+
+// parseGpsdLine extracts a position from a gpsd JSON TPV report or an NMEA GGA/RMC
+// sentence. ok is false for other reports and for reports without a fix.
+func parseGpsdLine(line string) (lat, lon float64, ok bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		var tpv gpsdTPV
+		if err := json.Unmarshal([]byte(line), &tpv); err != nil || tpv.Class != "TPV" || tpv.Mode < 2 {
+			return 0, 0, false
+		}
+		return tpv.Lat, tpv.Lon, true
+	}
+	if strings.HasPrefix(line, "$") {
+		return parseNMEA(line)
+	}
+	return 0, 0, false
+}
+
+// parseNMEA extracts a position from a GGA or RMC sentence from any talker (GP, GN, ...).
+func parseNMEA(sentence string) (lat, lon float64, ok bool) {
+	if i := strings.Index(sentence, "*"); i >= 0 {
+		sentence = sentence[:i]
+	}
+	fields := strings.Split(sentence, ",")
+	if len(fields[0]) < 6 {
+		return 0, 0, false
+	}
+	var latField, latHemi, lonField, lonHemi string
+	switch fields[0][3:] {
+	case "GGA":
+		// $xxGGA,time,lat,N,lon,E,quality,...
+		if len(fields) < 7 || fields[6] == "" || fields[6] == "0" {
+			return 0, 0, false
+		}
+		latField, latHemi, lonField, lonHemi = fields[2], fields[3], fields[4], fields[5]
+	case "RMC":
+		// $xxRMC,time,status,lat,N,lon,E,...
+		if len(fields) < 7 || fields[2] != "A" {
+			return 0, 0, false
+		}
+		latField, latHemi, lonField, lonHemi = fields[3], fields[4], fields[5], fields[6]
+	default:
+		return 0, 0, false
+	}
+
+	lat, err := parseNMEACoord(latField, 2)
+	if err != nil {
+		return 0, 0, false
+	}
+	lon, err = parseNMEACoord(lonField, 3)
+	if err != nil {
+		return 0, 0, false
+	}
+	if latHemi == "S" {
+		lat = -lat
+	}
+	if lonHemi == "W" {
+		lon = -lon
+	}
+	return lat, lon, true
+}
+
+// parseNMEACoord converts an NMEA (d)ddmm.mmmm coordinate to decimal degrees.
+func parseNMEACoord(value string, degDigits int) (float64, error) {
+	if len(value) < degDigits+2 {
+		return 0, fmt.Errorf("short NMEA coordinate '%s'", value)
+	}
+	deg, err := strconv.ParseFloat(value[:degDigits], 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(value[degDigits:], 64)
+	if err != nil {
+		return 0, err
+	}
+	return deg + minutes/60, nil
+}
+
+// maidenhead converts a position in decimal degrees to a 6 character Maidenhead locator.
+func maidenhead(lat, lon float64) string {
+	lon += 180
+	lat += 90
+	// Keep the north pole and antimeridian inside the last field
+	lon = min(max(lon, 0), 359.999999)
+	lat = min(max(lat, 0), 179.999999)
+
+	grid := []byte{
+		byte('A' + int(lon/20)),
+		byte('A' + int(lat/10)),
+		byte('0' + int(lon/2)%10),
+		byte('0' + int(lat)%10),
+		byte('a' + int((lon-2*float64(int(lon/2)))*12)),
+		byte('a' + int((lat-float64(int(lat)))*24)),
+	}
+	return string(grid)
+}
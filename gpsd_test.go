@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseGpsdLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		lat, lon float64
+		ok       bool
+	}{
+		{"TPV 3D fix", `{"class":"TPV","mode":3,"lat":41.714775,"lon":-72.727260}`, 41.714775, -72.727260, true},
+		{"TPV 2D fix", `{"class":"TPV","mode":2,"lat":-33.8688,"lon":151.2093}`, -33.8688, 151.2093, true},
+		{"TPV no fix", `{"class":"TPV","mode":1,"lat":0,"lon":0}`, 0, 0, false},
+		{"SKY report", `{"class":"SKY","satellites":[]}`, 0, 0, false},
+		{"VERSION report", `{"class":"VERSION","release":"3.25"}`, 0, 0, false},
+		{"malformed JSON", `{"class":"TPV","mode":3,`, 0, 0, false},
+		{"GGA", "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", 48.1173, 11.516667, true},
+		{"GNGGA southern western", "$GNGGA,123519,3351.000,S,07037.800,W,1,08,0.9,545.4,M,46.9,M,,*47", -33.85, -70.63, true},
+		{"GGA no fix", "$GPGGA,123519,4807.038,N,01131.000,E,0,00,,,M,,M,,*47", 0, 0, false},
+		{"RMC active", "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A", 48.1173, 11.516667, true},
+		{"RMC void", "$GPRMC,123519,V,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A", 0, 0, false},
+		{"other sentence", "$GPGSV,3,1,11,03,03,111,00,04,15,270,00,06,01,010,00,13,06,292,00*74", 0, 0, false},
+		{"short coordinate", "$GPGGA,123519,48,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", 0, 0, false},
+		{"empty line", "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon, ok := parseGpsdLine(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("parseGpsdLine(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			}
+			if math.Abs(lat-tt.lat) > 1e-4 || math.Abs(lon-tt.lon) > 1e-4 {
+				t.Errorf("parseGpsdLine(%q) = %f, %f; want %f, %f", tt.line, lat, lon, tt.lat, tt.lon)
+			}
+		})
+	}
+}
+
+func TestMaidenhead(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		{"ARRL headquarters", 41.714775, -72.727260, "FN31pr"},
+		{"Munich", 48.1173, 11.516667, "JN58sc"},
+		{"Sydney", -33.8688, 151.2093, "QF56od"},
+		{"origin", 0, 0, "JJ00aa"},
+		{"south west corner", -90, -180, "AA00aa"},
+		{"north pole antimeridian", 90, 180, "RR99xx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maidenhead(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("maidenhead(%f, %f) = %s, want %s", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGpsdClientDefaultPort(t *testing.T) {
+	g := &GpsdClient{Host: "127.0.0.1"}
+	if got := g.Address(); got != "127.0.0.1:2947" {
+		t.Errorf("Address() with no port = %s, want 127.0.0.1:2947", got)
+	}
+}
+
+// fakeGpsd accepts connections and, after the WATCH command, sends line once per client.
+func fakeGpsd(t *testing.T, line string, delay time.Duration) (*GpsdClient, <-chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	connected := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			connected <- struct{}{}
+			go func() {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadString(';'); err != nil {
+					return
+				}
+				time.Sleep(delay)
+				fmt.Fprintln(conn, line)
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return &GpsdClient{Host: "127.0.0.1", Port: addr.Port}, connected
+}
+
+func waitForGrid(t *testing.T, g *GpsdClient) (string, error) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		done := !g.refreshing
+		g.mu.Unlock()
+		if done {
+			return g.GridSquare()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("gpsd refresh did not finish")
+	return "", nil
+}
+
+func TestGpsdClientGridSquareDoesNotBlock(t *testing.T) {
+	g, connected := fakeGpsd(t, `{"class":"TPV","mode":3,"lat":41.714775,"lon":-72.727260}`, 500*time.Millisecond)
+
+	start := time.Now()
+	grid, err := g.GridSquare()
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("GridSquare blocked for %v while gpsd was slow", elapsed)
+	}
+	if grid != "" || err != nil {
+		t.Errorf("first GridSquare = %q, %v; want no grid yet", grid, err)
+	}
+
+	grid, err = waitForGrid(t, g)
+	if grid != "FN31pr" || err != nil {
+		t.Errorf("GridSquare after refresh = %q, %v; want FN31pr", grid, err)
+	}
+
+	// Within the refresh interval the cached grid is returned without a new query
+	for range 5 {
+		g.GridSquare()
+	}
+	if n := len(connected); n != 1 {
+		t.Errorf("gpsd was queried %d times, want 1", n)
+	}
+}
+
+func TestGpsdClientRateLimitsFailures(t *testing.T) {
+	g, connected := fakeGpsd(t, `{"class":"TPV","mode":1}`, 0)
+
+	g.GridSquare()
+	grid, err := waitForGrid(t, g)
+	if err == nil || grid != "" {
+		t.Errorf("GridSquare without a fix = %q, %v; want an error", grid, err)
+	}
+	if _, err := g.GridSquare(); err != nil {
+		t.Errorf("the error was returned again: %v", err)
+	}
+	if n := len(connected); n != 1 {
+		t.Errorf("gpsd was queried %d times after a failure, want 1", n)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// hookTimeout bounds how long an on_change_command may run before it is killed.
+const hookTimeout = 30 * time.Second
+
+// hookWaitDelay bounds how long the hook's output is still read once the command has
+// exited or been killed, as a process it started in the background may hold it open.
+const hookWaitDelay = 2 * time.Second
+
+// hookEnv returns the environment variables describing the radio state for the change hook,
+// with the frequencies, mode, radio name and power of the Wavelog payload. POWER is empty
+// when the payload leaves the power out.
+func hookEnv(config ProfileConfig, data RigData, bandChange bool) []string {
+	payload := buildPayload(config, data)
+	// The payload omits the RX side when it equals TX; the hook wants it anyway
+	frequencyRX := payload.FrequencyRX
+	if frequencyRX == 0 {
+		frequencyRX = payload.Frequency
+	}
+	power := ""
+	if watts, ok := payload.Power.(float64); ok {
+		power = strconv.FormatFloat(watts, 'f', -1, 64)
+	}
+	return []string{
+		"WAVELOGGOAT_RADIO=" + payload.Radio,
+		"WAVELOGGOAT_FREQUENCY=" + strconv.Itoa(payload.Frequency),
+		"WAVELOGGOAT_FREQUENCY_RX=" + strconv.Itoa(frequencyRX),
+		"WAVELOGGOAT_MODE=" + payload.Mode,
+		"WAVELOGGOAT_BAND=" + bandForFrequency(float64(payload.Frequency)),
+		"WAVELOGGOAT_POWER=" + power,
+		"WAVELOGGOAT_SPLIT=" + strconv.Itoa(data.Split),
+		"WAVELOGGOAT_BAND_CHANGE=" + strconv.FormatBool(bandChange),
+	}
+}
+
+// runChangeHook runs the configured on_change_command in the background with the new
+// radio state in its environment, so that it never blocks polling. last is the state
+// previously sent, to tell a band change from tuning; with hook_on_band_change the hook
+// runs only on band changes.
+func runChangeHook(config ProfileConfig, data, last RigData) {
+	if config.OnChangeCommand == "" {
+		return
+	}
+	// Compare the frequencies sent to Wavelog, which follow_ptt may have moved to RX
+	sent := func(d RigData) float64 { return float64(buildPayload(config, d).Frequency) }
+	bandChange := isBandChange(sent(data), sent(last), config.BandChangeHz)
+	if config.HookOnBandChange && !bandChange {
+		log.Debug("Frequency still on the same band. Not running on_change_command.")
+		return
+	}
+	env := append(os.Environ(), hookEnv(config, data, bandChange)...)
+	go runHookCommand(config.OnChangeCommand, env)
+}
+
+// runHookCommand runs command in the shell with env, within hookTimeout, and logs how it
+// went.
+func runHookCommand(command string, env []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = env
+	// The context only kills the shell, not what it left running, such as "rotctl ... &"
+	cmd.WaitDelay = hookWaitDelay
+	output, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		log.Debugf("on_change_command left a background process holding its output. Output: %s", output)
+		return
+	}
+	if err != nil {
+		log.Warnf("on_change_command failed: %v. Output: %s", err, output)
+		return
+	}
+	log.Debugf("on_change_command output: %s", output)
+}
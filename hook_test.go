@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHookEnv(t *testing.T) {
+	data := RigData{FreqVFOA: 7074000, FreqVFOB: 7076000, Mode: "USB", ModeB: "PKTUSB", Split: 1, Power: 25.5}
+	want := []string{
+		"WAVELOGGOAT_RADIO=FT-710",
+		"WAVELOGGOAT_FREQUENCY=7076000",
+		"WAVELOGGOAT_FREQUENCY_RX=7074000",
+		"WAVELOGGOAT_MODE=DATA",
+		"WAVELOGGOAT_BAND=40m",
+		"WAVELOGGOAT_POWER=25.5",
+		"WAVELOGGOAT_SPLIT=1",
+		"WAVELOGGOAT_BAND_CHANGE=true",
+	}
+	if got := hookEnv(ProfileConfig{RadioName: "FT-710"}, data, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("hookEnv = %q, want %q", got, want)
+	}
+
+	// The radio is named as in the payload sent to Wavelog
+	tests := []struct {
+		name   string
+		config ProfileConfig
+		source string // RigData.Source
+		want   string
+	}{
+		{"placeholders", ProfileConfig{RadioName: "FT-710 {band} {mode}"}, "", "FT-710 40m DATA"},
+		{"data source suffix", ProfileConfig{RadioName: "FT-710", RadioNameSource: true, DataSource: "hamlib"}, "", "FT-710-hamlib"},
+		{"failover source suffix", ProfileConfig{RadioName: "FT-710", RadioNameSource: true, DataSource: "flrig"}, "hamlib", "FT-710-hamlib"},
+	}
+	for _, tt := range tests {
+		data := data
+		data.Source = tt.source
+		if got := hookEnv(tt.config, data, false)[0]; got != "WAVELOGGOAT_RADIO="+tt.want {
+			t.Errorf("%s: %s, want WAVELOGGOAT_RADIO=%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHookEnvMatchesPayload(t *testing.T) {
+	// Split from 20m to 15m: receiving on VFO A in a vendor data mode, transmitting on B
+	split := RigData{FreqVFOA: 14074000, FreqVFOB: 21074000, Mode: "USB-D", ModeB: "CW", Split: 1, Power: 50}
+	noPower := RigData{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "USB", ModeB: "USB", NoPower: true}
+	tests := []struct {
+		name   string
+		config ProfileConfig
+		data   RigData
+		want   []string
+	}{
+		{"follow_ptt receiving in split", ProfileConfig{RadioName: "IC-7300", FollowPTT: true}, split, []string{
+			"WAVELOGGOAT_RADIO=IC-7300",
+			"WAVELOGGOAT_FREQUENCY=14074000",
+			"WAVELOGGOAT_FREQUENCY_RX=14074000",
+			"WAVELOGGOAT_MODE=DATA",
+			"WAVELOGGOAT_BAND=20m",
+			"WAVELOGGOAT_POWER=50",
+			"WAVELOGGOAT_SPLIT=1",
+			"WAVELOGGOAT_BAND_CHANGE=false",
+		}},
+		{"mode_map", ProfileConfig{RadioName: "IC-7300", ModeMap: map[string]string{"CW": "MFSK/FT4"}}, split, []string{
+			"WAVELOGGOAT_RADIO=IC-7300",
+			"WAVELOGGOAT_FREQUENCY=21074000",
+			"WAVELOGGOAT_FREQUENCY_RX=14074000",
+			"WAVELOGGOAT_MODE=MFSK",
+			"WAVELOGGOAT_BAND=15m",
+			"WAVELOGGOAT_POWER=50",
+			"WAVELOGGOAT_SPLIT=1",
+			"WAVELOGGOAT_BAND_CHANGE=false",
+		}},
+		{"implausible power left out", ProfileConfig{RadioName: "IC-7300"}, noPower, []string{
+			"WAVELOGGOAT_RADIO=IC-7300",
+			"WAVELOGGOAT_FREQUENCY=14074000",
+			"WAVELOGGOAT_FREQUENCY_RX=14074000",
+			"WAVELOGGOAT_MODE=USB",
+			"WAVELOGGOAT_BAND=20m",
+			"WAVELOGGOAT_POWER=",
+			"WAVELOGGOAT_SPLIT=0",
+			"WAVELOGGOAT_BAND_CHANGE=false",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hookEnv(tt.config, tt.data, false); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hookEnv = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// waitForFile returns the contents of path once a hook has written it.
+func waitForFile(t *testing.T, path string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if b, err := os.ReadFile(path); err == nil {
+			return string(b)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("the hook did not write %s", path)
+	return ""
+}
+
+func TestRunChangeHookEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook command uses a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "env")
+	config := ProfileConfig{
+		RadioName:       "IC-7300",
+		OnChangeCommand: "env | grep '^WAVELOGGOAT_' > " + out + ".tmp && mv " + out + ".tmp " + out,
+	}
+	runChangeHook(config, RigData{FreqVFOA: 14074000, Mode: "USB", Power: 100}, RigData{FreqVFOA: 7074000, Mode: "USB"})
+
+	got := strings.Split(strings.TrimSpace(waitForFile(t, out)), "\n")
+	sort.Strings(got)
+	want := []string{
+		"WAVELOGGOAT_BAND=20m",
+		"WAVELOGGOAT_BAND_CHANGE=true",
+		"WAVELOGGOAT_FREQUENCY=14074000",
+		"WAVELOGGOAT_FREQUENCY_RX=14074000",
+		"WAVELOGGOAT_MODE=USB",
+		"WAVELOGGOAT_POWER=100",
+		"WAVELOGGOAT_RADIO=IC-7300",
+		"WAVELOGGOAT_SPLIT=0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hook environment = %q, want %q", got, want)
+	}
+}
+
+func TestRunChangeHookOnBandChangeOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook command uses a POSIX shell")
+	}
+	dir := t.TempDir()
+	config := ProfileConfig{HookOnBandChange: true, OnChangeCommand: "touch " + dir + "/$WAVELOGGOAT_FREQUENCY"}
+
+	runChangeHook(config, RigData{FreqVFOA: 14075000}, RigData{FreqVFOA: 14074000})
+	runChangeHook(config, RigData{FreqVFOA: 21074000}, RigData{FreqVFOA: 14075000})
+	waitForFile(t, filepath.Join(dir, "21074000"))
+	if _, err := os.Stat(filepath.Join(dir, "14075000")); err == nil {
+		t.Error("the hook ran for tuning within 20m")
+	}
+}
+
+func TestRunHookCommandBackgroundProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook command uses a POSIX shell")
+	}
+	logs := captureLog(t, logrus.DebugLevel)
+	// The background sleep keeps the output open after the shell has exited
+	start := time.Now()
+	runHookCommand("sleep 10 & echo started", os.Environ())
+	if elapsed := time.Since(start); elapsed > hookWaitDelay+2*time.Second {
+		t.Errorf("the hook took %s with a background process, want about %s", elapsed.Round(time.Millisecond), hookWaitDelay)
+	}
+	if got := logs.String(); !strings.Contains(got, "background process") || strings.Contains(got, "level=warn") {
+		t.Errorf("logged %q, want a debug message about the background process", got)
+	}
+}
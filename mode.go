@@ -0,0 +1,183 @@
+package main
+
+import "strings"
+
+// hamlibModes maps rigctld mode names that Wavelog does not know to the mode Wavelog
+// records. Packet modes are handled separately by packetBase.
+var hamlibModes = map[string]string{
+	"CWR":     "CW",
+	"RTTYR":   "RTTY",
+	"FMN":     "FM",
+	"WFM":     "FM",
+	"AMS":     "AM",
+	"SAM":     "AM",
+	"SAL":     "AM",
+	"SAH":     "AM",
+	"ECSSUSB": "USB",
+	"ECSSLSB": "LSB",
+	"D-STAR":  "DSTAR",
+	"DSTAR":   "DSTAR",
+	"C4FM":    "C4FM",
+	"DMR":     "DMR",
+	"P25":     "P25",
+	"DPMR":    "DPMR",
+	"NXDN-VN": "NXDN",
+	"NXDN-N":  "NXDN",
+}
+
+// packetBase returns the carrier mode of a hamlib packet (data) mode such as PKTUSB,
+// PKTLSB, PKTFM, PKTFMN or PKTAM, and whether mode is one.
+func packetBase(mode string) (string, bool) {
+	base, ok := strings.CutPrefix(mode, "PKT")
+	if !ok || base == "" {
+		return "", false
+	}
+	if mapped, ok := hamlibModes[base]; ok {
+		base = mapped
+	}
+	return base, true
+}
+
+// wavelogMode translates a backend mode string into the mode sent to Wavelog. Packet
+// modes become DATA, or keep their sideband (PKTUSB as USB) when packetStyle is
+// "sideband". Unknown modes are passed through unchanged.
+func wavelogMode(mode, packetStyle string) string {
+	upper := strings.ToUpper(strings.TrimSpace(mode))
+	if base, ok := packetBase(upper); ok {
+		if strings.EqualFold(packetStyle, "sideband") {
+			return base
+		}
+		return "DATA"
+	}
+	if mapped, ok := hamlibModes[upper]; ok {
+		return mapped
+	}
+	return mode
+}
+
+// applyDataModes rewrites mode to DATA when it is one of dataModes, returning the new
+// mode and the original one as the submode. Other modes are returned unchanged with no
+// submode.
+func applyDataModes(mode string, dataModes []string) (string, string) {
+	if mode == "" {
+		return mode, ""
+	}
+	for _, dataMode := range dataModes {
+		if strings.EqualFold(mode, strings.TrimSpace(dataMode)) {
+			return "DATA", strings.ToUpper(mode)
+		}
+	}
+	return mode, ""
+}
+
+// defaultModeMap translates the vendor mode strings flrig reports for common Yaesu, Icom
+// and Kenwood rigs into "MODE" or "MODE/SUBMODE" for Wavelog. A profile's mode_map
+// entries take precedence; mapping a mode to "" disables its default.
+var defaultModeMap = map[string]string{
+	// Data on a sideband carrier: Yaesu DATA-U/DATA-L, Icom USB-D/LSB-D, Kenwood/Elecraft DATA
+	"USB-D":   "DATA/USB",
+	"USB-D1":  "DATA/USB",
+	"USB-D2":  "DATA/USB",
+	"USB-D3":  "DATA/USB",
+	"LSB-D":   "DATA/LSB",
+	"LSB-D1":  "DATA/LSB",
+	"LSB-D2":  "DATA/LSB",
+	"LSB-D3":  "DATA/LSB",
+	"DATA-U":  "DATA/USB",
+	"DATA-L":  "DATA/LSB",
+	"DIGU":    "DATA/USB",
+	"DIGL":    "DATA/LSB",
+	"PKT-U":   "DATA/USB",
+	"PKT-L":   "DATA/LSB",
+	"FM-D":    "DATA/FM",
+	"DATA-FM": "DATA/FM",
+	"PKT-FM":  "DATA/FM",
+	"AM-D":    "DATA/AM",
+	// Reversed and narrow variants of the basic modes
+	"CW-R":   "CW",
+	"CW-U":   "CW",
+	"CW-L":   "CW",
+	"CWR":    "CW",
+	"RTTY-R": "RTTY",
+	"RTTY-L": "RTTY",
+	"RTTY-U": "RTTY",
+	"RTTYR":  "RTTY",
+	"FSK":    "RTTY",
+	"FSK-R":  "RTTY",
+	"FM-N":   "FM",
+	"NFM":    "FM",
+	"AM-N":   "AM",
+}
+
+// splitModeSuffix parses the suffixes vendors append to the mode names flrig reports
+// that are not in defaultModeMap: "-D" (or "-D1" and so on) marks data on the carrier mode
+// before it, as in AM-D2, and "-U" or "-L" gives the sideband, either of a data carrier
+// (DATA-, PKT- or DIG-) or of a mode such as CW or RTTY. ok is false when mode has none.
+func splitModeSuffix(mode string) (carrier string, data, ok bool) {
+	i := strings.LastIndex(mode, "-")
+	if i <= 0 {
+		return "", false, false
+	}
+	prefix, suffix := mode[:i], mode[i+1:]
+	switch {
+	case suffix == "U" || suffix == "L":
+		if prefix != "DATA" && prefix != "PKT" && prefix != "DIG" {
+			return prefix, false, true
+		}
+		if suffix == "U" {
+			return "USB", true, true
+		}
+		return "LSB", true, true
+	case strings.HasPrefix(suffix, "D") && strings.Trim(suffix[1:], "0123456789") == "":
+		return prefix, true, true
+	}
+	return "", false, false
+}
+
+// mapModeString looks mode up in the profile's mode map, then in defaultModeMap, and
+// splits the result into mode and submode. Modes in neither are parsed by their vendor
+// suffix. ok is false when mode is not mapped.
+func mapModeString(mode string, overrides map[string]string) (base, submode string, ok bool) {
+	key := strings.ToUpper(strings.TrimSpace(mode))
+	mapped, found := "", false
+	for k, v := range overrides {
+		if strings.EqualFold(k, key) {
+			mapped, found = v, true
+			break
+		}
+	}
+	if !found {
+		mapped, found = defaultModeMap[key]
+	}
+	if !found {
+		if carrier, data, ok := splitModeSuffix(key); ok {
+			if data {
+				return "DATA", carrier, true
+			}
+			return carrier, "", true
+		}
+	}
+	if !found || mapped == "" {
+		return mode, "", false
+	}
+	base, submode, _ = strings.Cut(mapped, "/")
+	return base, submode, true
+}
+
+// translateMode turns a backend mode into the mode and submode sent to Wavelog: vendor
+// mode strings are mapped, hamlib packet modes translated, a bare SSB refined into its
+// sideband at freq, and data_modes rewritten to DATA.
+func translateMode(config ProfileConfig, mode string, freq float64) (string, string) {
+	if mode == "" {
+		return mode, ""
+	}
+	base, submode, ok := mapModeString(mode, config.ModeMap)
+	if !ok {
+		base = wavelogMode(mode, config.PacketModes)
+	}
+	base = refineSSB(base, freq, config.SSBSideband)
+	if rewritten, original := applyDataModes(base, config.DataModes); original != "" {
+		return rewritten, original
+	}
+	return base, submode
+}
@@ -0,0 +1,178 @@
+package main
+
+import "testing"
+
+func TestWavelogMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		data     string // with the default packet_modes
+		sideband string // with packet_modes "sideband"
+	}{
+		{"PKTUSB", "DATA", "USB"},
+		{"PKTLSB", "DATA", "LSB"},
+		{"PKTFM", "DATA", "FM"},
+		{"PKTFMN", "DATA", "FM"},
+		{"PKTAM", "DATA", "AM"},
+		{"pktusb", "DATA", "USB"},
+		{"D-STAR", "DSTAR", "DSTAR"},
+		{"C4FM", "C4FM", "C4FM"},
+		{"NXDN-VN", "NXDN", "NXDN"},
+		{"WFM", "FM", "FM"},
+		{"CWR", "CW", "CW"},
+		{"ECSSLSB", "LSB", "LSB"},
+		{"USB", "USB", "USB"},
+		{"PKT", "PKT", "PKT"},
+		{"FT8", "FT8", "FT8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if got := wavelogMode(tt.mode, ""); got != tt.data {
+				t.Errorf("wavelogMode(%q, \"\") = %q, want %q", tt.mode, got, tt.data)
+			}
+			if got := wavelogMode(tt.mode, "sideband"); got != tt.sideband {
+				t.Errorf("wavelogMode(%q, \"sideband\") = %q, want %q", tt.mode, got, tt.sideband)
+			}
+		})
+	}
+}
+
+func TestTranslatePacketModeSSB(t *testing.T) {
+	// A packet mode keeps its sideband rather than having it guessed from the band
+	config := ProfileConfig{PacketModes: "sideband", SSBSideband: "auto"}
+	if mode, _ := translateMode(config, "PKTUSB", 7074000); mode != "USB" {
+		t.Errorf("PKTUSB on 40m = %q, want USB", mode)
+	}
+	if mode, _ := translateMode(ProfileConfig{}, "PKTLSB", 14074000); mode != "DATA" {
+		t.Errorf("PKTLSB = %q, want DATA", mode)
+	}
+}
+
+func TestApplyDataModes(t *testing.T) {
+	dataModes := []string{"FT8", " rtty ", "PSK31"}
+	tests := []struct {
+		mode, want, submode string
+	}{
+		{"FT8", "DATA", "FT8"},
+		{"ft8", "DATA", "FT8"},
+		{"RTTY", "DATA", "RTTY"},
+		{"PSK31", "DATA", "PSK31"},
+		{"USB", "USB", ""},
+		{"CW", "CW", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got, submode := applyDataModes(tt.mode, dataModes); got != tt.want || submode != tt.submode {
+			t.Errorf("applyDataModes(%q) = %q, %q; want %q, %q", tt.mode, got, submode, tt.want, tt.submode)
+		}
+	}
+	if got, submode := applyDataModes("FT8", nil); got != "FT8" || submode != "" {
+		t.Errorf("applyDataModes without data_modes = %q, %q; want FT8 unchanged", got, submode)
+	}
+}
+
+func TestBuildPayloadDataModes(t *testing.T) {
+	data := RigData{FreqVFOA: 14080000, Mode: "RTTY"}
+	tests := []struct {
+		name        string
+		sendSubmode bool
+		submode     string
+	}{
+		{"without submode support", false, ""},
+		{"with submode support", true, "RTTY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := ProfileConfig{RadioName: "TS-590", DataModes: []string{"RTTY"}, SendSubmode: tt.sendSubmode}
+			payload := buildPayload(config, data)
+			if payload.Mode != "DATA" || payload.Submode != tt.submode {
+				t.Errorf("mode = %q, submode = %q; want DATA, %q", payload.Mode, payload.Submode, tt.submode)
+			}
+		})
+	}
+}
+
+func TestMapModeString(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		overrides map[string]string
+		base      string
+		submode   string
+		ok        bool
+	}{
+		{"Icom USB-D", "USB-D", nil, "DATA", "USB", true},
+		{"Icom LSB-D2", "LSB-D2", nil, "DATA", "LSB", true},
+		{"Yaesu DATA-U", "DATA-U", nil, "DATA", "USB", true},
+		{"Yaesu DATA-FM", "DATA-FM", nil, "DATA", "FM", true},
+		{"Kenwood DIGU", "DIGU", nil, "DATA", "USB", true},
+		{"Elecraft PKT-L", "pkt-l", nil, "DATA", "LSB", true},
+		{"Icom FM-D", "FM-D", nil, "DATA", "FM", true},
+		{"reverse CW", "CW-R", nil, "CW", "", true},
+		{"RTTY-L", "RTTY-L", nil, "RTTY", "", true},
+		{"FSK", "FSK", nil, "RTTY", "", true},
+		{"narrow FM", "FM-N", nil, "FM", "", true},
+		{"plain mode", "USB", nil, "USB", "", false},
+		{"override", "DIGU", map[string]string{"digu": "FT8"}, "FT8", "", true},
+		{"override with submode", "USB-D", map[string]string{"USB-D": "MFSK/FT4"}, "MFSK", "FT4", true},
+		{"override disables a default", "DATA-U", map[string]string{"DATA-U": ""}, "DATA-U", "", false},
+		{"new mode", "JS8", map[string]string{"JS8": "MFSK/JS8"}, "MFSK", "JS8", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, submode, ok := mapModeString(tt.mode, tt.overrides)
+			if base != tt.base || submode != tt.submode || ok != tt.ok {
+				t.Errorf("mapModeString(%q) = %q, %q, %v; want %q, %q, %v", tt.mode, base, submode, ok, tt.base, tt.submode, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSplitModeSuffix(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		carrier string
+		data    bool
+		ok      bool
+	}{
+		{"Icom data on USB", "USB-D", "USB", true, true},
+		{"Icom data mode 3 on LSB", "LSB-D3", "LSB", true, true},
+		{"Icom data on AM", "AM-D2", "AM", true, true},
+		{"Icom data on FM", "FM-D1", "FM", true, true},
+		{"Yaesu upper data", "DATA-U", "USB", true, true},
+		{"Yaesu lower data", "DATA-L", "LSB", true, true},
+		{"Elecraft upper data", "PKT-U", "USB", true, true},
+		{"Kenwood lower data", "DIG-L", "LSB", true, true},
+		{"CW sideband", "CW-U", "CW", false, true},
+		{"RTTY sideband", "RTTY-L", "RTTY", false, true},
+		{"no suffix", "USB", "", false, false},
+		{"suffix only", "-D", "", false, false},
+		{"narrow FM", "FM-N", "", false, false},
+		{"D followed by letters", "USB-DX", "", false, false},
+		{"data FM", "DATA-FM", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carrier, data, ok := splitModeSuffix(tt.mode)
+			if carrier != tt.carrier || data != tt.data || ok != tt.ok {
+				t.Errorf("splitModeSuffix(%q) = %q, %v, %v; want %q, %v, %v", tt.mode, carrier, data, ok, tt.carrier, tt.data, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTranslateModeSuffix(t *testing.T) {
+	tests := []struct {
+		mode, base, submode string
+	}{
+		{"lsb-d3", "DATA", "LSB"},
+		{"AM-D2", "DATA", "AM"},
+		{"CW-U", "CW", ""},
+		{"USB", "USB", ""},
+	}
+	for _, tt := range tests {
+		if base, submode := translateMode(ProfileConfig{}, tt.mode, 14074000); base != tt.base || submode != tt.submode {
+			t.Errorf("translateMode(%q) = %q, %q; want %q, %q", tt.mode, base, submode, tt.base, tt.submode)
+		}
+	}
+}
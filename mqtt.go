@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// defaultMQTTTopic is used when mqtt_broker is set without an mqtt_topic.
+const defaultMQTTTopic = "waveloggoat/radio"
+
+// mqttPublishTimeout bounds how long a publish may hold up the polling loop.
+const mqttPublishTimeout = 5 * time.Second
+
+// MQTTPublisher publishes each radio state change to an MQTT broker as the same JSON
+// payload that is sent to Wavelog, without the API key.
+type MQTTPublisher struct {
+	client mqtt.Client
+	topic  string
+	retain bool
+
+	last      RigData
+	published bool
+	resend    atomic.Bool // set on every (re)connect, as the broker may have lost the state
+}
+
+// newMQTTPublisher connects to the profile's MQTT broker in the background. The client
+// keeps retrying the connection, and reconnects whenever the broker drops it.
+func newMQTTPublisher(config ProfileConfig) *MQTTPublisher {
+	topic := config.MQTTTopic
+	if topic == "" {
+		topic = defaultMQTTTopic
+	}
+	hostname, _ := os.Hostname()
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.MQTTBroker).
+		SetClientID(fmt.Sprintf("waveloggoat-%s-%d", hostname, os.Getpid())).
+		SetUsername(config.MQTTUser).
+		SetPassword(config.MQTTPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Warnf("Lost connection to MQTT broker %s: %v. Reconnecting.", config.MQTTBroker, err)
+		})
+	p := &MQTTPublisher{topic: topic, retain: config.MQTTRetain}
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		log.Infof("Connected to MQTT broker %s", config.MQTTBroker)
+		p.resend.Store(true)
+	})
+	p.client = mqtt.NewClient(opts)
+	p.client.Connect()
+	return p
+}
+
+// Publish sends the state unless it is the same as the one published last since the
+// broker connection was made.
+func (p *MQTTPublisher) Publish(config ProfileConfig, data RigData) error {
+	// The threshold was checked when the profile was loaded
+	threshold, _ := parsePowerThreshold(config.PowerChangeThreshold)
+	if p.published && !hasMeaningfulChange(data, p.last, threshold) && !p.resend.Load() {
+		return nil
+	}
+	payload := buildPayload(config, data)
+	payload.Key = "" // the API key is for Wavelog only
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal MQTT payload: %w", err)
+	}
+	if !p.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to the MQTT broker")
+	}
+	token := p.client.Publish(p.topic, 0, p.retain, message)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return fmt.Errorf("timed out publishing to MQTT topic %s", p.topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to MQTT topic %s: %w", p.topic, err)
+	}
+	log.Debugf("Published to MQTT topic %s: %s", p.topic, message)
+	p.last, p.published = data, true
+	p.resend.Store(false)
+	return nil
+}
+
+// Close disconnects from the broker, giving queued messages a moment to be sent.
+func (p *MQTTPublisher) Close() {
+	p.client.Disconnect(250)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mqttMessage is a message published to testBroker.
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// testBroker is a minimal MQTT 3.1.1 broker that accepts any client, records the
+// credentials it connects with and the QoS 0 messages it publishes, and can drop the
+// connection as a broker restart would.
+type testBroker struct {
+	ln       net.Listener
+	messages chan mqttMessage
+
+	mu    sync.Mutex
+	conns []net.Conn
+	users []string // "user:password" of each connection
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{ln: ln, messages: make(chan mqttMessage, 10)}
+	t.Cleanup(func() {
+		ln.Close()
+		b.dropClients()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conns = append(b.conns, conn)
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *testBroker) URL() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+// dropClients closes every client connection.
+func (b *testBroker) dropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *testBroker) connections() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.users...)
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		var length, shift int
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			length |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(r, packet); err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			b.mu.Lock()
+			b.users = append(b.users, connectCredentials(packet))
+			b.mu.Unlock()
+			conn.Write([]byte{0x20, 2, 0, 0})
+		case 3: // PUBLISH
+			n := int(binary.BigEndian.Uint16(packet))
+			msg := mqttMessage{Topic: string(packet[2 : 2+n]), Retain: header&1 != 0}
+			rest := packet[2+n:]
+			if header&0x06 != 0 { // QoS 1 and 2 carry a packet ID
+				rest = rest[2:]
+			}
+			msg.Payload = rest
+			b.messages <- msg
+		case 12: // PINGREQ
+			conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			conn.Close()
+			return
+		}
+	}
+}
+
+// connectCredentials returns "user:password" from a CONNECT packet.
+func connectCredentials(packet []byte) string {
+	field := func() string {
+		n := int(binary.BigEndian.Uint16(packet))
+		s := string(packet[2 : 2+n])
+		packet = packet[2+n:]
+		return s
+	}
+	field() // protocol name
+	flags := packet[1]
+	packet = packet[4:] // level, flags and keep alive
+	field()             // client ID
+	if flags&0x04 != 0 {
+		field() // will topic
+		field() // will message
+	}
+	var user, password string
+	if flags&0x80 != 0 {
+		user = field()
+	}
+	if flags&0x40 != 0 {
+		password = field()
+	}
+	return user + ":" + password
+}
+
+// publishWhenConnected publishes data, retrying while the client is still connecting.
+func publishWhenConnected(t *testing.T, p *MQTTPublisher, config ProfileConfig, data RigData) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := p.Publish(config, data)
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Publish: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (b *testBroker) expectMessage(t *testing.T) mqttMessage {
+	t.Helper()
+	select {
+	case msg := <-b.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message published")
+	}
+	return mqttMessage{}
+}
+
+func (b *testBroker) expectNoMessage(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-b.messages:
+		t.Errorf("unexpected message on %s: %s", msg.Topic, msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	broker := newTestBroker(t)
+	config := ProfileConfig{
+		WavelogKey: "secret", RadioName: "IC-7300",
+		MQTTBroker: broker.URL(), MQTTTopic: "shack/ic7300", MQTTUser: "op", MQTTPassword: "pw", MQTTRetain: true,
+	}
+	p := newMQTTPublisher(config)
+	defer p.Close()
+
+	data := RigData{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "USB", ModeB: "USB", Power: 50}
+	publishWhenConnected(t, p, config, data)
+	msg := broker.expectMessage(t)
+	var payload WavelogJSONRequest
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("message is not a JSON payload: %v (%s)", err, msg.Payload)
+	}
+	if msg.Topic != "shack/ic7300" || !msg.Retain {
+		t.Errorf("published to %s, retain %v; want shack/ic7300 retained", msg.Topic, msg.Retain)
+	}
+	if payload.Key != "" || payload.Radio != "IC-7300" || payload.Frequency != 14074000 || payload.Mode != "USB" {
+		t.Errorf("payload = %+v, want the Wavelog payload without the API key", payload)
+	}
+	if users := broker.connections(); len(users) != 1 || users[0] != "op:pw" {
+		t.Errorf("connected with %q, want op:pw", users)
+	}
+
+	// An unchanged state is not published again
+	p.Publish(config, data)
+	broker.expectNoMessage(t)
+
+	// After the broker drops the connection the client reconnects and publishes the
+	// unchanged state again, as the broker may have lost it
+	broker.dropClients()
+	deadline := time.Now().Add(10 * time.Second)
+	for !p.resend.Load() && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	publishWhenConnected(t, p, config, data)
+	if msg := broker.expectMessage(t); msg.Topic != "shack/ic7300" {
+		t.Errorf("after reconnecting published to %s", msg.Topic)
+	}
+	if users := broker.connections(); len(users) != 2 {
+		t.Errorf("%d connections to the broker, want a reconnect", len(users))
+	}
+}
+
+func TestMQTTPublisherDefaultTopic(t *testing.T) {
+	broker := newTestBroker(t)
+	config := ProfileConfig{RadioName: "IC-705", MQTTBroker: broker.URL()}
+	p := newMQTTPublisher(config)
+	defer p.Close()
+	publishWhenConnected(t, p, config, RigData{FreqVFOA: 7074000, Mode: "LSB"})
+	if msg := broker.expectMessage(t); msg.Topic != defaultMQTTTopic || msg.Retain {
+		t.Errorf("published to %s, retain %v; want %s not retained", msg.Topic, msg.Retain, defaultMQTTTopic)
+	}
+}
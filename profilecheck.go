@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// profileResult is the outcome of checking one profile with -test-all-profiles.
+type profileResult struct {
+	Name    string
+	Radio   string
+	Wavelog string
+	OK      bool
+}
+
+// checkWavelogReachable makes a plain GET request to the profile's Wavelog URL. Any HTTP
+// response counts as reachable; no radio data is posted.
+func checkWavelogReachable(config ProfileConfig) error {
+	client, err := newWavelogClient(config)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", config.WavelogURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent(config))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// checkProfile validates a profile, reads the radio once and checks that Wavelog answers.
+func checkProfile(name string, config ProfileConfig, placeholderKey string) profileResult {
+	result := profileResult{Name: name, Radio: "-", Wavelog: "-"}
+	if err := validateProfile(config, placeholderKey); err != nil {
+		result.Radio = "FAIL: " + err.Error()
+		return result
+	}
+
+	client, err := newRadioClient(config)
+	if err != nil {
+		result.Radio = "FAIL: " + err.Error()
+		return result
+	}
+	data, err := client.GetData()
+	if closer, ok := client.(io.Closer); ok {
+		closer.Close()
+	}
+	data = applyTransverterOffset(config, data)
+	radioOK := err == nil
+	if radioOK {
+		result.Radio = fmt.Sprintf("ok (%d Hz %s)", freqHz(txFrequency(data)), txMode(data))
+	} else {
+		result.Radio = "FAIL: " + err.Error()
+	}
+
+	wavelogOK := true
+	if err := checkWavelogReachable(config); err != nil {
+		wavelogOK = false
+		result.Wavelog = "FAIL: " + err.Error()
+	} else {
+		result.Wavelog = "ok"
+	}
+
+	result.OK = radioOK && wavelogOK
+	return result
+}
+
+// testProfiles checks every profile in the configuration file and prints a summary
+// table. It reports whether all profiles passed.
+func testProfiles(cfg ConfigFile, placeholderKey string) bool {
+	if len(cfg.Profiles) == 0 {
+		fmt.Println("No profiles in the configuration file.")
+		return false
+	}
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	allOK := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tSOURCE\tRESULT\tRADIO\tWAVELOG")
+	for _, name := range names {
+		config := cfg.Profiles[name]
+		result := checkProfile(name, config, placeholderKey)
+		verdict := "PASS"
+		if !result.OK {
+			verdict = "FAIL"
+			allOK = false
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Name, config.DataSource, verdict, result.Radio, result.Wavelog)
+	}
+	w.Flush()
+	return allOK
+}
+
+// profileDiff is one setting that differs between two profiles.
+type profileDiff struct {
+	Field string // JSON name of the setting
+	A, B  string
+}
+
+// diffProfiles compares two profiles field by field and returns the settings that
+// differ. The API key and flrig and MQTT passwords are never shown, only whether they differ.
+func diffProfiles(a, b ProfileConfig) []profileDiff {
+	var diffs []profileDiff
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fa, fb := va.Field(i).Interface(), vb.Field(i).Interface()
+		if reflect.DeepEqual(fa, fb) {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		diff := profileDiff{Field: name, A: formatSetting(fa), B: formatSetting(fb)}
+		if field := t.Field(i).Name; field == "WavelogKey" || field == "FlrigPassword" || field == "MQTTPassword" {
+			diff.A, diff.B = "<redacted>", "<redacted, differs>"
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// formatSetting formats a setting for display, quoting strings so that empty ones show
+// and showing the value of optional settings rather than their address.
+func formatSetting(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "<default>"
+		}
+		return formatSetting(rv.Elem().Interface())
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// printProfileDiff prints the differences between two named profiles to out as a table.
+func printProfileDiff(out io.Writer, cfg ConfigFile, nameA, nameB string) error {
+	a, ok := cfg.Profiles[nameA]
+	if !ok {
+		return fmt.Errorf("profile '%s' does not exist in the configuration file", nameA)
+	}
+	b, ok := cfg.Profiles[nameB]
+	if !ok {
+		return fmt.Errorf("profile '%s' does not exist in the configuration file", nameB)
+	}
+	diffs := diffProfiles(a, b)
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintf(out, "Profiles '%s' and '%s' are identical.\n", nameA, nameB)
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "SETTING\t%s\t%s\n", nameA, nameB)
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", d.Field, d.A, d.B)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffProfiles(t *testing.T) {
+	a := ProfileConfig{WavelogKey: "key-a", RadioName: "IC-7300", DataSource: "flrig", FlrigPort: 12345}
+	noRetries := 0
+	b := ProfileConfig{WavelogKey: "key-b", RadioName: "IC-705", DataSource: "flrig", FlrigPort: 12346, GridSquare: "FN31pr", ParseRetries: &noRetries}
+
+	want := []profileDiff{
+		{"wavelog_key", "<redacted>", "<redacted, differs>"},
+		{"radio_name", `"IC-7300"`, `"IC-705"`},
+		{"flrig_port", "12345", "12346"},
+		{"grid_square", `""`, `"FN31pr"`},
+		{"parse_retries", "<default>", "0"},
+	}
+	got := diffProfiles(a, b)
+	// Compare regardless of field order in ProfileConfig
+	byField := make(map[string]profileDiff)
+	for _, d := range got {
+		byField[d.Field] = d
+	}
+	if len(got) != len(want) {
+		t.Errorf("diffProfiles found %d differences, want %d: %+v", len(got), len(want), got)
+	}
+	for _, w := range want {
+		if d := byField[w.Field]; !reflect.DeepEqual(d, w) {
+			t.Errorf("difference in %s = %+v, want %+v", w.Field, d, w)
+		}
+	}
+}
+
+func TestPrintProfileDiff(t *testing.T) {
+	cfg := ConfigFile{Profiles: map[string]ProfileConfig{
+		"home":     {WavelogKey: "secret-home", RadioName: "IC-7300"},
+		"portable": {WavelogKey: "secret-portable", RadioName: "IC-705"},
+		"copy":     {WavelogKey: "secret-home", RadioName: "IC-7300"},
+	}}
+
+	var out bytes.Buffer
+	if err := printProfileDiff(&out, cfg, "home", "portable"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || strings.Fields(lines[0])[1] != "home" || strings.Fields(lines[0])[2] != "portable" {
+		t.Fatalf("diff output:\n%s\nwant a header and two settings", out.String())
+	}
+	if !strings.Contains(out.String(), `radio_name   "IC-7300"`) {
+		t.Errorf("diff output does not align radio_name:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("diff output reveals the API key:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := printProfileDiff(&out, cfg, "home", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "Profiles 'home' and 'copy' are identical.\n" {
+		t.Errorf("identical profiles printed %q", got)
+	}
+	if err := printProfileDiff(&out, cfg, "home", "missing"); err == nil {
+		t.Error("no error for a missing profile")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ReceiverState is the receiver front end setup read with read_receiver_state, and the
+// filter and IF shift read with read_if_shift, for the status display only. Each setting
+// is "" when unknown.
+type ReceiverState struct {
+	AGC        string `json:"agc,omitempty"`
+	Preamp     string `json:"preamp,omitempty"`
+	Attenuator string `json:"attenuator,omitempty"`
+	Filter     string `json:"filter,omitempty"`
+	IFShift    string `json:"if_shift,omitempty"`
+}
+
+// hasFrontEnd reports whether any of the read_receiver_state settings are known.
+func (r ReceiverState) hasFrontEnd() bool {
+	return r.AGC != "" || r.Preamp != "" || r.Attenuator != ""
+}
+
+// hamlibAGCNames names the values of hamlib's AGC level (enum agc_level_e).
+var hamlibAGCNames = map[int]string{
+	0:  "off",
+	1:  "superfast",
+	2:  "fast",
+	3:  "slow",
+	4:  "user",
+	5:  "medium",
+	6:  "auto",
+	7:  "long",
+	8:  "on",
+	9:  "none",
+	10: "manual",
+}
+
+// parseHamlibAGC names an 'l AGC' reply, falling back to the raw value for levels that
+// are not known.
+func parseHamlibAGC(resp string) string {
+	resp = strings.TrimSpace(resp)
+	level, err := strconv.Atoi(resp)
+	if err != nil {
+		return resp
+	}
+	if name, ok := hamlibAGCNames[level]; ok {
+		return name
+	}
+	return resp
+}
+
+// parseHamlibDB formats an 'l PREAMP' or 'l ATT' reply in dB, with 0 as "off".
+func parseHamlibDB(resp string) string {
+	db, err := strconv.ParseFloat(strings.TrimSpace(resp), 64)
+	if err != nil {
+		return ""
+	}
+	if db == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%g dB", db)
+}
+
+// formatFilter formats a passband width in Hz, or "" when the rig did not report one.
+func formatFilter(width float64) string {
+	if width <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%g Hz", width)
+}
+
+// formatIFShift formats an IF shift in Hz with its sign, e.g. "+250 Hz", and 0 as "0 Hz".
+func formatIFShift(shift float64) string {
+	if shift == 0 {
+		return "0 Hz"
+	}
+	return fmt.Sprintf("%+g Hz", shift)
+}
+
+// parseHamlibIFShift formats an 'l IF' reply, an IF shift in Hz.
+func parseHamlibIFShift(resp string) string {
+	shift, err := strconv.ParseFloat(strings.TrimSpace(resp), 64)
+	if err != nil {
+		return ""
+	}
+	return formatIFShift(shift)
+}
+
+// readIFShift reads the IF shift, or "" when the rig does not support it.
+func (sess *hamlibSession) readIFShift() string {
+	resp, err := sess.query("l IF", 1)
+	if err != nil || len(resp) == 0 {
+		log.Debugf("Failed to read IF shift from hamlib: %v", err)
+		return ""
+	}
+	return parseHamlibIFShift(resp[0])
+}
+
+// readReceiverState reads the AGC, preamp and attenuator levels, leaving any the rig
+// does not support empty.
+func (sess *hamlibSession) readReceiverState() ReceiverState {
+	var state ReceiverState
+	if resp, err := sess.query("l AGC", 1); err == nil && len(resp) > 0 {
+		state.AGC = parseHamlibAGC(resp[0])
+	}
+	if resp, err := sess.query("l PREAMP", 1); err == nil && len(resp) > 0 {
+		state.Preamp = parseHamlibDB(resp[0])
+	}
+	if resp, err := sess.query("l ATT", 1); err == nil && len(resp) > 0 {
+		state.Attenuator = parseHamlibDB(resp[0])
+	}
+	return state
+}
+
+// formatFlrigSetting formats an flrig receiver setting reply. flrig reports the rig's own
+// setting index (or label, in some releases), and 0 means off for all of them.
+func formatFlrigSetting(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strings.TrimSpace(s)
+	}
+	n, ok := parseFlrigNumber(v)
+	if !ok {
+		return ""
+	}
+	if n == 0 {
+		return "off"
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// getIFShift reads the IF shift with rig.get_if_shift, or "" when flrig or the rig does
+// not support it.
+func (f *FlrigClient) getIFShift() string {
+	return f.getReceiverSetting("rig.get_if_shift", func(v interface{}) string {
+		if shift, ok := parseFlrigNumber(v); ok {
+			return formatIFShift(shift)
+		}
+		return ""
+	})
+}
+
+// getReceiverSetting reads one receiver setting such as rig.get_agc and formats it with
+// format. Methods the rig does not support are not called again on this connection.
+func (f *FlrigClient) getReceiverSetting(method string, format func(interface{}) string) string {
+	f.mu.Lock()
+	unsupported := f.receiverUnsupported[method]
+	f.mu.Unlock()
+	if unsupported {
+		return ""
+	}
+	var v interface{}
+	if err := f.call(method, nil, &v); err != nil {
+		log.Debugf("call failed to %s (flrig): %v", method, err)
+		if !isTransientConnError(err) {
+			f.mu.Lock()
+			if f.receiverUnsupported == nil {
+				f.receiverUnsupported = make(map[string]bool)
+			}
+			f.receiverUnsupported[method] = true
+			f.mu.Unlock()
+		}
+		return ""
+	}
+	return format(v)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseHamlibAGC(t *testing.T) {
+	tests := []struct{ resp, want string }{
+		{"0", "off"},
+		{"2", "fast"},
+		{"3\n", "slow"},
+		{"6", "auto"},
+		{"42", "42"},
+		{"FAST", "FAST"},
+	}
+	for _, tt := range tests {
+		if got := parseHamlibAGC(tt.resp); got != tt.want {
+			t.Errorf("parseHamlibAGC(%q) = %q, want %q", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestParseHamlibDB(t *testing.T) {
+	tests := []struct{ resp, want string }{
+		{"0", "off"},
+		{"10", "10 dB"},
+		{"20.000000", "20 dB"},
+		{" 6 ", "6 dB"},
+		{"RPRT -11", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseHamlibDB(tt.resp); got != tt.want {
+			t.Errorf("parseHamlibDB(%q) = %q, want %q", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestFormatFlrigSetting(t *testing.T) {
+	tests := []struct {
+		reply interface{}
+		want  string
+	}{
+		{int64(0), "off"},
+		{int64(2), "2"},
+		{1.0, "1"},
+		{"0", "0"},
+		{" AMP1 ", "AMP1"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := formatFlrigSetting(tt.reply); got != tt.want {
+			t.Errorf("formatFlrigSetting(%#v) = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestParseHamlibIFShift(t *testing.T) {
+	tests := []struct{ resp, want string }{
+		{"0", "0 Hz"},
+		{"250", "+250 Hz"},
+		{"-300", "-300 Hz"},
+		{" 120.5\n", "+120.5 Hz"},
+		{"RPRT -11", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseHamlibIFShift(tt.resp); got != tt.want {
+			t.Errorf("parseHamlibIFShift(%q) = %q, want %q", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestFormatFilter(t *testing.T) {
+	tests := []struct {
+		width float64
+		want  string
+	}{
+		{500, "500 Hz"},
+		{2400, "2400 Hz"},
+		{0, ""},
+		{-1, ""},
+	}
+	for _, tt := range tests {
+		if got := formatFilter(tt.width); got != tt.want {
+			t.Errorf("formatFilter(%g) = %q, want %q", tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestReadIFShift(t *testing.T) {
+	want := ReceiverState{Filter: "500 Hz", IFShift: "-200 Hz"}
+	responses := map[string]string{
+		"f": "7030000", "m": "CW\n500", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA", "l IF": "-200",
+	}
+	rig, client := newFakeRigctld(t, responses, false)
+	client.ReadIFShift = true
+	if data, err := client.GetData(); err != nil || data.Receiver != want {
+		t.Errorf("hamlib filter and IF shift = %+v, %v; want %+v", data.Receiver, err, want)
+	}
+	// Without read_if_shift neither is reported
+	rig, client = newFakeRigctld(t, responses, false)
+	if data, _ := client.GetData(); data.Receiver != (ReceiverState{}) {
+		t.Errorf("without read_if_shift the receiver state is %+v", data.Receiver)
+	}
+	for _, cmd := range rig.sent() {
+		if cmd == "l IF" {
+			t.Error("l IF sent without read_if_shift")
+		}
+	}
+
+	values := simplexFlrig()
+	values["rig.get_modeA"], values["rig.get_modeB"] = "CW", "CW"
+	values["rig.get_bw"] = []interface{}{"500", ""}
+	values["rig.get_if_shift"] = 150
+	flrig := newFakeFlrig(t, values)
+	fc := flrig.client()
+	fc.ReadIFShift = true
+	defer fc.Close()
+	if data, err := fc.GetData(); err != nil || data.Receiver != (ReceiverState{Filter: "500 Hz", IFShift: "+150 Hz"}) {
+		t.Errorf("flrig filter and IF shift = %+v, %v; want 500 Hz, +150 Hz", data.Receiver, err)
+	}
+
+	status := NewStatus(defaultHistorySize)
+	status.SetData(RigData{FreqVFOA: 7030000, Mode: "CW", Receiver: want})
+	rec := httptest.NewRecorder()
+	status.handleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var report StatusReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || report.Receiver == nil || *report.Receiver != want {
+		t.Errorf("status = %s, %v; want the filter and IF shift", rec.Body.String(), err)
+	}
+	if body := rec.Body.String(); strings.Contains(body, `"agc"`) {
+		t.Errorf("status reports an unread AGC: %s", body)
+	}
+}
+
+func TestReadReceiverState(t *testing.T) {
+	want := ReceiverState{AGC: "slow", Preamp: "10 dB", Attenuator: "off"}
+	responses := map[string]string{
+		"f": "7074000", "m": "LSB\n2400", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA",
+		"l AGC": "3", "l PREAMP": "10", "l ATT": "0",
+	}
+
+	rig, client := newFakeRigctld(t, responses, false)
+	client.ReadReceiver = true
+	if data, err := client.GetData(); err != nil || data.Receiver != want {
+		t.Errorf("hamlib receiver state = %+v, %v; want %+v", data.Receiver, err, want)
+	}
+	// Without read_receiver_state the levels are not read at all
+	rig, client = newFakeRigctld(t, responses, false)
+	client.GetData()
+	for _, cmd := range rig.sent() {
+		if cmd == "l AGC" || cmd == "l PREAMP" || cmd == "l ATT" {
+			t.Errorf("%q sent without read_receiver_state", cmd)
+		}
+	}
+
+	values := simplexFlrig()
+	values["rig.get_agc"] = 3
+	values["rig.get_preamp"] = "10 dB"
+	flrig := newFakeFlrig(t, values)
+	fc := flrig.client()
+	fc.ReadReceiver = true
+	defer fc.Close()
+	// A rig without an attenuator is not asked again on this connection
+	for i := 0; i < 2; i++ {
+		data, err := fc.GetData()
+		if err != nil || data.Receiver != (ReceiverState{AGC: "3", Preamp: "10 dB"}) {
+			t.Errorf("flrig receiver state = %+v, %v; want AGC 3, preamp 10 dB", data.Receiver, err)
+		}
+	}
+	if n := flrig.count("rig.get_attenuator"); n != 1 {
+		t.Errorf("rig.get_attenuator called %d times, want it skipped after the fault", n)
+	}
+}
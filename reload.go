@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// runSettings are the values parsed from a profile that the polling loop works with.
+type runSettings struct {
+	interval       time.Duration
+	modeSettle     time.Duration
+	maxUpdate      time.Duration
+	clockSkew      time.Duration
+	allowedRanges  []freqRange
+	powerThreshold powerThreshold
+}
+
+// parseRunSettings parses the durations, frequency ranges and power change threshold of a
+// profile.
+func parseRunSettings(config ProfileConfig) (runSettings, error) {
+	var s runSettings
+	var err error
+	if s.interval, err = time.ParseDuration(config.Interval); err != nil {
+		return s, fmt.Errorf("invalid interval duration format: %w", err)
+	}
+	if config.ModeSettle != "" {
+		if s.modeSettle, err = time.ParseDuration(config.ModeSettle); err != nil {
+			return s, fmt.Errorf("invalid mode settle duration format: %w", err)
+		}
+	}
+	if s.allowedRanges, err = parseFreqRanges(config.FreqRanges); err != nil {
+		return s, err
+	}
+	s.maxUpdate = time.Minute
+	if config.MaxUpdateInterval != "" {
+		if s.maxUpdate, err = time.ParseDuration(config.MaxUpdateInterval); err != nil {
+			return s, fmt.Errorf("invalid max update interval format: %w", err)
+		}
+	}
+	s.clockSkew = defaultClockSkew
+	if config.ClockSkew != "" {
+		if s.clockSkew, err = time.ParseDuration(config.ClockSkew); err != nil {
+			return s, fmt.Errorf("invalid clock skew format: %w", err)
+		}
+	}
+	if s.powerThreshold, err = parsePowerThreshold(config.PowerChangeThreshold); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// updateDue reports whether current is sent: it changed meaningfully from last or, with
+// refresh, nothing was sent for max_update_interval, so that Wavelog does not show the
+// radio as offline.
+func (s runSettings) updateDue(current, last RigData, sinceLast time.Duration, refresh bool) bool {
+	return hasMeaningfulChange(current, last, s.powerThreshold) || refresh && sinceLast >= s.maxUpdate
+}
+
+// radioSettings are the profile settings used to create the radio client; a reload only
+// replaces the client when one of them changed.
+var radioSettings = []string{
+	"DataSource", "DataSources",
+	"FlrigHost", "FlrigPort", "FlrigScheme", "FlrigUser", "FlrigPassword",
+	"HamlibHost", "HamlibPort", "HamlibTimeout", "HamlibConnectTimeout", "HamlibKeepAlive",
+	"SerialPort", "Baud", "RigModel", "RigctldPath",
+	"ReadReceiverState", "ReadIFShift", "MeasuredPower", "PowerMeters", "InferSplit",
+	"VFOBSplitOnly",
+}
+
+// mqttSettings are the profile settings used to connect to the MQTT broker.
+var mqttSettings = []string{"MQTTBroker", "MQTTTopic", "MQTTUser", "MQTTPassword", "MQTTRetain"}
+
+// gpsdSettings are the profile settings used to create the gpsd client, which keeps the
+// last grid square it read.
+var gpsdSettings = []string{"Gpsd", "GpsdHost", "GpsdPort"}
+
+// logSettings are the fields that decide where log output goes.
+var logSettings = []string{"LogTarget", "LogFile", "LogMaxSize", "LogMaxFiles", "SyslogFacility", "SyslogTag"}
+
+// sameSettings reports whether a and b agree on the named ProfileConfig fields.
+func sameSettings(a, b ProfileConfig, fields []string) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for _, field := range fields {
+		if !reflect.DeepEqual(va.FieldByName(field).Interface(), vb.FieldByName(field).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// closeRadioClient releases the connections of a radio client, if it holds any.
+func closeRadioClient(client RadioClient) {
+	if closer, ok := client.(io.Closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUpdateDueForcedRefresh(t *testing.T) {
+	settings, err := parseRunSettings(ProfileConfig{Interval: "1s", MaxUpdateInterval: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := RigData{FreqVFOA: 14074000, Mode: "USB", Power: 50}
+	changed := state
+	changed.FreqVFOA = 14075000
+
+	tests := []struct {
+		name      string
+		current   RigData
+		sinceLast time.Duration
+		refresh   bool
+		want      bool
+	}{
+		{"unchanged", state, 30 * time.Second, true, false},
+		{"unchanged for max_update_interval", state, time.Minute, true, true},
+		{"unchanged for longer", state, 5 * time.Minute, true, true},
+		{"changed", changed, time.Second, true, true},
+		{"unchanged without refresh", state, 5 * time.Minute, false, false},
+		{"changed without refresh", changed, time.Second, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := settings.updateDue(tt.current, state, tt.sinceLast, tt.refresh); got != tt.want {
+				t.Errorf("updateDue after %s = %v, want %v", tt.sinceLast, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not available on Windows")
+	}
+	wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+	flrig := newFakeFlrig(t, simplexFlrig())
+	radio := flrig.client()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeProfile := func(radioName string, historySize int) {
+		t.Helper()
+		cfg := ConfigFile{DefaultProfile: "home", Profiles: map[string]ProfileConfig{"home": {
+			WavelogURL: wavelog.URL + "/index.php", WavelogKey: "key", RadioName: radioName,
+			DataSource: "flrig", FlrigHost: radio.Host, FlrigPort: radio.Port, Interval: "50ms", LogLevel: "info",
+			HistorySize: historySize,
+		}}}
+		if err := saveConfig(path, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeProfile("IC-7300", 20)
+	p := startMain(t, nil, "-config", path)
+	wavelog.waitForPayload(t, "radio IC-7300", func(r WavelogJSONRequest) bool { return r.Radio == "IC-7300" })
+
+	// The edited profile is used after SIGHUP, and the unchanged state is sent again. The
+	// history is kept, with a warning that its new size needs a restart
+	writeProfile("IC-705", 50)
+	if err := p.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	p.waitForOutput(t, "history_size changed to 50; restart WaveLogGoat")
+	p.waitForOutput(t, "Reloaded profile 'home'")
+	wavelog.waitForPayload(t, "radio IC-705", func(r WavelogJSONRequest) bool { return r.Radio == "IC-705" })
+
+	// A broken file is reported and the running configuration kept
+	os.WriteFile(path, []byte(`{"profiles": {"home": {"interval": 5}}}`), 0600)
+	p.Process.Signal(syscall.SIGHUP)
+	p.waitForOutput(t, "Failed to reload configuration, keeping the current one")
+	flrig.set("rig.get_vfo", strconv.Itoa(7074000))
+	wavelog.waitForPayload(t, "IC-705 on 40m", func(r WavelogJSONRequest) bool {
+		return r.Radio == "IC-705" && r.Frequency == 7074000
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// schemaEnums lists the valid values of the profile settings that take one of a fixed
+// set of strings.
+var schemaEnums = map[string][]string{
+	"data_source":        {"flrig", "hamlib", "serial", "auto"},
+	"data_sources":       {"flrig", "hamlib", "serial"},
+	"log_level":          {"trace", "debug", "info", "warn", "error"},
+	"ssb_sideband":       {"auto", "usb", "lsb", "off"},
+	"packet_modes":       {"data", "sideband"},
+	"send_timestamp":     {"", "rfc3339", "epoch"},
+	"flrig_scheme":       {"http", "https"},
+	"implausible_power":  {"clamp", "drop"},
+	"log_frequency_unit": {"", "hz", "khz", "mhz"},
+	"log_target":         {"", "stderr", "file", "syslog"},
+	"syslog_facility":    {"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"},
+}
+
+// schemaDescriptions describes the profile settings that have no command-line flag.
+var schemaDescriptions = map[string]string{
+	"power_meters": "flrig modes mapped to the flrig meter method read for measured_power, e.g. {\"FM\": \"rig.get_pwrmeter\"}; a bare name such as \"pwrmeter\" has \"rig.get_\" added. Other modes use rig.get_pwrmeter.",
+	"mode_map":     "Backend mode strings mapped to the mode sent to Wavelog, as \"MODE\" or \"MODE/SUBMODE\" (e.g. {\"DATA-U\": \"DATA/USB\"}); \"\" disables a built-in mapping.",
+}
+
+// jsonSchemaType returns the JSON Schema for a Go setting type.
+func jsonSchemaType(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchemaType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchemaType(t.Elem())}
+	}
+	return map[string]interface{}{}
+}
+
+// profileSchema describes ProfileConfig, taking each setting's description from the
+// usage of the flag with the same name and its default from defaults.
+func profileSchema(defaults ProfileConfig) map[string]interface{} {
+	properties := make(map[string]interface{})
+	v := reflect.ValueOf(defaults)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		property := jsonSchemaType(t.Field(i).Type)
+		if f := flag.Lookup(strings.ReplaceAll(name, "_", "-")); f != nil {
+			property["description"] = f.Usage
+		} else if description, ok := schemaDescriptions[name]; ok {
+			property["description"] = description
+		}
+		if values, ok := schemaEnums[name]; ok {
+			if items, ok := property["items"].(map[string]interface{}); ok {
+				items["enum"] = values
+			} else {
+				property["enum"] = values
+			}
+		}
+		if value := v.Field(i); !value.IsZero() {
+			property["default"] = value.Interface()
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// writeConfigSchema writes a JSON Schema of the configuration file. It must be called
+// after the flags are defined, as their usage strings describe the settings.
+func writeConfigSchema(w io.Writer, defaults ProfileConfig) error {
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "WaveLogGoat configuration",
+		"description": "Named profiles of settings; the default profile is used unless -profile selects another.",
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"default_profile": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of the profile used when -profile is not given.",
+			},
+			"profiles": map[string]interface{}{
+				"type":                 "object",
+				"description":          "Profiles by name.",
+				"additionalProperties": map[string]interface{}{"$ref": "#/$defs/profile"},
+			},
+		},
+		"$defs": map[string]interface{}{
+			"profile": profileSchema(defaults),
+		},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SDNotifier sends readiness and watchdog notifications to systemd when run as a
+// Type=notify service. Without NOTIFY_SOCKET in the environment all methods are no-ops.
+type SDNotifier struct {
+	socket   string
+	watchdog time.Duration // keepalive interval requested by systemd, 0 if none
+	ready    bool
+	lastPing time.Time
+}
+
+func NewSDNotifier() *SDNotifier {
+	n := &SDNotifier{socket: os.Getenv("NOTIFY_SOCKET")}
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		// Ping at half the timeout, as recommended by sd_watchdog_enabled(3)
+		n.watchdog = time.Duration(usec) * time.Microsecond / 2
+	}
+	return n
+}
+
+// notify sends a single state string such as "READY=1" to the notify socket.
+func (n *SDNotifier) notify(state string) {
+	if n.socket == "" {
+		return
+	}
+	addr := n.socket
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:] // abstract namespace socket
+	}
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		log.Debugf("Failed to connect to systemd notify socket %s: %v", n.socket, err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Debugf("Failed to send %s to systemd: %v", state, err)
+	}
+}
+
+// PollSucceeded reports readiness after the first successful radio read, and sends a
+// watchdog keepalive when one is due.
+func (n *SDNotifier) PollSucceeded() {
+	if !n.ready {
+		n.ready = true
+		n.notify("READY=1")
+	}
+	if n.watchdog > 0 && time.Since(n.lastPing) >= n.watchdog {
+		n.lastPing = time.Now()
+		n.notify("WATCHDOG=1")
+	}
+}
+
+// Stopping tells systemd that a clean shutdown has begun.
+func (n *SDNotifier) Stopping() {
+	n.notify("STOPPING=1")
+}
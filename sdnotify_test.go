@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// listenNotify stands in for systemd's notify socket and returns the messages it receives.
+func listenNotify(t *testing.T) <-chan string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("systemd notify sockets are unix datagram sockets")
+	}
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	messages := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			messages <- string(buf[:n])
+		}
+	}()
+	return messages
+}
+
+func expectNotify(t *testing.T, messages <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-messages:
+		if got != want {
+			t.Errorf("notify message %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("no %q notification", want)
+	}
+}
+
+func TestSDNotifier(t *testing.T) {
+	messages := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "200000")
+
+	n := NewSDNotifier()
+	if n.watchdog != 100*time.Millisecond {
+		t.Errorf("watchdog interval = %s, want half of WATCHDOG_USEC", n.watchdog)
+	}
+	n.PollSucceeded()
+	expectNotify(t, messages, "READY=1")
+	expectNotify(t, messages, "WATCHDOG=1")
+
+	// Readiness is only sent once, and keepalives no more often than the interval
+	n.PollSucceeded()
+	time.Sleep(150 * time.Millisecond)
+	n.PollSucceeded()
+	expectNotify(t, messages, "WATCHDOG=1")
+	n.Stopping()
+	expectNotify(t, messages, "STOPPING=1")
+}
+
+func TestSDNotifierWithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	t.Setenv("WATCHDOG_USEC", "")
+	n := NewSDNotifier()
+	// Without a socket nothing is sent, and nothing fails
+	n.PollSucceeded()
+	n.Stopping()
+	if n.watchdog != 0 {
+		t.Errorf("watchdog interval = %s without WATCHDOG_USEC, want 0", n.watchdog)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// serialRestartDelay is how long to wait before restarting a rigctld that has exited,
+// so that a missing or busy serial port does not respawn it on every poll.
+const serialRestartDelay = 10 * time.Second
+
+// SerialClient implements RadioClient for a rig attached directly to a serial port. It
+// runs its own rigctld on the port, listening only on the loopback interface, and reads
+// the rig through it exactly like the hamlib data source.
+type SerialClient struct {
+	Port     string // serial device, e.g. /dev/ttyUSB0 or COM3
+	Baud     int    // 0 for the rig's default speed
+	RigModel int    // hamlib rig model number, as listed by rigctl -l
+	Rigctld  string // rigctld executable
+
+	hamlib    *HamlibClient
+	cmd       *exec.Cmd
+	exited    chan struct{}
+	restartAt time.Time
+	mu        sync.Mutex
+}
+
+// freeLoopbackPort asks the system for a currently unused TCP port on 127.0.0.1.
+func freeLoopbackPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// start launches rigctld on the serial port unless it is already running.
+func (s *SerialClient) start() error {
+	if s.cmd != nil {
+		select {
+		case <-s.exited:
+			log.Warnf("rigctld for %s exited: %v", s.Port, s.cmd.ProcessState)
+			s.cmd = nil
+			s.hamlib.Close()
+			s.restartAt = time.Now().Add(serialRestartDelay)
+		default:
+			return nil
+		}
+	}
+	if time.Now().Before(s.restartAt) {
+		return errReconnectBackoff
+	}
+
+	port, err := freeLoopbackPort()
+	if err != nil {
+		return fmt.Errorf("failed to find a free port for rigctld: %w", err)
+	}
+	args := []string{"-m", strconv.Itoa(s.RigModel), "-r", s.Port, "-T", "127.0.0.1", "-t", strconv.Itoa(port)}
+	if s.Baud > 0 {
+		args = append(args, "-s", strconv.Itoa(s.Baud))
+	}
+	cmd := exec.Command(s.Rigctld, args...)
+	// rigctld reports problems with the serial port on stderr
+	stderr := log.WriterLevel(logrus.DebugLevel)
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		stderr.Close()
+		s.restartAt = time.Now().Add(serialRestartDelay)
+		return fmt.Errorf("failed to start %s: %w", s.Rigctld, err)
+	}
+	log.Infof("Started rigctld (model %d) on %s, listening on 127.0.0.1:%d", s.RigModel, s.Port, port)
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		stderr.Close()
+		close(exited)
+	}()
+	s.cmd, s.exited = cmd, exited
+	s.hamlib.Host, s.hamlib.Port = "127.0.0.1", port
+	return nil
+}
+
+func (s *SerialClient) GetData() (RigData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.start(); err != nil {
+		return RigData{}, err
+	}
+	// Until rigctld has opened the port the connection is refused, which is transient
+	return s.hamlib.GetData()
+}
+
+// GetRadioModel asks the private rigctld for the rig model name.
+func (s *SerialClient) GetRadioModel() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.start(); err != nil {
+		return "", err
+	}
+	return s.hamlib.GetRadioModel()
+}
+
+// Close disconnects from rigctld and stops it.
+func (s *SerialClient) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hamlib.Close()
+	if s.cmd == nil {
+		return nil
+	}
+	err := s.cmd.Process.Kill()
+	<-s.exited
+	s.cmd = nil
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
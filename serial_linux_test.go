@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openPty returns the master side of a new pseudo-terminal in raw mode and the path of
+// its slave side, which stands in for a rig's serial port.
+func openPty(t *testing.T) (*os.File, string) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		t.Fatalf("unlocking the pty: %v", err)
+	}
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		t.Fatalf("reading the pty number: %v", err)
+	}
+	path := fmt.Sprintf("/dev/pts/%d", n)
+
+	// A serial port does not echo or wait for line ends, so the slave side is made raw
+	slave, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { slave.Close() })
+	var tio syscall.Termios
+	if err := ioctl(slave.Fd(), syscall.TCGETS, unsafe.Pointer(&tio)); err != nil {
+		t.Fatal(err)
+	}
+	tio.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	tio.Oflag &^= syscall.OPOST
+	tio.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	tio.Cflag = tio.Cflag&^(syscall.CSIZE|syscall.PARENB) | syscall.CS8
+	tio.Cc[syscall.VMIN], tio.Cc[syscall.VTIME] = 1, 0
+	if err := ioctl(slave.Fd(), syscall.TCSETS, unsafe.Pointer(&tio)); err != nil {
+		t.Fatal(err)
+	}
+	return master, path
+}
+
+// kenwoodRig answers the Kenwood CAT read commands FA, MD and PC on a serial port.
+type kenwoodRig struct {
+	mu    sync.Mutex
+	state map[string]string // command to its answer, without the ';'
+}
+
+func (k *kenwoodRig) set(cmd, answer string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.state[cmd] = answer
+}
+
+func (k *kenwoodRig) serve(port *os.File) {
+	reader := bufio.NewReader(port)
+	for {
+		cmd, err := reader.ReadString(';')
+		if err != nil {
+			return
+		}
+		k.mu.Lock()
+		answer, ok := k.state[strings.TrimSuffix(cmd, ";")]
+		k.mu.Unlock()
+		if !ok {
+			answer = "?"
+		}
+		if _, err := port.WriteString(answer + ";"); err != nil {
+			return
+		}
+	}
+}
+
+// TestSerialRigctldHelper is not a test: run by the script standing in for rigctld, it
+// translates the rigctld commands that the hamlib data source sends into Kenwood CAT
+// commands on the serial port given with -r, as rigctld would for such a rig.
+func TestSerialRigctldHelper(t *testing.T) {
+	argsFile := os.Getenv("WAVELOGGOAT_FAKE_RIGCTLD")
+	if argsFile == "" {
+		return
+	}
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	os.WriteFile(argsFile, []byte(strings.Join(args, " ")), 0600)
+	var device, port string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-r":
+			device = args[i+1]
+		case "-t":
+			port = args[i+1]
+		}
+	}
+	serial, err := os.OpenFile(device, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cat := bufio.NewReader(serial)
+	query := func(cmd string) string {
+		serial.WriteString(cmd + ";")
+		answer, _ := cat.ReadString(';')
+		return strings.TrimPrefix(strings.TrimSuffix(answer, ";"), cmd)
+	}
+	modes := map[string]string{"1": "LSB", "2": "USB", "3": "CW", "4": "FM", "5": "AM", "6": "RTTY"}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			os.Exit(0)
+		}
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var resp string
+			switch scanner.Text() {
+			case "f":
+				freq, _ := strconv.Atoi(query("FA"))
+				resp = strconv.Itoa(freq)
+			case "m":
+				resp = modes[query("MD")] + "\n0"
+			case "l RFPOWER":
+				watts, _ := strconv.Atoi(query("PC"))
+				resp = strconv.FormatFloat(float64(watts)/100, 'f', 6, 64)
+			case "t":
+				resp = "0"
+			default:
+				resp = "RPRT -11"
+			}
+			fmt.Fprintf(conn, "%s\n", resp)
+		}
+		conn.Close()
+	}
+}
+
+func TestSerialClientThroughPty(t *testing.T) {
+	master, device := openPty(t)
+	rig := &kenwoodRig{state: map[string]string{"FA": "FA00014074000", "MD": "MD2", "PC": "PC050"}}
+	go rig.serve(master)
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "rigctld")
+	if err := os.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\nexec '%s' -test.run='^TestSerialRigctldHelper$' -- \"$@\"\n", exe)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	argsFile := filepath.Join(dir, "args")
+	t.Setenv("WAVELOGGOAT_FAKE_RIGCTLD", argsFile)
+
+	radio, err := newRadioClient(ProfileConfig{DataSource: "serial", SerialPort: device, Baud: 9600, RigModel: 2028, RigctldPath: script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := radio.(*SerialClient)
+	defer client.Close()
+
+	// rigctld refuses connections until it has opened the port
+	var data RigData
+	deadline := time.Now().Add(5 * time.Second)
+	for data, err = client.GetData(); err != nil && time.Now().Before(deadline); data, err = client.GetData() {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GetData through the pty: %v", err)
+	}
+	if data.FreqVFOA != 14074000 || data.Mode != "USB" || data.Power != 50 {
+		t.Errorf("GetData = %+v, want 14074000 USB 50 W", data)
+	}
+
+	args, _ := os.ReadFile(argsFile)
+	for _, want := range []string{"-m 2028", "-r " + device, "-T 127.0.0.1", "-s 9600"} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("rigctld started with %q, want %q", args, want)
+		}
+	}
+
+	// Retuning the rig is seen on the next poll
+	rig.set("FA", "FA00007030000")
+	rig.set("MD", "MD3")
+	if data, err := client.GetData(); err != nil || data.FreqVFOA != 7030000 || data.Mode != "CW" {
+		t.Errorf("after retuning GetData = %+v, %v; want 7030000 CW", data, err)
+	}
+
+	// Closing the data source stops its rigctld
+	exited := client.exited
+	if err := client.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	select {
+	case <-exited:
+	default:
+		t.Error("rigctld still running after Close")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// serviceContext returns ctx unchanged; Windows services are not available on this platform.
+func serviceContext(ctx context.Context) (context.Context, func()) {
+	return ctx, func() {}
+}
+
+// handleServiceCommand reports that Windows services are not available on this platform.
+func handleServiceCommand(command string, args []string) error {
+	return fmt.Errorf("running as a service is only supported on Windows; use your platform's service manager (e.g. systemd)")
+}
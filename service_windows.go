@@ -0,0 +1,123 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "WaveLogGoat"
+
+// serviceHandler implements svc.Handler, cancelling the polling loop when Windows
+// asks the service to stop.
+type serviceHandler struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case c := <-requests:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				h.cancel()
+				<-h.done
+				return false, 0
+			}
+		case <-h.done:
+			return false, 0
+		}
+	}
+}
+
+// serviceContext returns a context that is cancelled when the Windows service manager
+// stops the service, and a function to call once the polling loop has finished. When
+// not running as a service, ctx is returned unchanged.
+func serviceContext(ctx context.Context) (context.Context, func()) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	handler := &serviceHandler{cancel: cancel, done: make(chan struct{})}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		if err := svc.Run(serviceName, handler); err != nil {
+			log.Errorf("Windows service failed: %v", err)
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		close(handler.done)
+		<-finished
+	}
+}
+
+// handleServiceCommand installs, uninstalls, starts or stops the Windows service. The
+// installed service is run with args.
+func handleServiceCommand(command string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if command == "install" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: "WaveLogGoat",
+			Description: "Sends radio status from flrig or hamlib to Wavelog.",
+			StartType:   mgr.StartAutomatic,
+		}, args...)
+		if err != nil {
+			return fmt.Errorf("failed to create service: %w", err)
+		}
+		s.Close()
+		return nil
+	}
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	switch command {
+	case "uninstall":
+		return s.Delete()
+	case "start":
+		return s.Start()
+	case "stop":
+		status, err := s.Control(svc.Stop)
+		if err != nil {
+			return err
+		}
+		for deadline := time.Now().Add(10 * time.Second); status.State != svc.Stopped; {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for service to stop")
+			}
+			time.Sleep(300 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown service command '%s'. Must be 'install', 'uninstall', 'start' or 'stop'", command)
+}
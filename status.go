@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status tracks the state reported by the status server. It is updated by the main loop.
+type Status struct {
+	mu            sync.Mutex
+	started       time.Time
+	lastSuccess   time.Time
+	lastRead      time.Time
+	lastError     string
+	lastErrorTime time.Time
+	data          RigData
+	duty          *DutyCycle
+	history       *History
+}
+
+// defaultHistorySize is how many updates /history keeps when history_size is not set.
+const defaultHistorySize = 20
+
+// HistoryEntry is one update sent to Wavelog, as listed at /history.
+type HistoryEntry struct {
+	Time    time.Time          `json:"time"`
+	Payload WavelogJSONRequest `json:"payload"`
+}
+
+// History is a fixed-size ring buffer of the most recent updates sent to Wavelog.
+type History struct {
+	mu          sync.Mutex
+	entries     []HistoryEntry
+	next        int  // index the next entry is written to
+	full        bool // the buffer has wrapped
+	subscribers map[chan HistoryEntry]struct{}
+}
+
+// NewHistory creates a History holding up to size entries.
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	return &History{entries: make([]HistoryEntry, size)}
+}
+
+// Add records an update, overwriting the oldest one once the buffer is full. The API
+// key is never kept.
+func (h *History) Add(t time.Time, payload WavelogJSONRequest) {
+	payload.Key = ""
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries[h.next] = HistoryEntry{Time: t, Payload: payload}
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+	for ch := range h.subscribers {
+		// A follower that cannot keep up misses updates rather than stalling the poll loop
+		select {
+		case ch <- HistoryEntry{Time: t, Payload: payload}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving each update added from now on, and a function
+// that ends the subscription.
+func (h *History) Subscribe() (<-chan HistoryEntry, func()) {
+	ch := make(chan HistoryEntry, 16)
+	h.mu.Lock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan HistoryEntry]struct{})
+	}
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Entries returns the recorded updates, oldest first.
+func (h *History) Entries() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]HistoryEntry{}, h.entries[:h.next]...)
+	}
+	return append(append([]HistoryEntry{}, h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+// DutyCycle accumulates time spent transmitting and receiving from successive PTT polls.
+type DutyCycle struct {
+	mu       sync.Mutex
+	tx       time.Duration
+	rx       time.Duration
+	lastPTT  bool
+	lastSeen time.Time
+}
+
+// Observe records the PTT state seen at time now. The time since the previous
+// observation is attributed to the PTT state seen then.
+func (d *DutyCycle) Observe(ptt bool, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.lastSeen.IsZero() {
+		elapsed := now.Sub(d.lastSeen)
+		if d.lastPTT {
+			d.tx += elapsed
+		} else {
+			d.rx += elapsed
+		}
+	}
+	d.lastPTT = ptt
+	d.lastSeen = now
+}
+
+// Gap discards the time since the last observation, e.g. after a failed poll
+// when the PTT state is unknown.
+func (d *DutyCycle) Gap() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastSeen = time.Time{}
+}
+
+// Totals returns the accumulated transmit and receive durations.
+func (d *DutyCycle) Totals() (tx, rx time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tx, d.rx
+}
+
+// StatusReport is the JSON document served at /status.
+type StatusReport struct {
+	LastSuccess   *time.Time     `json:"last_success,omitempty"`
+	LastError     string         `json:"last_error,omitempty"`
+	LastErrorTime *time.Time     `json:"last_error_time,omitempty"`
+	Frequency     int            `json:"frequency"`
+	Mode          string         `json:"mode"`
+	Power         float64        `json:"power"`
+	PTT           bool           `json:"ptt"`
+	SWR           float64        `json:"swr,omitempty"`
+	Memory        string         `json:"memory,omitempty"`
+	Receiver      *ReceiverState `json:"receiver,omitempty"`
+	TXSeconds     float64        `json:"tx_seconds"`
+	RXSeconds     float64        `json:"rx_seconds"`
+	Uptime        string         `json:"uptime"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+}
+
+// NewStatus creates a Status that remembers the last historySize updates.
+func NewStatus(historySize int) *Status {
+	return &Status{started: time.Now(), duty: &DutyCycle{}, history: NewHistory(historySize)}
+}
+
+// History returns the recent updates reported at /history.
+func (s *Status) History() *History {
+	return s.history
+}
+
+// DutyCycle returns the transmit/receive time accounting reported with the status.
+func (s *Status) DutyCycle() *DutyCycle {
+	return s.duty
+}
+
+// SetData records the most recently read radio state.
+func (s *Status) SetData(data RigData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	s.lastRead = time.Now()
+}
+
+// Healthy reports whether the radio was read successfully within window before now.
+func (s *Status) Healthy(window time.Duration, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.lastRead.IsZero() && now.Sub(s.lastRead) <= window
+}
+
+// Data returns the most recently read radio state.
+func (s *Status) Data() RigData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data
+}
+
+// SetSuccess records a successful Wavelog update.
+func (s *Status) SetSuccess() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSuccess = time.Now()
+}
+
+// SetError records the most recent error from reading the radio or posting to Wavelog.
+func (s *Status) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now()
+}
+
+// Report returns a snapshot of the current status.
+func (s *Status) Report() StatusReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uptime := time.Since(s.started)
+	report := StatusReport{
+		LastError:     s.lastError,
+		Frequency:     freqHz(s.data.FreqVFOA),
+		Mode:          s.data.Mode,
+		Power:         s.data.Power,
+		PTT:           s.data.PTT,
+		SWR:           s.data.SWR,
+		Memory:        s.data.Memory,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+	}
+	if s.data.Receiver != (ReceiverState{}) {
+		receiver := s.data.Receiver
+		report.Receiver = &receiver
+	}
+	tx, rx := s.duty.Totals()
+	report.TXSeconds = tx.Seconds()
+	report.RXSeconds = rx.Seconds()
+	if !s.lastSuccess.IsZero() {
+		t := s.lastSuccess
+		report.LastSuccess = &t
+	}
+	if !s.lastErrorTime.IsZero() {
+		t := s.lastErrorTime
+		report.LastErrorTime = &t
+	}
+	return report
+}
+
+func (s *Status) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Report()); err != nil {
+		log.Warnf("Failed to write status response: %v", err)
+	}
+}
+
+func (s *Status) handleHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.history.Entries()); err != nil {
+		log.Warnf("Failed to write history response: %v", err)
+	}
+}
+
+// handleUpdates streams each update sent to Wavelog as a line of JSON (a HistoryEntry)
+// until the client disconnects, for -attach.
+func (s *Status) handleUpdates(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	updates, cancel := s.history.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case entry := <-updates:
+			if err := enc.Encode(entry); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// healthHandler answers liveness probes: 200 when the radio was read within window,
+// 503 otherwise.
+func (s *Status) healthHandler(window time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !s.Healthy(window, time.Now()) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "stale: no successful radio read")
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// startStatusServer serves the status endpoints on addr in the background. /healthz
+// reports unhealthy when no radio read succeeded within healthWindow.
+func startStatusServer(addr string, status *Status, healthWindow time.Duration) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", status.handleStatus)
+	mux.HandleFunc("/healthz", status.healthHandler(healthWindow))
+	mux.HandleFunc("/history", status.handleHistory)
+	mux.HandleFunc("/updates", status.handleUpdates)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Status server on %s failed: %v", addr, err)
+		}
+	}()
+	log.Infof("Serving status on http://%s/status", addr)
+}
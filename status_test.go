@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDutyCycle(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		at  time.Duration // since start
+		ptt bool
+		gap bool // a failed poll before this observation
+	}{
+		{at: 0, ptt: false},
+		{at: 2 * time.Second, ptt: true},  // 2s RX
+		{at: 3 * time.Second, ptt: true},  // 1s TX
+		{at: 5 * time.Second, ptt: false}, // 2s TX
+		{at: 6 * time.Second, ptt: false}, // 1s RX
+		{at: 20 * time.Second, ptt: true, gap: true},
+		{at: 21 * time.Second, ptt: false}, // 1s TX
+	}
+
+	var d DutyCycle
+	for _, s := range steps {
+		if s.gap {
+			d.Gap()
+		}
+		d.Observe(s.ptt, start.Add(s.at))
+	}
+	tx, rx := d.Totals()
+	if tx != 4*time.Second || rx != 3*time.Second {
+		t.Errorf("Totals() = %s TX, %s RX; want 4s TX, 3s RX with the 14s gap discarded", tx, rx)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	status := NewStatus(defaultHistorySize)
+	handler := status.healthHandler(time.Minute)
+	probe := func() int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	if code := probe(); code != http.StatusServiceUnavailable {
+		t.Errorf("before the first read /healthz = %d, want 503", code)
+	}
+	status.SetData(RigData{FreqVFOA: 14074000})
+	if code := probe(); code != http.StatusOK {
+		t.Errorf("after a read /healthz = %d, want 200", code)
+	}
+
+	// The last read falls out of the window
+	status.mu.Lock()
+	status.lastRead = time.Now().Add(-2 * time.Minute)
+	status.mu.Unlock()
+	if code := probe(); code != http.StatusServiceUnavailable {
+		t.Errorf("with a stale read /healthz = %d, want 503", code)
+	}
+	if !status.Healthy(time.Minute, time.Now().Add(-90*time.Second)) {
+		t.Error("Healthy() is false at a time within the window of the last read")
+	}
+}
+
+func TestStatusMemoryChannel(t *testing.T) {
+	status := NewStatus(defaultHistorySize)
+	get := func() string {
+		rec := httptest.NewRecorder()
+		status.handleStatus(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		return rec.Body.String()
+	}
+
+	status.SetData(RigData{FreqVFOA: 145500000, Mode: "FM", Memory: "12"})
+	var report StatusReport
+	if err := json.Unmarshal([]byte(get()), &report); err != nil || report.Memory != "12" {
+		t.Errorf("status in memory mode = %+v, %v; want memory 12", report, err)
+	}
+	status.SetData(RigData{FreqVFOA: 145500000, Mode: "FM"})
+	if body := get(); strings.Contains(body, `"memory"`) {
+		t.Errorf("status on a VFO includes the memory channel: %s", body)
+	}
+}
+
+func TestHistoryWraps(t *testing.T) {
+	status := NewStatus(3)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	freqs := []int{14074000, 14075000, 14076000, 14077000, 14078000}
+	for i, f := range freqs[:2] {
+		status.History().Add(start.Add(time.Duration(i)*time.Second), WavelogJSONRequest{Key: "secret", Radio: "IC-7300", Frequency: f, Mode: "USB"})
+	}
+	if got := status.History().Entries(); len(got) != 2 || got[0].Payload.Frequency != freqs[0] {
+		t.Fatalf("before wrapping Entries() = %+v, want the first two updates", got)
+	}
+	for i, f := range freqs[2:] {
+		status.History().Add(start.Add(time.Duration(i+2)*time.Second), WavelogJSONRequest{Key: "secret", Radio: "IC-7300", Frequency: f, Mode: "USB"})
+	}
+
+	rec := httptest.NewRecorder()
+	status.handleHistory(rec, httptest.NewRequest(http.MethodGet, "/history", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("/history Content-Type %q, want application/json", ct)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("/history reveals the API key: %s", rec.Body.String())
+	}
+	var entries []HistoryEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("/history is not a JSON list: %v (%s)", err, rec.Body.String())
+	}
+	// Only the last three remain, oldest first
+	if len(entries) != 3 {
+		t.Fatalf("/history has %d entries, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if want := freqs[i+2]; e.Payload.Frequency != want || !e.Time.Equal(start.Add(time.Duration(i+2)*time.Second)) {
+			t.Errorf("entry %d = %+v, want %d at %s", i, e, want, start.Add(time.Duration(i+2)*time.Second))
+		}
+	}
+
+	if got := NewHistory(0); len(got.entries) != defaultHistorySize {
+		t.Errorf("NewHistory(0) holds %d entries, want %d", len(got.entries), defaultHistorySize)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"strings"
+
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// syslogFacilities maps the facility names accepted in syslog_facility to their values.
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// setupSyslog sends log output to the syslog daemon at network and addr, empty for the
+// local one, with the given facility and tag instead of stderr. An empty facility or tag,
+// as in profiles saved without them, uses defaultSyslogFacility or defaultSyslogTag.
+func setupSyslog(network, addr, facility, tag string) error {
+	if strings.TrimSpace(facility) == "" {
+		facility = defaultSyslogFacility
+	}
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+	priority, ok := syslogFacilities[strings.ToLower(strings.TrimSpace(facility))]
+	if !ok {
+		return fmt.Errorf("unknown syslog facility '%s'", facility)
+	}
+	hook, err := lsyslog.NewSyslogHook(network, addr, priority|syslog.LOG_INFO, tag)
+	if err != nil {
+		return err
+	}
+	log.AddHook(hook)
+	log.SetOutput(io.Discard)
+	log.Infof("Logging to syslog (facility %s, tag %s)", facility, tag)
+	return nil
+}
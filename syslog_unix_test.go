@@ -0,0 +1,128 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// listenSyslog stands in for the syslog daemon and returns its address and the messages it
+// receives.
+func listenSyslog(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "log")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		log.ReplaceHooks(make(logrus.LevelHooks))
+		log.SetOutput(io.Discard)
+	})
+	messages := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			messages <- string(buf[:n])
+		}
+	}()
+	return path, messages
+}
+
+// expectSyslog waits for a message containing text and returns it.
+func expectSyslog(t *testing.T, messages <-chan string, text string) string {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if strings.Contains(msg, text) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("no syslog message with %q", text)
+		}
+	}
+}
+
+func TestSetupSyslog(t *testing.T) {
+	tests := []struct {
+		name             string
+		facility, tag    string
+		priority, prefix string
+	}{
+		// <14> is facility user (1) with severity info (6); <30> is daemon (3) with info
+		{"defaults for an old profile", "", "", "<14>", "waveloggoat["},
+		{"configured", "Daemon", "shack-radio", "<30>", "shack-radio["},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, messages := listenSyslog(t)
+			log.SetOutput(os.Stderr)
+			if err := setupSyslog("unixgram", addr, tt.facility, tt.tag); err != nil {
+				t.Fatal(err)
+			}
+			hooks := log.Hooks[logrus.InfoLevel]
+			if len(hooks) != 1 {
+				t.Fatalf("%d hooks installed for info, want the syslog hook", len(hooks))
+			}
+			if _, ok := hooks[0].(*lsyslog.SyslogHook); !ok {
+				t.Errorf("hook installed is a %T, want *syslog.SyslogHook", hooks[0])
+			}
+			if log.Out != io.Discard {
+				t.Error("log output still goes to stderr as well")
+			}
+			log.Info("radio connected")
+			msg := expectSyslog(t, messages, "radio connected")
+			if !strings.HasPrefix(msg, tt.priority) || !strings.Contains(msg, tt.prefix) {
+				t.Errorf("syslog message %q, want priority %s and tag %s", msg, tt.priority, tt.prefix)
+			}
+		})
+	}
+}
+
+func TestSetupSyslogUnavailable(t *testing.T) {
+	if err := setupSyslog("unixgram", filepath.Join(t.TempDir(), "missing"), "", ""); err == nil {
+		t.Error("setupSyslog succeeded without a syslog daemon")
+	}
+	if err := setupSyslog("", "", "nosuch", ""); err == nil {
+		t.Error("setupSyslog accepted an unknown facility")
+	}
+	if len(log.Hooks[logrus.InfoLevel]) != 0 {
+		t.Errorf("%d hooks installed after the failures, want none", len(log.Hooks[logrus.InfoLevel]))
+	}
+}
+
+func TestSetupLogOutputSyslogFallback(t *testing.T) {
+	t.Cleanup(func() { log.SetOutput(io.Discard) })
+	stderr, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+	oldStderr := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = oldStderr }()
+
+	setupLogOutput(ProfileConfig{LogTarget: "syslog", SyslogFacility: "nosuch"})
+	if len(log.Hooks[logrus.InfoLevel]) != 0 || log.Out != stderr {
+		t.Errorf("when syslog cannot be used: %d hooks, output %v; want stderr", len(log.Hooks[logrus.InfoLevel]), log.Out)
+	}
+	if out, _ := os.ReadFile(stderr.Name()); !strings.Contains(string(out), "Cannot log to syslog, logging to stderr instead") {
+		t.Errorf("no warning about the fallback on stderr: %q", out)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "errors"
+
+// setupSyslog reports that syslog is not available on Windows.
+func setupSyslog(network, addr, facility, tag string) error {
+	return errors.New("syslog is not available on Windows; use log_file instead")
+}
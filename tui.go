@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ANSI escape sequences used by the TUI. Supported by Linux/macOS terminals and Windows Terminal.
+const (
+	ansiAltScreenOn  = "\x1b[?1049h"
+	ansiAltScreenOff = "\x1b[?1049l"
+	ansiCursorHide   = "\x1b[?25l"
+	ansiCursorShow   = "\x1b[?25h"
+	ansiHome         = "\x1b[H"
+	ansiClearScreen  = "\x1b[2J"
+	ansiBold         = "\x1b[1m"
+	ansiRed          = "\x1b[31m"
+	ansiGreen        = "\x1b[32m"
+	ansiReset        = "\x1b[0m"
+)
+
+// tuiLogLines is the number of recent log lines shown in the log pane.
+const tuiLogLines = 8
+
+// TUI renders a full-screen live view of the radio state, with log output routed to a pane.
+type TUI struct {
+	out     io.Writer
+	profile string
+	source  string
+
+	logOut io.Writer // log output to restore on Stop
+
+	mu   sync.Mutex
+	logs []string
+}
+
+func NewTUI(out io.Writer, profile, source string) *TUI {
+	return &TUI{out: out, profile: profile, source: source}
+}
+
+// Write implements io.Writer so that the TUI can be used as the log output.
+func (t *TUI) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.logs = append(t.logs, line)
+	}
+	if len(t.logs) > tuiLogLines {
+		t.logs = t.logs[len(t.logs)-tuiLogLines:]
+	}
+	return len(p), nil
+}
+
+// Start switches to the alternate screen and captures log output.
+func (t *TUI) Start() {
+	fmt.Fprint(t.out, ansiAltScreenOn+ansiCursorHide+ansiClearScreen)
+	t.logOut = log.Out
+	log.SetOutput(t)
+}
+
+// Stop restores the terminal and the previous log output.
+func (t *TUI) Stop() {
+	log.SetOutput(t.logOut)
+	fmt.Fprint(t.out, ansiCursorShow+ansiAltScreenOff)
+}
+
+// Render redraws the screen from the current status and the result of the last poll.
+func (t *TUI) Render(status *Status, pollErr error) {
+	report := status.Report()
+	data := status.Data()
+
+	var b bytes.Buffer
+	b.WriteString(ansiHome + ansiClearScreen)
+	fmt.Fprintf(&b, "%sWaveLogGoat %s%s  profile: %s  source: %s\r\n\r\n", ansiBold, version, ansiReset, t.profile, t.source)
+
+	if pollErr != nil {
+		fmt.Fprintf(&b, "  Radio:       %sERROR%s %v\r\n", ansiRed, ansiReset, pollErr)
+	} else {
+		fmt.Fprintf(&b, "  Radio:       %sconnected%s\r\n", ansiGreen, ansiReset)
+	}
+	fmt.Fprintf(&b, "  Frequency:   %.6f MHz  %s\r\n", data.FreqVFOA/1e6, bandForFrequency(data.FreqVFOA))
+	fmt.Fprintf(&b, "  Mode:        %s\r\n", data.Mode)
+	if data.Memory != "" {
+		fmt.Fprintf(&b, "  Memory:      channel %s\r\n", data.Memory)
+	}
+	if r := data.Receiver; r.hasFrontEnd() {
+		fmt.Fprintf(&b, "  Receiver:    AGC %s, preamp %s, att %s\r\n", orUnknown(r.AGC), orUnknown(r.Preamp), orUnknown(r.Attenuator))
+	}
+	if r := data.Receiver; r.Filter != "" || r.IFShift != "" {
+		fmt.Fprintf(&b, "  Filter:      %s, IF shift %s\r\n", orUnknown(r.Filter), orUnknown(r.IFShift))
+	}
+	if data.PTT {
+		fmt.Fprintf(&b, "  Power:       %g W  %sTX%s\r\n", data.Power, ansiRed, ansiReset)
+	} else {
+		fmt.Fprintf(&b, "  Power:       %g W  RX\r\n", data.Power)
+	}
+	if data.Split != 0 {
+		fmt.Fprintf(&b, "  Split:       on, TX %.6f MHz %s\r\n", data.FreqVFOB/1e6, data.ModeB)
+	} else {
+		b.WriteString("  Split:       off\r\n")
+	}
+	if report.LastSuccess != nil {
+		fmt.Fprintf(&b, "  Last update: %s (%s ago)\r\n", report.LastSuccess.Format(time.TimeOnly), time.Since(*report.LastSuccess).Round(time.Second))
+	} else {
+		b.WriteString("  Last update: never\r\n")
+	}
+	if report.LastError != "" {
+		fmt.Fprintf(&b, "  Last error:  %s %s\r\n", report.LastErrorTime.Format(time.TimeOnly), report.LastError)
+	}
+	fmt.Fprintf(&b, "  TX/RX time:  %s / %s\r\n", time.Duration(report.TXSeconds*float64(time.Second)).Round(time.Second), time.Duration(report.RXSeconds*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(&b, "  Uptime:      %s\r\n\r\n", report.Uptime)
+
+	b.WriteString(ansiBold + "Log" + ansiReset + "  (Ctrl-C to quit)\r\n")
+	t.mu.Lock()
+	for _, line := range t.logs {
+		b.WriteString("  " + line + "\r\n")
+	}
+	t.mu.Unlock()
+
+	t.out.Write(b.Bytes())
+}
+
+// orUnknown returns s, or "?" when it is empty.
+func orUnknown(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return s
+}
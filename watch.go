@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// WatchEvent is the state change written as one JSON line per change by -watch.
+type WatchEvent struct {
+	Time        time.Time   `json:"time"`
+	Radio       string      `json:"radio"`
+	Frequency   int         `json:"frequency"`
+	FrequencyRX int         `json:"frequency_rx"`
+	Mode        string      `json:"mode"`
+	ModeRX      string      `json:"mode_rx"`
+	Band        string      `json:"band"`
+	Power       interface{} `json:"power,omitempty"`
+	Split       bool        `json:"split"`
+	PTT         bool        `json:"ptt"`
+	Memory      string      `json:"memory,omitempty"`
+}
+
+// newWatchEvent describes a radio state for -watch, using the same frequencies and mode
+// translation as the Wavelog payload.
+func newWatchEvent(config ProfileConfig, data RigData) WatchEvent {
+	payload := buildPayload(config, data)
+	event := WatchEvent{
+		Time:        data.ReadAt,
+		Radio:       payload.Radio,
+		Frequency:   payload.Frequency,
+		FrequencyRX: payload.FrequencyRX,
+		Mode:        payload.Mode,
+		ModeRX:      payload.ModeRX,
+		Band:        bandForFrequency(float64(payload.Frequency)),
+		Power:       payload.Power,
+		Split:       data.Split != 0,
+		PTT:         data.PTT,
+		Memory:      data.Memory,
+	}
+	// The payload omits the RX side when it equals TX; a stream consumer wants it anyway
+	if event.FrequencyRX == 0 {
+		event.FrequencyRX = event.Frequency
+	}
+	if event.ModeRX == "" {
+		event.ModeRX = event.Mode
+	}
+	return event
+}
+
+// writeWatchEvent writes the state as a single line of JSON (NDJSON).
+func writeWatchEvent(w io.Writer, config ProfileConfig, data RigData) error {
+	return json.NewEncoder(w).Encode(newWatchEvent(config, data))
+}
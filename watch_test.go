@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWriteWatchEventNDJSON(t *testing.T) {
+	config := ProfileConfig{RadioName: "IC-7300"}
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	states := []RigData{
+		{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "PKTUSB", ModeB: "PKTUSB", Power: 50, ReadAt: at},
+		{FreqVFOA: 14195000, FreqVFOB: 14200000, Mode: "USB", ModeB: "USB", Split: 1, PTT: true, Power: 100, ReadAt: at.Add(time.Second)},
+		{FreqVFOA: 7030000, FreqVFOB: 7030000, Mode: "CW", ModeB: "CW", NoPower: true, Memory: "12", ReadAt: at.Add(2 * time.Second)},
+	}
+	var out bytes.Buffer
+	for _, data := range states {
+		if err := writeWatchEvent(&out, config, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []WatchEvent{
+		{Time: at, Radio: "IC-7300", Frequency: 14074000, FrequencyRX: 14074000, Mode: "DATA", ModeRX: "DATA", Band: "20m", Power: 50.0},
+		{Time: at.Add(time.Second), Radio: "IC-7300", Frequency: 14200000, FrequencyRX: 14195000, Mode: "USB", ModeRX: "USB", Band: "20m", Power: 100.0, Split: true, PTT: true},
+		{Time: at.Add(2 * time.Second), Radio: "IC-7300", Frequency: 7030000, FrequencyRX: 7030000, Mode: "CW", ModeRX: "CW", Band: "40m", Memory: "12"},
+	}
+	scanner := bufio.NewScanner(&out)
+	var n int
+	for ; scanner.Scan(); n++ {
+		if n >= len(want) {
+			t.Fatalf("extra line %q", scanner.Text())
+		}
+		var got WatchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v (%q)", n+1, err, scanner.Text())
+		}
+		if !got.Time.Equal(want[n].Time) {
+			t.Errorf("line %d time = %s, want %s", n+1, got.Time, want[n].Time)
+		}
+		got.Time = want[n].Time
+		if got != want[n] {
+			t.Errorf("line %d = %+v, want %+v", n+1, got, want[n])
+		}
+	}
+	if n != len(want) {
+		t.Errorf("%d lines, want one per state change (%d)", n, len(want))
+	}
+}
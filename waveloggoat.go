@@ -3,22 +3,32 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/kolo/xmlrpc"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var log = logrus.New()
@@ -30,36 +40,297 @@ var version = "dev"
 type RigData struct {
 	FreqVFOA float64
 	FreqVFOB float64
-	Mode   string
+	Mode     string
 	ModeB    string
 	Split    int
-	Power    float64
+	Power    float64 // power sent to Wavelog in W, chosen by selectPower
+	NoPower  bool    // power was implausible and is left out of the update
+	RIT      float64 // receive offset in Hz, 0 when RIT is off
+	XIT      float64 // transmit offset in Hz, 0 when XIT is off
+	PTT      bool    // true while transmitting
+	Shift    float64 // repeater shift in Hz added to the TX frequency (negative for -), 0 for simplex
+	Memory   string  // memory channel being used, "" when the rig is on a VFO or cannot tell
+
+	Bandwidth  float64 // VFO A passband in Hz, 0 if unknown
+	BandwidthB float64 // VFO B passband in Hz, 0 if unknown
+
+	GridSquare string // station location, from config or gpsd
+
+	SWR float64 // SWR meter reading while transmitting, 0 if unknown; ignored by sameState
+
+	PowerSet    float64 // power level the rig is set to, in W
+	PowerActual float64 // measured output in W while transmitting, with measured_power; 0 if unknown, ignored by sameState
+
+	Receiver ReceiverState // AGC, preamp, attenuator, filter and IF shift, for the status display; ignored by sameState
+
+	Source string // data source read, set when failover or auto detection chose it; "" for data_source
+
+	ReadAt time.Time // when the state was read; ignored by sameState
+}
+
+// sameState reports whether two readings describe the same radio state, ignoring when
+// they were taken and fluctuating meter readings.
+func sameState(a, b RigData) bool {
+	a.ReadAt, b.ReadAt = time.Time{}, time.Time{}
+	a.SWR, b.SWR = 0, 0
+	a.PowerActual, b.PowerActual = 0, 0
+	a.Receiver, b.Receiver = ReceiverState{}, ReceiverState{}
+	return a == b
+}
+
+// checkPlausiblePower guards against garbage power readings, such as a bandwidth
+// returned in place of the power. A reading above max_plausible_power is clamped to it, or
+// left out of the update when implausible_power is "drop".
+func checkPlausiblePower(config ProfileConfig, data RigData) RigData {
+	if config.MaxPlausiblePower <= 0 || data.Power <= config.MaxPlausiblePower {
+		return data
+	}
+	if strings.EqualFold(config.ImplausiblePower, "drop") {
+		log.Warnf("Implausible power %g W (max_plausible_power %g W). Leaving power out of this update.", data.Power, config.MaxPlausiblePower)
+		data.Power = 0
+		data.NoPower = true
+		return data
+	}
+	log.Warnf("Implausible power %g W (max_plausible_power %g W). Sending %g W.", data.Power, config.MaxPlausiblePower, config.MaxPlausiblePower)
+	data.Power = config.MaxPlausiblePower
+	return data
+}
+
+// applyTransverterOffset shifts the VFO frequencies read from the rig's IF by the
+// transverter_offset_hz of the profile, giving the frequencies actually operated on.
+func applyTransverterOffset(config ProfileConfig, data RigData) RigData {
+	if config.TransverterOffsetHz == 0 {
+		return data
+	}
+	if data.FreqVFOA != 0 {
+		data.FreqVFOA += config.TransverterOffsetHz
+	}
+	if data.FreqVFOB != 0 {
+		data.FreqVFOB += config.TransverterOffsetHz
+	}
+	return data
+}
+
+// selectPower returns the power to report: the measured output while transmitting when
+// it is known, and otherwise the set level.
+func selectPower(data RigData) float64 {
+	if data.PTT && data.PowerActual > 0 {
+		return data.PowerActual
+	}
+	return data.PowerSet
+}
+
+// txPowerMemory implements power_on_tx_only: while receiving, the power of the last
+// transmission (0 before the first) is reported instead of the rig's set level.
+type txPowerMemory struct {
+	last float64
+}
+
+// Apply remembers the power of data while transmitting, and substitutes the remembered
+// power while receiving.
+func (m *txPowerMemory) Apply(data RigData) RigData {
+	if data.PTT {
+		if !data.NoPower {
+			m.last = data.Power
+		}
+		return data
+	}
+	data.Power = m.last
+	data.NoPower = false
+	return data
+}
+
+// txGated reports whether post_on_tx_only holds back current: the rig is receiving, and
+// already was when last was sent. last.PTT is still set when TX has just dropped, which
+// lets the final state through.
+func txGated(config ProfileConfig, current, last RigData) bool {
+	return config.PostOnTXOnly && !current.PTT && !last.PTT
+}
+
+// splitToggled reports whether split was turned on or off between two readings.
+func splitToggled(a, b RigData) bool {
+	return (a.Split != 0) != (b.Split != 0)
+}
+
+// hasMeaningfulChange reports whether current differs from last in a way worth sending.
+// Turning split on or off always counts, even when no frequency changed, since it swaps
+// which VFO is reported as the RX frequency. A power change only counts once it exceeds
+// threshold.
+func hasMeaningfulChange(current, last RigData, threshold powerThreshold) bool {
+	if splitToggled(current, last) {
+		return true
+	}
+	if !threshold.exceeded(current.Power, last.Power) {
+		current.Power, current.PowerSet = last.Power, last.PowerSet
+	}
+	return !sameState(current, last)
+}
+
+// powerThreshold is the power_change_threshold: the change in watts, or in percent of the
+// last power, that a power change must exceed to be sent on its own.
+type powerThreshold struct {
+	value   float64
+	percent bool
+}
+
+// parsePowerThreshold parses a power_change_threshold such as "5", "5W" or "10%". An
+// empty threshold lets every power change through.
+func parsePowerThreshold(s string) (powerThreshold, error) {
+	var t powerThreshold
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return t, nil
+	}
+	number := s
+	if trimmed, ok := strings.CutSuffix(number, "%"); ok {
+		number, t.percent = trimmed, true
+	} else {
+		number = strings.TrimSuffix(strings.TrimSuffix(number, "W"), "w")
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 0 {
+		return t, fmt.Errorf("invalid power change threshold '%s'. Use watts (e.g. 5) or a percentage (e.g. 10%%)", s)
+	}
+	t.value = value
+	return t, nil
+}
+
+// exceeded reports whether the power changed by more than the threshold from last to
+// current. Any change from 0 W exceeds a percentage.
+func (t powerThreshold) exceeded(current, last float64) bool {
+	diff := math.Abs(current - last)
+	if !t.percent {
+		return diff > t.value
+	}
+	if last == 0 {
+		return diff > 0
+	}
+	return diff*100/math.Abs(last) > t.value
 }
 
 // WavelogJSONRequest matches the required JSON payload for the Wavelog API update.
 type WavelogJSONRequest struct {
-	Key         string  `json:"key"`
-	Radio       string  `json:"radio"`
-	Power       float64 `json:"power"`
-	Frequency   int     `json:"frequency"`
-	Mode        string  `json:"mode"`
-	FrequencyRX int     `json:"frequency_rx,omitempty"`
-	ModeRX      string  `json:"mode_rx,omitempty"`
+	Key         string      `json:"key,omitempty"` // always set for Wavelog, left out of MQTT messages
+	Radio       string      `json:"radio"`
+	Power       interface{} `json:"power,omitempty"` // watts; nil leaves Wavelog's power unchanged
+	Frequency   int         `json:"frequency"`
+	Mode        string      `json:"mode"`
+	FrequencyRX int         `json:"frequency_rx,omitempty"`
+	ModeRX      string      `json:"mode_rx,omitempty"`
+	PropMode    string      `json:"prop_mode,omitempty"`
+	SatName     string      `json:"sat_name,omitempty"`
+	GridSquare  string      `json:"my_gridsquare,omitempty"`
+	Bandwidth   int         `json:"bandwidth,omitempty"`
+	BandwidthRX int         `json:"bandwidth_rx,omitempty"`
+	StationID   string      `json:"station_id,omitempty"`
+	Timestamp   interface{} `json:"timestamp,omitempty"` // RFC3339 string or Unix seconds
+	Submode     string      `json:"submode,omitempty"`
+	SWR         float64     `json:"swr,omitempty"`
+	Software    string      `json:"software,omitempty"` // WaveLogGoat/<version>, with send_version
+	Band        string      `json:"band,omitempty"`     // band of the frequency, e.g. "20m", with send_band
 	// Split may come in a later WaveLog version
 	// PTT may come in a a later WaveLog version
 }
 
+// WavelogJSONResponse holds the fields of the Wavelog API response used to detect failures.
+type WavelogJSONResponse struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
 type ProfileConfig struct {
-	WavelogURL string `json:"wavelog_url"`
-	WavelogKey string `json:"wavelog_key"`
-	RadioName  string `json:"radio_name"`
-	FlrigHost  string `json:"flrig_host"`
-	FlrigPort  int    `json:"flrig_port"`
-	HamlibHost string `json:"hamlib_host"`
-	HamlibPort int    `json:"hamlib_port"`
-	Interval   string `json:"interval"`
-	DataSource string `json:"data_source"` // "flrig" or "hamlib"
-	LogLevel   string `json:"log_level"`   // "error", "warn", "info", "debug"
+	WavelogURL            string            `json:"wavelog_url"`
+	WavelogKey            string            `json:"wavelog_key"`
+	RadioName             string            `json:"radio_name"`
+	FlrigHost             string            `json:"flrig_host"`
+	FlrigPort             int               `json:"flrig_port"`
+	HamlibHost            string            `json:"hamlib_host"`
+	HamlibPort            int               `json:"hamlib_port"`
+	Interval              string            `json:"interval"`
+	IntervalJitter        int               `json:"interval_jitter"` // percent of interval to randomize each sleep by
+	DataSource            string            `json:"data_source"`     // "flrig", "hamlib", "serial" or "auto"
+	LogLevel              string            `json:"log_level"`       // "error", "warn", "info", "debug", "trace"
+	Satellite             bool              `json:"satellite"`       // send prop_mode=SAT on cross-band VHF/UHF split
+	SatName               string            `json:"sat_name"`
+	GridSquare            string            `json:"grid_square"` // sent as my_gridsquare for portable operation
+	Gpsd                  bool              `json:"gpsd"`        // read grid_square live from gpsd
+	GpsdHost              string            `json:"gpsd_host"`
+	GpsdPort              int               `json:"gpsd_port"`
+	StatusListen          string            `json:"status_listen"`            // host:port for the status server, empty to disable
+	UserAgent             string            `json:"user_agent"`               // overrides the default WaveLogGoat/<version> (<radio>)
+	LogFile               string            `json:"log_file"`                 // rotating log file; empty logs to stderr
+	LogMaxSize            int               `json:"log_max_size"`             // megabytes before the log file is rotated
+	LogMaxFiles           int               `json:"log_max_files"`            // rotated log files to keep
+	LogFrequencyUnit      string            `json:"log_frequency_unit"`       // unit of frequencies in log messages: "hz" (default), "khz" or "mhz"
+	LogFrequencyDecimals  int               `json:"log_frequency_decimals"`   // decimals of logged frequencies, 0 for whole Hz in the unit
+	LogTimestampFormat    string            `json:"log_timestamp_format"`     // "rfc3339", "rfc3339nano", "datetime", "timeonly" or a Go time layout; empty for the default
+	LogTarget             string            `json:"log_target"`               // "stderr", "file" or "syslog"; empty picks file when log_file is set
+	SyslogFacility        string            `json:"syslog_facility"`          // syslog facility, e.g. "user", "daemon" or "local0"
+	SyslogTag             string            `json:"syslog_tag"`               // syslog tag identifying the messages
+	InsecureSkipVerify    bool              `json:"insecure_skip_verify"`     // accept any TLS certificate from Wavelog
+	OnChangeCommand       string            `json:"on_change_command"`        // shell command run after each Wavelog update
+	HookOnBandChange      bool              `json:"hook_on_band_change"`      // run on_change_command only when the update is a band change
+	BandChangeHz          float64           `json:"band_change_hz"`           // a frequency move larger than this many Hz also counts as a band change, 0 for band boundaries only
+	AutoRadioName         bool              `json:"auto_radio_name"`          // use the rig model from the backend when radio_name is the default
+	HamlibTimeout         string            `json:"hamlib_timeout"`           // per-command rigctld read deadline, e.g. "3s"
+	HamlibConnectTimeout  string            `json:"hamlib_connect_timeout"`   // deadline for connecting to rigctld, e.g. "5s"
+	SendBandwidth         bool              `json:"send_bandwidth"`           // include bandwidth/bandwidth_rx in the payload
+	MaxUpdateInterval     string            `json:"max_update_interval"`      // resend unchanged state after this long, e.g. "1m"
+	HTTPProxy             string            `json:"http_proxy"`               // proxy URL for Wavelog; falls back to HTTP(S)_PROXY
+	SocksProxy            string            `json:"socks_proxy"`              // SOCKS5 proxy host:port for Wavelog, takes precedence over http_proxy
+	StationID             string            `json:"station_id"`               // operator position identifier sent to Wavelog, omitted when empty
+	FollowPTT             bool              `json:"follow_ptt"`               // in split, send the RX frequency as primary unless transmitting
+	SuppressHamlibWarning bool              `json:"suppress_hamlib_warning"`  // never show the hamlib "untested" warning
+	SSBSideband           string            `json:"ssb_sideband"`             // how a bare "SSB" mode is sent: "auto" (band convention), "usb", "lsb" or "off"
+	PostOnTXOnly          bool              `json:"post_on_tx_only"`          // only update Wavelog while transmitting, plus once when TX ends
+	DataSources           []string          `json:"data_sources,omitempty"`   // ordered sources to fail over between, e.g. ["flrig", "hamlib"]; overrides data_source
+	SendTimestamp         string            `json:"send_timestamp"`           // include when the state was read: "" (off), "rfc3339" or "epoch"
+	PacketModes           string            `json:"packet_modes"`             // how hamlib packet modes (PKTUSB etc.) are sent: "data" (as DATA) or "sideband" (as USB/LSB/FM)
+	DataModes             []string          `json:"data_modes,omitempty"`     // modes sent to Wavelog as DATA, e.g. ["FT8", "RTTY"]
+	SendSubmode           bool              `json:"send_submode"`             // send the submode from mode_map or the original mode of a data_modes rewrite
+	PowerOnTXOnly         bool              `json:"power_on_tx_only"`         // while receiving, send the last transmit power (or 0) instead of the set level
+	HamlibKeepAlive       string            `json:"hamlib_keepalive"`         // TCP keepalive period for the rigctld connection, "0" to disable
+	ClearOnExit           bool              `json:"clear_on_exit"`            // send a final zero-power update on clean shutdown
+	WaitForRadio          bool              `json:"wait_for_radio"`           // until the radio has first been read, log connection failures only at debug level
+	ModeMap               map[string]string `json:"mode_map,omitempty"`       // backend mode string to "MODE" or "MODE/SUBMODE", overriding the built-in table
+	FlrigScheme           string            `json:"flrig_scheme"`             // "http" or "https" for flrig behind a TLS reverse proxy
+	FlrigUser             string            `json:"flrig_user"`               // HTTP basic auth user for flrig, if required
+	FlrigPassword         string            `json:"flrig_password"`           // HTTP basic auth password for flrig
+	ModeSettle            string            `json:"mode_settle"`              // a new mode must be reported this long before it is sent (e.g. "2s"), "" or "0" to send at once
+	SendSWR               bool              `json:"send_swr"`                 // include the SWR meter reading while transmitting in the payload
+	MinimalPayload        bool              `json:"minimal_payload"`          // send only key, radio, frequency and mode
+	PowerChangeThreshold  string            `json:"power_change_threshold"`   // power-only changes are sent once above this, in watts ("5") or percent ("10%")
+	SendVersion           bool              `json:"send_version"`             // include the WaveLogGoat version in the payload
+	SendBand              bool              `json:"send_band"`                // include the band of the frequency in the payload
+	RadioNameSource       bool              `json:"radio_name_source"`        // append the data source to radio_name, e.g. "FT-891-flrig"
+	TransverterOffsetHz   float64           `json:"transverter_offset_hz"`    // added to the frequencies read, to log the band a transverter operates on
+	ErrorSummaryEvery     int               `json:"error_summary_every"`      // log an identical repeated read or post error again every this many times, default 60
+	LogRepeatedErrors     bool              `json:"log_repeated_errors"`      // log every repeated error instead of periodic "still failing" summaries
+	ParseRetries          *int              `json:"parse_retries"`            // re-reads of the whole poll after a malformed backend response (0-5), nil for defaultParseRetries
+	SerialPort            string            `json:"serial_port"`              // serial device of a directly attached rig, for data_source "serial"
+	Baud                  int               `json:"baud"`                     // serial port speed, 0 for the rig's default
+	RigModel              int               `json:"rig_model"`                // hamlib rig model number (rigctl -l), for data_source "serial"
+	RigctldPath           string            `json:"rigctld_path"`             // rigctld executable run for data_source "serial", default "rigctld" from PATH
+	MaxPlausiblePower     float64           `json:"max_plausible_power"`      // power readings above this many watts are treated as garbage, 0 to accept any
+	ImplausiblePower      string            `json:"implausible_power"`        // "clamp" an implausible power to max_plausible_power, or "drop" it from the update
+	ReadReceiverState     bool              `json:"read_receiver_state"`      // also read AGC, preamp and attenuator for the status display (extra commands each poll)
+	ReadIFShift           bool              `json:"read_if_shift"`            // also read the IF shift and report the filter width for the status display
+	BandAllowlist         []string          `json:"band_allowlist,omitempty"` // only update Wavelog on these bands (e.g. ["20m", "40m"]); empty for all
+	FreqRanges            []string          `json:"freq_ranges,omitempty"`    // only update Wavelog within these "low-high" ranges in Hz, in addition to band_allowlist
+	MQTTBroker            string            `json:"mqtt_broker"`              // also publish each change to this MQTT broker, e.g. "tcp://localhost:1883"; "" to disable
+	MQTTTopic             string            `json:"mqtt_topic"`               // topic to publish on, default "waveloggoat/radio"
+	MQTTUser              string            `json:"mqtt_user"`                // MQTT broker credentials, if required
+	MQTTPassword          string            `json:"mqtt_password"`
+	MQTTRetain            bool              `json:"mqtt_retain"`            // publish as a retained message, so new subscribers get the current state
+	MeasuredPower         bool              `json:"measured_power"`         // while transmitting, send the measured output power instead of the set level
+	PowerMeters           map[string]string `json:"power_meters,omitempty"` // flrig mode to the meter read for measured_power, e.g. "rig.get_pwrmeter"
+	InferSplit            bool              `json:"infer_split"`            // with flrig, infer split from the VFOs when the split state cannot be read
+	VFOBSplitOnly         bool              `json:"vfo_b_split_only"`       // with flrig, read VFO B only while split is on, saving two requests per poll in simplex
+	HistorySize           int               `json:"history_size"`           // updates listed at /history on the status server, default 20
+	CheckClock            bool              `json:"check_clock"`            // periodically compare the rig clock (hamlib \get_clock) with the system clock
+	ClockSkew             string            `json:"clock_skew"`             // warn when the rig clock is further off than this, default "2s"
+	APIPath               string            `json:"api_path"`               // path of the radio API appended to wavelog_url, default "/api/radio"
 }
 
 type ConfigFile struct {
@@ -72,18 +343,125 @@ type RadioClient interface {
 	GetData() (RigData, error)
 }
 
+// implemented by radio sources that can report the connected rig's model name
+type RadioIdentifier interface {
+	GetRadioModel() (string, error)
+}
+
 // implements RadioClient for XML-RPC communication with flrig
 type FlrigClient struct {
-	Host string
-	Port int
+	Host     string
+	Port     int
+	Scheme   string // "http" (default) or "https", e.g. behind a reverse proxy
+	Username string // HTTP basic auth credentials, if the proxy requires them
+	Password string
+
+	ReadReceiver  bool              // also read the AGC, preamp and attenuator settings
+	ReadIFShift   bool              // also read the IF shift and report the filter width
+	MeasuredPower bool              // read the power meter while transmitting
+	PowerMeters   map[string]string // mode to the flrig meter read for measured power
+	InferSplit    bool              // infer split from the VFOs when flrig cannot report it
+	VFOBSplitOnly bool              // read VFO B only while split is on, using VFO A's values in simplex
+
+	concurrency int               // XML-RPC calls in flight per poll; 0 uses flrigConcurrency, 1 reads serially
+	transport   http.RoundTripper // nil uses http.DefaultTransport
+
+	mu   sync.Mutex       // guards the fields below, as reads are issued concurrently
+	idle []*xmlrpc.Client // created lazily and reused between calls and polls
+	gen  int              // incremented whenever the connection is reset
+
+	failures int       // consecutive connection failures, for reconnect backoff
+	retryAt  time.Time // no reconnection attempt before this time
+
+	splitMethod      string // split method that worked on this connection, "" if not yet known
+	splitUnsupported bool   // no split method worked on this connection
+	swrUnsupported   bool   // rig.get_swrmeter failed on this connection
+	txVFO            string // VFO in use ("A" or "B") when last seen transmitting, for InferSplit
+
+	receiverUnsupported map[string]bool // receiver setting methods that failed on this connection
+}
+
+// flrigConcurrency limits how many XML-RPC calls a poll has in flight at once. Each
+// needs its own client, since an xmlrpc.Client performs one HTTP round trip at a time.
+const flrigConcurrency = 4
+
+// flrigSplitMethods are the XML-RPC methods flrig releases have used to report split,
+// tried in order until one succeeds.
+var flrigSplitMethods = []string{"rig.get_split", "rig.get_splitstate", "rig.getsplit"}
+
+// Reconnect backoff for flrig: doubles from the minimum on each consecutive connection failure
+const (
+	flrigBackoffMin = 2 * time.Second
+	flrigBackoffMax = 30 * time.Second
+)
+
+// errRigPoweredOff is returned when the backend reports that the rig is switched off.
+var errRigPoweredOff = errors.New("rig powered off")
+
+// maxParseRetries caps parse_retries so that a backend that always answers garbage does
+// not turn each poll into a burst of reads.
+const maxParseRetries = 5
+
+// defaultParseRetries applies when parse_retries is not set, as in profiles saved before
+// it existed. It is a pointer so that an explicit 0 still turns the re-reads off.
+const defaultParseRetries = 2
+
+// parseRetries returns the profile's parse_retries, or defaultParseRetries if unset.
+func parseRetries(config ProfileConfig) int {
+	if config.ParseRetries == nil {
+		return defaultParseRetries
+	}
+	return *config.ParseRetries
+}
+
+// ParseError is returned when a backend answers with a response that cannot be parsed.
+// A second read often returns clean data, so the poll is retried on it.
+type ParseError struct {
+	What  string // what was being read, e.g. "frequency"
+	Value string // the response that failed to parse
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("failed to parse %s '%s': %v", e.What, e.Value, e.Err)
+	}
+	return fmt.Sprintf("invalid %s response '%s'", e.What, e.Value)
 }
 
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// errReconnectBackoff is returned while waiting to reconnect to a backend after connection errors.
+var errReconnectBackoff = errors.New("waiting to reconnect")
+
 // implements RadioClient for TCP communication with rigctld / hamlib
 type HamlibClient struct {
-	Host string
-	Port int
+	Host        string
+	Port        int
+	Timeout     time.Duration // per-command read deadline
+	DialTimeout time.Duration // bounds connecting to rigctld
+	KeepAlive   time.Duration // TCP keepalive period, 0 to disable
+
+	ReadReceiver  bool // also read the AGC, preamp and attenuator levels
+	ReadIFShift   bool // also read the IF shift and report the filter width
+	MeasuredPower bool // read the output power meter while transmitting
+
+	sess *hamlibSession // kept open between polls, replaced once broken
+
+	vfoMode    bool // rigctld runs in VFO mode (--vfo) and expects a VFO argument
+	vfoChecked bool // vfoMode has been asked with \chk_vfo
 }
 
+// defaultHamlibTimeout bounds each rigctld command when no hamlib_timeout is configured.
+const defaultHamlibTimeout = 3 * time.Second
+
+// defaultHamlibConnectTimeout bounds connecting to rigctld when no hamlib_connect_timeout
+// is configured, so that an unreachable host does not stall polling for the OS default.
+const defaultHamlibConnectTimeout = 5 * time.Second
+
+// defaultHamlibKeepAlive is the TCP keepalive period when no hamlib_keepalive is configured.
+const defaultHamlibKeepAlive = 30 * time.Second
+
 func getConfigPath() (string, error) {
 	var configDir string
 	switch runtime.GOOS {
@@ -101,188 +479,1845 @@ func getConfigPath() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(configDir, "config.json"), nil
+	return filepath.Join(configDir, "config.json"), nil
+}
+
+func loadConfig(path string) (ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigFile{}, err // Error includes file not found
+	}
+	var cfg ConfigFile
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return ConfigFile{}, fmt.Errorf("failed to unmarshal config file: %w", jsonErrorAt(data, err))
+	}
+	// Very old or hand-edited files may have no profiles at all, or "profiles": null
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]ProfileConfig)
+	}
+	return cfg, nil
+}
+
+// jsonErrorAt adds the line and column to a JSON syntax or type error, computed from its
+// byte offset into data, so that mistakes in a hand-edited file are easy to find. The
+// offset counts the bytes read up to and including the offending one.
+func jsonErrorAt(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset > 0 {
+		offset--
+	}
+	line, column := 1, 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
+
+func saveConfig(path string, cfg ConfigFile) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config to JSON: %w", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// exportProfile writes a single profile to path with the API key blanked, for sharing.
+func exportProfile(cfg ConfigFile, name, path string) error {
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile '%s' does not exist in the configuration file", name)
+	}
+	profile.WavelogKey = ""
+	profile.FlrigPassword = ""
+	profile.MQTTPassword = ""
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile to JSON: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// importProfile reads a profile exported by exportProfile from path and stores it under
+// name in cfg. An existing profile's API key is kept, since exported profiles carry none.
+func importProfile(cfg *ConfigFile, name, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var profile ProfileConfig
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return fmt.Errorf("failed to unmarshal profile file: %w", jsonErrorAt(data, err))
+	}
+	if existing, ok := cfg.Profiles[name]; ok && profile.WavelogKey == "" {
+		profile.WavelogKey = existing.WavelogKey
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]ProfileConfig)
+	}
+	cfg.Profiles[name] = profile
+	return nil
+}
+
+// logTimestampFormats are the names accepted in log_timestamp_format besides a Go time
+// layout such as "15:04:05.000".
+var logTimestampFormats = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"datetime":    time.DateTime,
+	"timeonly":    time.TimeOnly,
+}
+
+// logTimestampLayout returns the time layout for a log_timestamp_format, "" keeping
+// logrus's default.
+func logTimestampLayout(format string) string {
+	if layout, ok := logTimestampFormats[strings.ToLower(strings.TrimSpace(format))]; ok {
+		return layout
+	}
+	return format
+}
+
+// logLevelEnv names the environment variable that overrides the profile's log_level, for
+// containers and services where flags are awkward. -log-level still takes precedence.
+const logLevelEnv = "WAVELOGGOAT_LOG_LEVEL"
+
+// setupLogging sets the log format and level. levelStr is the profile's log_level, which
+// WAVELOGGOAT_LOG_LEVEL replaces unless levelFromFlag says it was given with -log-level.
+func setupLogging(levelStr, timestampFormat string, levelFromFlag bool) {
+	log.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp:   true,
+		TimestampFormat: logTimestampLayout(timestampFormat),
+	})
+
+	if env := strings.TrimSpace(os.Getenv(logLevelEnv)); env != "" && !levelFromFlag {
+		levelStr = env
+	}
+
+	level, err := logrus.ParseLevel(levelStr)
+	if err != nil {
+		log.SetLevel(logrus.ErrorLevel)
+		log.Errorf("Invalid log level '%s'. Defaulting to 'error'.", levelStr)
+		return
+	}
+	log.SetLevel(level)
+}
+
+// logTarget returns where log output goes: the profile's log_target, or "file" when only
+// log_file is set and "stderr" otherwise.
+func logTarget(config ProfileConfig) string {
+	if target := strings.ToLower(strings.TrimSpace(config.LogTarget)); target != "" {
+		return target
+	}
+	if config.LogFile != "" {
+		return "file"
+	}
+	return "stderr"
+}
+
+// Log file rotation defaults, also applied when a profile leaves the settings at 0
+const (
+	defaultLogMaxSize  = 10 // megabytes
+	defaultLogMaxFiles = 3
+)
+
+// Syslog defaults, also applied when a profile leaves the settings empty
+const (
+	defaultSyslogFacility = "user"
+	defaultSyslogTag      = "waveloggoat"
+)
+
+// newLogFile returns the size-rotated writer for the profile's log_file.
+func newLogFile(config ProfileConfig) *lumberjack.Logger {
+	logFile := &lumberjack.Logger{
+		Filename:   config.LogFile,
+		MaxSize:    config.LogMaxSize,
+		MaxBackups: config.LogMaxFiles,
+	}
+	if logFile.MaxSize <= 0 {
+		logFile.MaxSize = defaultLogMaxSize
+	}
+	if logFile.MaxBackups <= 0 {
+		logFile.MaxBackups = defaultLogMaxFiles
+	}
+	return logFile
+}
+
+// setupLogOutput sends log output to stderr, a size-rotated file or syslog, as the profile
+// selects. If syslog cannot be reached, logging stays on stderr.
+func setupLogOutput(config ProfileConfig) {
+	log.ReplaceHooks(make(logrus.LevelHooks))
+	switch logTarget(config) {
+	case "file":
+		log.SetOutput(newLogFile(config))
+		log.Infof("Logging to %s", config.LogFile)
+	case "syslog":
+		log.SetOutput(os.Stderr)
+		if err := setupSyslog("", "", config.SyslogFacility, config.SyslogTag); err != nil {
+			log.Warnf("Cannot log to syslog, logging to stderr instead: %v", err)
+		}
+	default:
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// getClient returns an idle XML-RPC client, creating one if none is free, along with
+// the connection generation it belongs to.
+func (f *FlrigClient) getClient() (*xmlrpc.Client, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n := len(f.idle); n > 0 {
+		client := f.idle[n-1]
+		f.idle = f.idle[:n-1]
+		return client, f.gen, nil
+	}
+	if wait := time.Until(f.retryAt); wait > 0 {
+		return nil, f.gen, fmt.Errorf("flrig %w in %s", errReconnectBackoff, wait.Round(time.Millisecond))
+	}
+	scheme := f.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	transport := f.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if f.Username != "" || f.Password != "" {
+		transport = &basicAuthTransport{Username: f.Username, Password: f.Password, Base: transport}
+	}
+	client, err := xmlrpc.NewClient(fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(f.Host, strconv.Itoa(f.Port))), transport)
+	if err != nil {
+		return nil, f.gen, err
+	}
+	return client, f.gen, nil
+}
+
+// basicAuthTransport adds HTTP basic auth credentials to every request.
+type basicAuthTransport struct {
+	Username string
+	Password string
+	Base     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.Username, t.Password)
+	return t.Base.RoundTrip(req)
+}
+
+// call invokes an XML-RPC method on flrig, discarding the cached clients on
+// connection errors so that a later call reconnects after a capped backoff.
+func (f *FlrigClient) call(method string, args interface{}, reply interface{}) error {
+	client, gen, err := f.getClient()
+	if err != nil {
+		return err
+	}
+	err = client.Call(method, args, reply)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil && isTransientConnError(err) {
+		client.Close()
+		// Concurrent calls failing together count as a single failure
+		if gen == f.gen {
+			f.resetLocked()
+			backoff := flrigBackoffMin << min(f.failures, 8)
+			if backoff > flrigBackoffMax {
+				backoff = flrigBackoffMax
+			}
+			f.failures++
+			f.retryAt = time.Now().Add(backoff)
+			log.Debugf("flrig connection failed %d time(s); reconnecting in %s", f.failures, backoff)
+		}
+		return err
+	}
+	if gen == f.gen {
+		f.idle = append(f.idle, client)
+		f.failures = 0
+	} else {
+		client.Close()
+	}
+	return err
+}
+
+// resetLocked closes the idle clients and starts a new connection generation.
+// f.mu must be held.
+func (f *FlrigClient) resetLocked() error {
+	var errs []error
+	for _, client := range f.idle {
+		errs = append(errs, client.Close())
+	}
+	f.idle = nil
+	f.gen++
+	// A reconnect may reach a different flrig release
+	f.splitMethod = ""
+	f.splitUnsupported = false
+	f.swrUnsupported = false
+	f.txVFO = ""
+	f.receiverUnsupported = nil
+	return errors.Join(errs...)
+}
+
+// Close releases the cached XML-RPC clients, if any.
+func (f *FlrigClient) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resetLocked()
+}
+
+// getSplit reads the split state, finding and remembering which split method this
+// flrig supports.
+func (f *FlrigClient) getSplit() (int, error) {
+	var split int
+	f.mu.Lock()
+	method, unsupported := f.splitMethod, f.splitUnsupported
+	f.mu.Unlock()
+	if unsupported {
+		return 0, nil
+	}
+	if method != "" {
+		if err := f.call(method, nil, &split); err != nil {
+			return 0, fmt.Errorf("call failed to %s: %w", method, err)
+		}
+		return split, nil
+	}
+	var lastErr error
+	for _, method := range flrigSplitMethods {
+		err := f.call(method, nil, &split)
+		if err == nil {
+			log.Debugf("Using %s to read split from flrig", method)
+			f.mu.Lock()
+			f.splitMethod = method
+			f.mu.Unlock()
+			return split, nil
+		}
+		lastErr = fmt.Errorf("call failed to %s: %w", method, err)
+		if isTransientConnError(err) {
+			return 0, lastErr
+		}
+	}
+	// Only reported once per connection rather than on every poll
+	f.mu.Lock()
+	f.splitUnsupported = true
+	f.mu.Unlock()
+	return 0, lastErr
+}
+
+// inferSplit guesses the split state for rigs whose split flrig cannot report: while
+// transmitting, the VFO in use is the one transmitting, so it is remembered, and the rig
+// counts as in split when that was VFO B and the VFOs are on different frequencies.
+func (f *FlrigClient) inferSplit(data RigData) int {
+	if data.PTT {
+		var vfo string
+		if err := f.call("rig.get_AB", nil, &vfo); err != nil {
+			log.Debugf("call failed to rig.get_AB (flrig): %v. Cannot infer split.", err)
+		} else {
+			f.mu.Lock()
+			f.txVFO = strings.ToUpper(strings.TrimSpace(vfo))
+			f.mu.Unlock()
+		}
+	}
+	f.mu.Lock()
+	txVFO := f.txVFO
+	f.mu.Unlock()
+	if !splitInferred(data.FreqVFOA, data.FreqVFOB, txVFO) {
+		return 0
+	}
+	log.Debugf("Inferring split: transmitting on VFO B at %.0f Hz, VFO A at %.0f Hz", data.FreqVFOB, data.FreqVFOA)
+	return 1
+}
+
+// splitInferred reports whether VFO A and B frequencies and the transmitting VFO ("A" or
+// "B") indicate split: both VFOs are set, they differ, and the rig transmits on B.
+func splitInferred(freqA, freqB float64, txVFO string) bool {
+	return freqA > 0 && freqB > 0 && freqHz(freqA) != freqHz(freqB) && txVFO == "B"
+}
+
+// Frequency magnitudes for unit detection. No radio reports a frequency below 100 kHz in
+// Hz, so a smaller reading is taken to be kHz or MHz, such as 14074 or 14.074, when the
+// converted frequency lies in an amateur band.
+const (
+	minPlausibleFreq = 1000
+	kHzThreshold     = 100000
+	maxPlausibleFreq = 30e9
+)
+
+// normalizeFrequency converts a frequency reported in Hz, kHz or MHz to Hz. A reading
+// below kHzThreshold is only converted when the result lies in an amateur band, trying
+// kHz before MHz; otherwise it is left alone with a warning, as is an implausible one.
+func normalizeFrequency(freq float64) float64 {
+	if freq > 0 && freq < kHzThreshold && bandForFrequency(freq) == "" {
+		for _, unit := range []struct {
+			name   string
+			factor float64
+		}{{"kHz", 1e3}, {"MHz", 1e6}} {
+			if band := bandForFrequency(freq * unit.factor); band != "" {
+				log.Debugf("Frequency %g looks like %s (%s); converting to Hz", freq, unit.name, band)
+				return freq * unit.factor
+			}
+		}
+		log.Warnf("Frequency %g reported by radio is outside the amateur bands in Hz, kHz and MHz; leaving it unconverted", freq)
+		return freq
+	}
+	if freq < minPlausibleFreq || freq > maxPlausibleFreq {
+		log.Warnf("Implausible frequency %g Hz reported by radio", freq)
+	}
+	return freq
+}
+
+// freqHz rounds a frequency to whole Hz for the Wavelog payload.
+func freqHz(freq float64) int {
+	return int(math.Round(freq))
+}
+
+func (f *FlrigClient) GetData() (RigData, error) {
+	var data RigData
+	var vfoA string
+	var err error
+
+	// Read the VFO A frequency first so that an unreachable flrig fails fast
+	if err := f.call("rig.get_vfo", nil, &vfoA); err != nil {
+		return RigData{}, fmt.Errorf("call failed to rig.get_vfo: %w", err)
+	}
+	if data.FreqVFOA, err = strconv.ParseFloat(vfoA, 64); err != nil {
+		return RigData{}, &ParseError{What: "vfo frequency", Value: vfoA, Err: err}
+	}
+	data.FreqVFOA = normalizeFrequency(data.FreqVFOA)
+
+	// The remaining reads are independent, so issue them concurrently; each one only
+	// writes its own variables
+	var wg sync.WaitGroup
+	concurrency := f.concurrency
+	if concurrency <= 0 {
+		concurrency = flrigConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	run := func(read func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			read()
+		}()
+	}
+
+	var modeErr error
+	run(func() {
+		// rig.get_mode returns the active VFO's mode, so prefer the explicit VFO A read
+		if err := f.call("rig.get_modeA", nil, &data.Mode); err != nil {
+			if isTransientConnError(err) {
+				modeErr = fmt.Errorf("call failed to rig.get_modeA: %w", err)
+				return
+			}
+			log.Debugf("call failed to rig.get_modeA (flrig): %v. Falling back to rig.get_mode.", err)
+			if err := f.call("rig.get_mode", nil, &data.Mode); err != nil {
+				modeErr = fmt.Errorf("call failed to rig.get_mode: %w", err)
+			}
+		}
+	})
+
+	run(func() {
+		var power interface{}
+		if err := f.call("rig.get_power", nil, &power); err != nil {
+			log.Debugf("call failed to rig.get_power (flrig): %v. Sending 0 power.", err)
+		} else if watts, ok := parseFlrigNumber(power); ok {
+			data.PowerSet = watts
+		} else {
+			log.Debugf("Unexpected rig.get_power value %#v (flrig). Sending 0 power.", power)
+		}
+	})
+
+	// VFO B falls back to VFO A's frequency and mode when it is not read
+	vfoB := vfoA
+	modeBOK := false
+	readVFOB := func() {
+		run(func() {
+			if err := f.call("rig.get_vfoB", nil, &vfoB); err != nil {
+				log.Debugf("call failed to rig.get_vfoB (flrig): %v. Sending vfoA %s.", err, vfoA)
+				vfoB = vfoA
+			}
+		})
+		run(func() {
+			if err := f.call("rig.get_modeB", nil, &data.ModeB); err != nil {
+				log.Debugf("call failed to rig.get_modeB (flrig): %v. Sending ModeA.", err)
+				return
+			}
+			modeBOK = true
+		})
+	}
+	if !f.VFOBSplitOnly {
+		readVFOB()
+	}
+
+	splitKnown := false
+	run(func() {
+		split, err := f.getSplit()
+		if err != nil {
+			log.Warnf("Failed to read split from flrig: %v. Sending Split=0.", err)
+		}
+		data.Split = split
+		f.mu.Lock()
+		splitKnown = err == nil && !f.splitUnsupported
+		f.mu.Unlock()
+		// Without a known split state VFO B is still needed, to infer split from it
+		if f.VFOBSplitOnly && (split != 0 || !splitKnown) {
+			readVFOB()
+		}
+	})
+
+	run(func() {
+		var ptt int
+		if err := f.call("rig.get_ptt", nil, &ptt); err != nil {
+			log.Debugf("call failed to rig.get_ptt (flrig): %v. Assuming receive.", err)
+		}
+		data.PTT = ptt != 0
+	})
+
+	run(func() {
+		var bw interface{}
+		if err := f.call("rig.get_bw", nil, &bw); err != nil {
+			log.Debugf("call failed to rig.get_bw (flrig): %v. Sending no bandwidth.", err)
+		} else {
+			data.Bandwidth = parseFlrigBandwidth(bw)
+		}
+	})
+
+	run(func() {
+		var rit int
+		if err := f.call("rig.get_rit", nil, &rit); err != nil {
+			log.Debugf("call failed to rig.get_rit (flrig): %v. Sending RIT=0.", err)
+		}
+		data.RIT = float64(rit)
+	})
+
+	run(func() {
+		var xit int
+		if err := f.call("rig.get_xit", nil, &xit); err != nil {
+			log.Debugf("call failed to rig.get_xit (flrig): %v. Sending XIT=0.", err)
+		}
+		data.XIT = float64(xit)
+	})
+
+	if f.ReadReceiver {
+		run(func() { data.Receiver.AGC = f.getReceiverSetting("rig.get_agc", formatFlrigSetting) })
+		run(func() { data.Receiver.Preamp = f.getReceiverSetting("rig.get_preamp", formatFlrigSetting) })
+		run(func() { data.Receiver.Attenuator = f.getReceiverSetting("rig.get_attenuator", formatFlrigSetting) })
+	}
+	if f.ReadIFShift {
+		run(func() { data.Receiver.IFShift = f.getIFShift() })
+	}
+
+	wg.Wait()
+
+	if modeErr != nil {
+		return RigData{}, modeErr
+	}
+	if data.FreqVFOB, err = strconv.ParseFloat(vfoB, 64); err != nil {
+		return RigData{}, &ParseError{What: "vfoB frequency", Value: vfoB, Err: err}
+	}
+	data.FreqVFOB = normalizeFrequency(data.FreqVFOB)
+	if !modeBOK {
+		data.ModeB = data.Mode
+	}
+	if f.InferSplit && !splitKnown {
+		data.Split = f.inferSplit(data)
+	}
+	if f.ReadIFShift {
+		data.Receiver.Filter = formatFilter(data.Bandwidth)
+	}
+	if data.PTT {
+		data.SWR = f.getSWR()
+		if f.MeasuredPower {
+			data.PowerActual = f.getPowerMeter(powerMeterMethod(txMode(data), f.PowerMeters))
+		}
+	}
+	data.Power = selectPower(data)
+
+	// flrig has no separate VFO B bandwidth, and no repeater shift methods (Shift stays 0;
+	// rigs in duplex are seen through their split VFOs instead). It has no memory channel
+	// methods either, so Memory stays "".
+	data.BandwidthB = data.Bandwidth
+
+	log.Debugf("Got data %#v", data)
+	return data, nil
+}
+
+// getSWR reads the SWR meter, which is only meaningful while transmitting. flrig has no
+// reflected power method. Rigs without an SWR meter are not asked again on this connection.
+func (f *FlrigClient) getSWR() float64 {
+	f.mu.Lock()
+	unsupported := f.swrUnsupported
+	f.mu.Unlock()
+	if unsupported {
+		return 0
+	}
+	var meter interface{}
+	if err := f.call("rig.get_swrmeter", nil, &meter); err != nil {
+		log.Debugf("call failed to rig.get_swrmeter (flrig): %v. Not reading SWR.", err)
+		if !isTransientConnError(err) {
+			f.mu.Lock()
+			f.swrUnsupported = true
+			f.mu.Unlock()
+		}
+		return 0
+	}
+	swr, _ := parseFlrigNumber(meter)
+	return swr
+}
+
+// defaultPowerMeter is the flrig meter read for measured power in modes without an entry
+// in power_meters.
+const defaultPowerMeter = "rig.get_pwrmeter"
+
+// powerMeterMethod returns the flrig method of the meter that measures power in mode, from
+// meters (keyed by flrig mode, e.g. {"FM": "pwrmeter", "USB": "rig.get_alc"}) or the
+// default power meter. A bare meter name has "rig.get_" added.
+func powerMeterMethod(mode string, meters map[string]string) string {
+	for k, v := range meters {
+		if !strings.EqualFold(strings.TrimSpace(k), strings.TrimSpace(mode)) {
+			continue
+		}
+		if v = strings.TrimSpace(v); v == "" {
+			break
+		}
+		if !strings.Contains(v, ".") {
+			v = "rig.get_" + v
+		}
+		return v
+	}
+	return defaultPowerMeter
+}
+
+// getPowerMeter reads the given power meter in W while transmitting, or 0 if the rig
+// does not report it.
+func (f *FlrigClient) getPowerMeter(method string) float64 {
+	var meter interface{}
+	if err := f.call(method, nil, &meter); err != nil {
+		log.Debugf("call failed to %s (flrig): %v. Sending the set power.", method, err)
+		return 0
+	}
+	watts, _ := parseFlrigNumber(meter)
+	return watts
+}
+
+// parseFlrigNumber interprets a numeric reply such as rig.get_power, which is an integer
+// in most flrig releases but may be a double or a string, so that QRP levels such as
+// 0.5 W survive.
+func parseFlrigNumber(v interface{}) (float64, bool) {
+	switch p := v.(type) {
+	case int64:
+		return float64(p), true
+	case float64:
+		return p, true
+	case string:
+		if watts, err := strconv.ParseFloat(strings.TrimSpace(p), 64); err == nil {
+			return watts, true
+		}
+	}
+	return 0, false
+}
+
+// parseFlrigBandwidth interprets rig.get_bw, which returns the bandwidth in Hz either as a
+// string or, for rigs with two filter controls, as an array whose first element is the width.
+func parseFlrigBandwidth(v interface{}) float64 {
+	switch bw := v.(type) {
+	case []interface{}:
+		if len(bw) > 0 {
+			return parseFlrigBandwidth(bw[0])
+		}
+	case string:
+		if width, err := strconv.ParseFloat(strings.TrimSpace(bw), 64); err == nil {
+			return width
+		}
+	case int64:
+		return float64(bw)
+	case float64:
+		return bw
+	}
+	return 0
+}
+
+// Hamlib support is UNTESTED and was partially confabulated ("hallucinated") by Gemini, so it
+// is very unlikely to actually work. Please report errors in order to fix it.
+
+// hamlibSession is a single connection to rigctld. Every command is bounded by a
+// deadline so that a wedged rigctld cannot block polling forever.
+type hamlibSession struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	vfoMode bool // add the currVFO argument to commands that take a VFO
+	broken  bool // an I/O error left the connection unusable or out of step
+}
+
+// dial opens a new session to rigctld.
+func (h *HamlibClient) dial() (*hamlibSession, error) {
+	dialTimeout := h.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultHamlibConnectTimeout
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(h.Host, strconv.Itoa(h.Port)), dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("hamlib connection error: %w", err)
+	}
+	// Keepalive notices a connection dropped by a network blip while it sits idle between polls
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if h.KeepAlive > 0 {
+			if err := tcp.SetKeepAlive(true); err == nil {
+				err = tcp.SetKeepAlivePeriod(h.KeepAlive)
+			}
+			if err != nil {
+				log.Debugf("Failed to enable TCP keepalive on the hamlib connection: %v", err)
+			}
+		} else {
+			tcp.SetKeepAlive(false)
+		}
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHamlibTimeout
+	}
+	return &hamlibSession{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// session returns the open rigctld session, connecting if there is none.
+func (h *HamlibClient) session() (*hamlibSession, error) {
+	if h.sess != nil && !h.sess.broken {
+		return h.sess, nil
+	}
+	if h.sess != nil {
+		h.sess.Close()
+		h.sess = nil
+	}
+	sess, err := h.dial()
+	if err != nil {
+		// rigctld may come back with different options
+		h.vfoChecked = false
+		return nil, err
+	}
+	if !h.vfoChecked {
+		vfoMode, err := sess.checkVFOMode()
+		if err != nil {
+			sess.Close()
+			return nil, err
+		}
+		h.vfoMode, h.vfoChecked = vfoMode, true
+	}
+	sess.vfoMode = h.vfoMode
+	h.sess = sess
+	return sess, nil
+}
+
+// checkVFOMode asks rigctld with \chk_vfo whether it was started in VFO mode. A rigctld
+// too old to know the command is treated as not in VFO mode; an error is only returned
+// when the connection broke.
+func (sess *hamlibSession) checkVFOMode() (bool, error) {
+	resp, err := sess.query("\\chk_vfo", 1)
+	if sess.broken {
+		return false, err
+	}
+	if err != nil || len(resp) == 0 {
+		log.Debugf("Failed to check hamlib VFO mode: %v. Assuming commands take no VFO argument.", err)
+		return false, nil
+	}
+	log.Debugf("hamlib VFO mode: %s", resp[0])
+	return resp[0] == "1", nil
+}
+
+// release drops the session after a poll if it broke, so that the next poll reconnects.
+func (h *HamlibClient) release(sess *hamlibSession) {
+	if sess.broken && h.sess == sess {
+		sess.Close()
+		h.sess = nil
+	}
+}
+
+// Close closes the rigctld connection, if any.
+func (h *HamlibClient) Close() error {
+	if h.sess == nil {
+		return nil
+	}
+	err := h.sess.Close()
+	h.sess = nil
+	return err
+}
+
+func (sess *hamlibSession) Close() error {
+	return sess.conn.Close()
+}
+
+// query sends a single rigctld command and returns the values of the given number of
+// response lines, with any labels or VFO prefixes removed (see hamlibValue).
+func (sess *hamlibSession) query(cmd string, lines int) ([]string, error) {
+	resp, err := sess.queryLines(cmd, lines)
+	for i, line := range resp {
+		resp[i] = hamlibValue(line)
+	}
+	return resp, err
+}
+
+// queryLines sends a single rigctld command and reads the given number of response lines,
+// or reads up to the "RPRT n" status line when lines is 0 (set commands). A non-zero
+// RPRT status is returned as an error. Echoed commands are skipped.
+func (sess *hamlibSession) queryLines(cmd string, lines int) ([]string, error) {
+	cmd = hamlibCommand(cmd, sess.vfoMode)
+	if sess.broken {
+		return nil, fmt.Errorf("hamlib connection lost before '%s' command: %w", cmd, net.ErrClosed)
+	}
+	if err := sess.conn.SetDeadline(time.Now().Add(sess.timeout)); err != nil {
+		sess.broken = true
+		return nil, fmt.Errorf("failed to set hamlib deadline: %w", err)
+	}
+	log.Tracef("hamlib > %s", wireString([]byte(cmd)))
+	if _, err := fmt.Fprintf(sess.conn, "%s\n", cmd); err != nil {
+		sess.broken = true
+		return nil, fmt.Errorf("failed to send '%s' command to hamlib: %w", cmd, err)
+	}
+	resp := make([]string, 0, lines)
+	for lines == 0 || len(resp) < lines {
+		line, _, err := sess.reader.ReadLine()
+		if err != nil {
+			// A late reply to a timed out command would be read as the next one's answer
+			sess.broken = true
+			return nil, fmt.Errorf("failed to read '%s' response from hamlib: %w", cmd, err)
+		}
+		log.Tracef("hamlib < %s", wireString(line))
+		str := strings.TrimSpace(string(line))
+		if strings.HasPrefix(str, "RPRT ") {
+			if str != "RPRT 0" {
+				return nil, fmt.Errorf("hamlib command '%s' failed: %s", cmd, str)
+			}
+			// Set commands only answer with a status line
+			break
+		}
+		if isHamlibEcho(cmd, str) {
+			continue
+		}
+		resp = append(resp, str)
+	}
+	return resp, nil
+}
+
+// hamlibVFOCommands are the rigctld commands read by WaveLogGoat that take a VFO argument
+// when rigctld runs in VFO mode.
+var hamlibVFOCommands = map[string]bool{
+	"f": true, "m": true, "i": true, "x": true, "s": true, "t": true,
+	"j": true, "z": true, "r": true, "o": true, "e": true, "l": true,
+}
+
+// hamlibCommand formats cmd for rigctld, inserting the currVFO argument after the command
+// name in VFO mode, e.g. "l RFPOWER" as "l currVFO RFPOWER".
+func hamlibCommand(cmd string, vfoMode bool) string {
+	if !vfoMode {
+		return cmd
+	}
+	name, args, _ := strings.Cut(cmd, " ")
+	if !hamlibVFOCommands[name] {
+		return cmd
+	}
+	if args == "" {
+		return name + " currVFO"
+	}
+	return name + " currVFO " + args
+}
+
+// wireString formats raw protocol bytes for trace logging, showing non-printable bytes
+// (including stray carriage returns) as \xNN.
+func wireString(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0x20 && c < 0x7f {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "\\x%02x", c)
+		}
+	}
+	return sb.String()
+}
+
+// isHamlibEcho reports whether a response line is rigctld echoing the command, either
+// verbatim or as a long command name header such as "get_freq:".
+func isHamlibEcho(cmd, line string) bool {
+	if line == cmd {
+		return true
+	}
+	return strings.HasSuffix(line, ":") && !strings.ContainsAny(line, " \t")
+}
+
+// hamlibValue extracts the value from a response line that may carry a label or a VFO
+// prefix, e.g. "14074000", "Frequency: 14074000", "VFOA 14074000" or "VFOA: USB".
+func hamlibValue(line string) string {
+	if i := strings.LastIndex(line, ":"); i >= 0 {
+		line = line[i+1:]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// hamlibVFO is the frequency, mode and passband read from one VFO.
+type hamlibVFO struct {
+	Freq     float64
+	Mode     string
+	Passband float64
+}
+
+// readFreqMode reads frequency, mode and passband of the currently selected VFO.
+func (sess *hamlibSession) readFreqMode() (hamlibVFO, error) {
+	var vfo hamlibVFO
+	freqResp, err := sess.query("f", 1)
+	if err != nil {
+		return vfo, err
+	}
+	if len(freqResp) == 0 {
+		return vfo, fmt.Errorf("empty frequency response from hamlib")
+	}
+	vfo.Freq, err = strconv.ParseFloat(freqResp[0], 64)
+	if err != nil {
+		return vfo, &ParseError{What: "frequency", Value: freqResp[0], Err: err}
+	}
+	vfo.Freq = normalizeFrequency(vfo.Freq)
+
+	modeResp, err := sess.query("m", 2) // mode, then passband, e.g. "USB" "2400"
+	if err != nil {
+		return vfo, err
+	}
+	if len(modeResp) == 0 || modeResp[0] == "" {
+		return vfo, &ParseError{What: "hamlib mode", Value: strings.Join(modeResp, " ")}
+	}
+	vfo.Mode = modeResp[0]
+	if len(modeResp) > 1 {
+		if passband, err := strconv.ParseFloat(modeResp[1], 64); err == nil {
+			vfo.Passband = passband
+		}
+	}
+	return vfo, nil
+}
+
+// readOffset reads a RIT/XIT style offset in Hz, returning 0 when the rig does not support it.
+func (sess *hamlibSession) readOffset(cmd, name string) float64 {
+	resp, err := sess.query(cmd, 1)
+	if err != nil || len(resp) == 0 {
+		log.Debugf("Failed to read %s from hamlib: %v. Sending %s=0.", name, err, name)
+		return 0
+	}
+	offset, err := strconv.ParseFloat(resp[0], 64)
+	if err != nil {
+		log.Debugf("Failed to parse %s '%s': %v. Sending %s=0.", name, resp[0], err, name)
+		return 0
+	}
+	return offset
+}
+
+// readMemoryChannel returns the memory channel number when the rig is in memory mode
+// ('v' reports "MEM"), and "" on a VFO or when the rig does not report it.
+func (sess *hamlibSession) readMemoryChannel() string {
+	vfoResp, err := sess.query("v", 1)
+	if err != nil || len(vfoResp) == 0 || vfoResp[0] != "MEM" {
+		return ""
+	}
+	resp, err := sess.query("e", 1)
+	if err != nil || len(resp) == 0 {
+		log.Debugf("Failed to read memory channel from hamlib: %v", err)
+		return ""
+	}
+	return parseMemoryChannel(resp[0])
+}
+
+// parseMemoryChannel validates a memory channel number reply, returning "" for anything
+// that is not a channel number.
+func parseMemoryChannel(resp string) string {
+	channel, err := strconv.Atoi(strings.TrimSpace(resp))
+	if err != nil || channel < 0 {
+		return ""
+	}
+	return strconv.Itoa(channel)
+}
+
+// readRepeaterShift reads the repeater duplex direction ('r': "+", "-" or "None") and
+// offset ('o', in Hz), returning the signed shift of the TX frequency, or 0 for simplex
+// or when the rig does not support it.
+func (sess *hamlibSession) readRepeaterShift() float64 {
+	resp, err := sess.query("r", 1)
+	if err != nil || len(resp) == 0 {
+		log.Debugf("Failed to read repeater shift from hamlib: %v. Assuming simplex.", err)
+		return 0
+	}
+	var sign float64
+	switch resp[0] {
+	case "+":
+		sign = 1
+	case "-":
+		sign = -1
+	default:
+		return 0
+	}
+	offset := sess.readOffset("o", "repeater offset")
+	return sign * math.Abs(offset)
+}
+
+// otherVFO returns the counterpart of a hamlib VFO name, or "" if there is none.
+func otherVFO(vfo string) string {
+	switch vfo {
+	case "VFOA":
+		return "VFOB"
+	case "VFOB":
+		return "VFOA"
+	case "Main":
+		return "Sub"
+	case "Sub":
+		return "Main"
+	}
+	return ""
+}
+
+// readSplitFreqMode reads the TX frequency, mode and passband with rigctld's get_split_freq
+// ('i') and get_split_mode ('x') commands, which leave the selected VFO alone. Rigs
+// without split support answer with an RPRT error.
+func (sess *hamlibSession) readSplitFreqMode() (hamlibVFO, error) {
+	var vfo hamlibVFO
+	freqResp, err := sess.query("i", 1)
+	if err != nil {
+		return vfo, err
+	}
+	if len(freqResp) == 0 {
+		return vfo, fmt.Errorf("empty split frequency response from hamlib")
+	}
+	vfo.Freq, err = strconv.ParseFloat(freqResp[0], 64)
+	if err != nil {
+		return vfo, &ParseError{What: "split frequency", Value: freqResp[0], Err: err}
+	}
+	vfo.Freq = normalizeFrequency(vfo.Freq)
+
+	modeResp, err := sess.query("x", 2) // TX mode, then passband
+	if err != nil {
+		return vfo, err
+	}
+	if len(modeResp) == 0 || modeResp[0] == "" {
+		return vfo, &ParseError{What: "hamlib split mode", Value: strings.Join(modeResp, " ")}
+	}
+	vfo.Mode = modeResp[0]
+	if len(modeResp) > 1 {
+		if passband, err := strconv.ParseFloat(modeResp[1], 64); err == nil {
+			vfo.Passband = passband
+		}
+	}
+	return vfo, nil
+}
+
+// readSplitVFO switches to the given VFO to read its frequency and mode, then
+// switches back to the original VFO so that the rig state is left undisturbed.
+func (sess *hamlibSession) readSplitVFO(origVFO, vfo string) (state hamlibVFO, err error) {
+	if _, err := sess.query("V "+vfo, 0); err != nil {
+		return state, err
+	}
+	defer func() {
+		if _, restoreErr := sess.query("V "+origVFO, 0); restoreErr != nil {
+			log.Warnf("Failed to restore hamlib VFO to %s: %v", origVFO, restoreErr)
+			if err == nil {
+				err = restoreErr
+			}
+		}
+	}()
+	return sess.readFreqMode()
+}
+
+func (h *HamlibClient) GetData() (RigData, error) {
+	sess, err := h.session()
+	if err != nil {
+		return RigData{}, err
+	}
+	defer h.release(sess)
+
+	// A rig that is switched off answers every other read with an error
+	if powerResp, err := sess.query("\\get_powerstat", 1); err == nil && len(powerResp) > 0 && powerResp[0] == "0" {
+		return RigData{}, errRigPoweredOff
+	}
+
+	data := RigData{}
+
+	// Query frequency and mode of the current VFO
+	curr, err := sess.readFreqMode()
+	if err != nil {
+		return RigData{}, err
+	}
+	data.FreqVFOA, data.Mode, data.Bandwidth = curr.Freq, curr.Mode, curr.Passband
+	data.FreqVFOB, data.ModeB, data.BandwidthB = curr.Freq, curr.Mode, curr.Passband
+
+	// Query Power (RFPOWER level, 0.0-1.0)
+	powerResp, err := sess.query("l RFPOWER", 1)
+	if err != nil || len(powerResp) == 0 {
+		log.Warnf("Failed to read power from hamlib: %v. Sending 0 W.", err)
+	} else {
+		powerLevel, err := strconv.ParseFloat(powerResp[0], 64)
+		if err != nil {
+			log.Warnf("Failed to parse power '%s': %v. Sending 0 W.", powerResp[0], err)
+		} else {
+			// Convert level to percentage of 100W max for simple display (Wavelog typically expects watts)
+			data.PowerSet = powerLevel * 100
+		}
+	}
+
+	// Query PTT state, "0" or "1"
+	pttResp, err := sess.query("t", 1)
+	if err != nil || len(pttResp) == 0 {
+		log.Debugf("Failed to read PTT from hamlib: %v. Assuming receive.", err)
+	} else {
+		data.PTT = pttResp[0] != "0"
+	}
+
+	// The SWR meter only reads while transmitting
+	if data.PTT {
+		if resp, err := sess.query("l SWR", 1); err != nil || len(resp) == 0 {
+			log.Debugf("Failed to read SWR from hamlib: %v", err)
+		} else if swr, err := strconv.ParseFloat(resp[0], 64); err == nil {
+			data.SWR = swr
+		}
+		if h.MeasuredPower {
+			if resp, err := sess.query("l RFPOWER_METER_WATTS", 1); err != nil || len(resp) == 0 {
+				log.Debugf("Failed to read the power meter from hamlib: %v. Sending the set power.", err)
+			} else if watts, err := strconv.ParseFloat(resp[0], 64); err == nil {
+				data.PowerActual = watts
+			}
+		}
+	}
+	data.Power = selectPower(data)
+
+	// Query RIT and XIT offsets in Hz
+	data.RIT = sess.readOffset("j", "RIT")
+	data.XIT = sess.readOffset("z", "XIT")
+	data.Shift = sess.readRepeaterShift()
+	data.Memory = sess.readMemoryChannel()
+	if h.ReadReceiver {
+		data.Receiver = sess.readReceiverState()
+	}
+	if h.ReadIFShift {
+		data.Receiver.Filter = formatFilter(data.Bandwidth)
+		data.Receiver.IFShift = sess.readIFShift()
+	}
+
+	// Query split state and TX VFO, e.g. "1" "VFOB"
+	splitResp, err := sess.query("s", 2)
+	if err != nil || len(splitResp) < 2 {
+		log.Debugf("Failed to read split from hamlib: %v. Sending Split=0.", err)
+		return data, nil
+	}
+	if splitResp[0] == "0" {
+		return data, nil
+	}
+
+	vfoResp, err := sess.query("v", 1)
+	if err != nil || len(vfoResp) == 0 {
+		log.Debugf("Failed to read current VFO from hamlib: %v. Sending Split=0.", err)
+		return data, nil
+	}
+	currVFO := vfoResp[0]
+	txVFO := splitResp[1]
+	readVFO := txVFO
+	if txVFO == currVFO {
+		readVFO = otherVFO(currVFO)
+	}
+	if readVFO == "" {
+		log.Debugf("Cannot determine split VFO from current %s and TX %s. Sending Split=0.", currVFO, txVFO)
+		return data, nil
+	}
+
+	// The split commands read the TX VFO directly; switching VFOs is only needed when the
+	// current VFO is the TX one or the rig does not support them
+	if readVFO == txVFO {
+		tx, err := sess.readSplitFreqMode()
+		if err == nil {
+			data.Split = 1
+			data.FreqVFOB, data.ModeB, data.BandwidthB = tx.Freq, tx.Mode, tx.Passband
+			return data, nil
+		}
+		log.Debugf("Failed to read split frequency/mode from hamlib: %v. Switching VFOs instead.", err)
+	}
+
+	other, err := sess.readSplitVFO(currVFO, readVFO)
+	if err != nil {
+		log.Warnf("Failed to read split VFO %s from hamlib: %v. Sending Split=0.", readVFO, err)
+		return data, nil
+	}
+	data.Split = 1
+	// VFO A carries RX and VFO B carries TX, matching flrig's convention
+	if readVFO == txVFO {
+		data.FreqVFOB, data.ModeB, data.BandwidthB = other.Freq, other.Mode, other.Passband
+	} else {
+		data.FreqVFOA, data.Mode, data.Bandwidth = other.Freq, other.Mode, other.Passband
+	}
+
+	return data, nil
+}
+
+// GetRadioModel returns the transceiver name reported by flrig.
+func (f *FlrigClient) GetRadioModel() (string, error) {
+	var xcvr string
+	if err := f.call("rig.get_xcvr", nil, &xcvr); err != nil {
+		return "", fmt.Errorf("call failed to rig.get_xcvr: %w", err)
+	}
+	return strings.TrimSpace(xcvr), nil
+}
+
+// GetRadioModel returns the rig model name from rigctld's capabilities dump.
+func (h *HamlibClient) GetRadioModel() (string, error) {
+	sess, err := h.session()
+	if err != nil {
+		return "", err
+	}
+	defer h.release(sess)
+
+	// The extended response protocol ('+' prefix) terminates the multi-line dump with RPRT
+	caps, err := sess.queryLines("+\\dump_caps", 0)
+	if err != nil {
+		return "", err
+	}
+	return parseHamlibModelName(caps), nil
+}
+
+// parseHamlibModelName extracts the "Model name:" value from a dump_caps response.
+func parseHamlibModelName(caps []string) string {
+	for _, line := range caps {
+		if name, ok := strings.CutPrefix(line, "Model name:"); ok {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+// jitteredInterval returns base randomly adjusted by up to +/- percent of itself.
+func jitteredInterval(base time.Duration, percent int, rng *rand.Rand) time.Duration {
+	if percent <= 0 {
+		return base
+	}
+	spread := int64(base) * int64(percent) / 100
+	if spread <= 0 {
+		return base
+	}
+	return base + time.Duration(rng.Int63n(2*spread+1)-spread)
+}
+
+// hamlibWarningMarker is created next to the configuration file once the hamlib warning
+// has been shown, so that it is shown only once.
+const hamlibWarningMarker = ".hamlib-warning-shown"
+
+// warnHamlibUntested shows the hamlib warning unless it was already shown for this
+// configuration directory.
+func warnHamlibUntested(configPath string) {
+	marker := filepath.Join(filepath.Dir(configPath), hamlibWarningMarker)
+	if _, err := os.Stat(marker); err == nil {
+		return
+	}
+	log.Warnf("Hamlib support is untested and presumed broken. Please report success or failure to debug or remove this message! (Shown once; set suppress_hamlib_warning to never show it.)")
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		log.Debugf("Failed to record that the hamlib warning was shown: %v", err)
+	}
+}
+
+// newRadioClient returns the radio client for the profile's data source.
+func newRadioClient(config ProfileConfig) (RadioClient, error) {
+	if len(config.DataSources) > 0 {
+		return newFailoverClient(config, config.DataSources)
+	}
+	switch strings.ToLower(config.DataSource) {
+	case "flrig":
+		scheme := strings.ToLower(config.FlrigScheme)
+		if scheme == "" {
+			scheme = "http"
+		}
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("invalid flrig scheme '%s'. Must be 'http' or 'https'", config.FlrigScheme)
+		}
+		return &FlrigClient{Host: config.FlrigHost, Port: config.FlrigPort, Scheme: scheme, Username: config.FlrigUser, Password: config.FlrigPassword, ReadReceiver: config.ReadReceiverState, ReadIFShift: config.ReadIFShift, MeasuredPower: config.MeasuredPower, PowerMeters: config.PowerMeters, InferSplit: config.InferSplit, VFOBSplitOnly: config.VFOBSplitOnly}, nil
+	case "hamlib":
+		return newHamlibClient(config, config.HamlibHost, config.HamlibPort)
+	case "serial":
+		if config.SerialPort == "" {
+			return nil, errors.New("the serial data source needs serial_port (e.g. /dev/ttyUSB0 or COM3)")
+		}
+		if config.RigModel <= 0 {
+			return nil, errors.New("the serial data source needs rig_model, the hamlib model number listed by 'rigctl -l'")
+		}
+		// The host and port are filled in once rigctld has been started
+		hamlib, err := newHamlibClient(config, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		rigctld := config.RigctldPath
+		if rigctld == "" {
+			rigctld = "rigctld"
+		}
+		return &SerialClient{Port: config.SerialPort, Baud: config.Baud, RigModel: config.RigModel, Rigctld: rigctld, hamlib: hamlib}, nil
+	case "auto":
+		return newAutoClient(config)
+	default:
+		return nil, fmt.Errorf("invalid data source specified: '%s'. Must be 'flrig', 'hamlib', 'serial' or 'auto'", config.DataSource)
+	}
+}
+
+// newHamlibClient creates a client for the rigctld at host:port using the profile's
+// hamlib timeout and keepalive settings.
+func newHamlibClient(config ProfileConfig, host string, port int) (*HamlibClient, error) {
+	timeout := defaultHamlibTimeout
+	if config.HamlibTimeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.HamlibTimeout); err != nil {
+			return nil, fmt.Errorf("invalid hamlib timeout format: %w", err)
+		}
+	}
+	dialTimeout := defaultHamlibConnectTimeout
+	if config.HamlibConnectTimeout != "" {
+		var err error
+		if dialTimeout, err = time.ParseDuration(config.HamlibConnectTimeout); err != nil {
+			return nil, fmt.Errorf("invalid hamlib connect timeout format: %w", err)
+		}
+	}
+	keepAlive := defaultHamlibKeepAlive
+	if config.HamlibKeepAlive != "" {
+		var err error
+		if keepAlive, err = time.ParseDuration(config.HamlibKeepAlive); err != nil {
+			return nil, fmt.Errorf("invalid hamlib keepalive format: %w", err)
+		}
+	}
+	return &HamlibClient{Host: host, Port: port, Timeout: timeout, DialTimeout: dialTimeout, KeepAlive: keepAlive, ReadReceiver: config.ReadReceiverState, ReadIFShift: config.ReadIFShift, MeasuredPower: config.MeasuredPower}, nil
+}
+
+// logRadioClient logs which radio the client reads, showing the hamlib warning for the
+// hamlib based data sources.
+func logRadioClient(client RadioClient, config ProfileConfig, profile, configPath string) {
+	switch c := client.(type) {
+	case *FlrigClient:
+		log.Infof("Using flrig client at %s://%s:%d (Profile: %s)", c.Scheme, config.FlrigHost, config.FlrigPort, profile)
+	case *HamlibClient:
+		log.Infof("Using Hamlib client at %s:%d (Profile: %s)", config.HamlibHost, config.HamlibPort, profile)
+		if !config.SuppressHamlibWarning {
+			warnHamlibUntested(configPath)
+		}
+	case *SerialClient:
+		log.Infof("Using rig model %d on serial port %s (Profile: %s)", c.RigModel, c.Port, profile)
+		if !config.SuppressHamlibWarning {
+			warnHamlibUntested(configPath)
+		}
+	case *FailoverClient:
+		log.Infof("Using data sources %s in order of preference (Profile: %s)", strings.Join(c.Names, ", "), profile)
+	case *AutoClient:
+		log.Infof("Detecting the data source: flrig at %s:%d or Hamlib at %s:%d (Profile: %s)", config.FlrigHost, config.FlrigPort, config.HamlibHost, config.HamlibPort, profile)
+		if !config.SuppressHamlibWarning {
+			warnHamlibUntested(configPath)
+		}
+	}
+}
+
+// validateProfile checks the settings a profile needs before it can post to Wavelog.
+// placeholderKey is the default API key, which is never a valid one.
+func validateProfile(config ProfileConfig, placeholderKey string) error {
+	if config.WavelogKey == "" || config.WavelogKey == placeholderKey {
+		return errors.New("Wavelog API key is required. Please set via --wavelog-key or in the config file")
+	}
+	if config.WavelogURL == "" {
+		return errors.New("Wavelog URL is required")
+	}
+	if _, err := time.ParseDuration(config.Interval); err != nil {
+		return fmt.Errorf("invalid interval duration format: %w", err)
+	}
+	if config.IntervalJitter < 0 || config.IntervalJitter > 100 {
+		return fmt.Errorf("invalid interval jitter %d%%. Must be between 0 and 100", config.IntervalJitter)
+	}
+	switch logTarget(config) {
+	case "stderr", "syslog":
+	case "file":
+		if config.LogFile == "" {
+			return errors.New("log_target 'file' requires log_file to be set")
+		}
+	default:
+		return fmt.Errorf("invalid log_target '%s'. Must be 'stderr', 'file' or 'syslog'", config.LogTarget)
+	}
+	if retries := parseRetries(config); retries < 0 || retries > maxParseRetries {
+		return fmt.Errorf("invalid parse_retries %d. Must be between 0 and %d", retries, maxParseRetries)
+	}
+	if config.BandChangeHz < 0 {
+		return fmt.Errorf("invalid band_change_hz %g. Must not be negative", config.BandChangeHz)
+	}
+	if config.MaxPlausiblePower < 0 {
+		return fmt.Errorf("invalid max_plausible_power %g. Must not be negative", config.MaxPlausiblePower)
+	}
+	if _, ok := frequencyUnits[strings.ToLower(strings.TrimSpace(config.LogFrequencyUnit))]; !ok && config.LogFrequencyUnit != "" {
+		return fmt.Errorf("invalid log_frequency_unit '%s'. Must be 'hz', 'khz' or 'mhz'", config.LogFrequencyUnit)
+	}
+	switch strings.ToLower(config.ImplausiblePower) {
+	case "", "clamp", "drop":
+	default:
+		return fmt.Errorf("invalid implausible_power '%s'. Must be 'clamp' or 'drop'", config.ImplausiblePower)
+	}
+	switch strings.ToLower(config.SendTimestamp) {
+	case "", "rfc3339", "epoch":
+	default:
+		return fmt.Errorf("invalid send_timestamp '%s'. Must be 'rfc3339', 'epoch' or empty", config.SendTimestamp)
+	}
+	return nil
+}
+
+// readRadio reads the radio, re-reading up to retries times while the backend returns a
+// malformed response.
+func readRadio(client RadioClient, retries int) (RigData, error) {
+	retries = min(max(retries, 0), maxParseRetries)
+	data, err := client.GetData()
+	var parseErr *ParseError
+	for attempt := 1; attempt <= retries && errors.As(err, &parseErr); attempt++ {
+		log.Debugf("Malformed response from radio (%v); re-reading (attempt %d of %d)", err, attempt, retries)
+		data, err = client.GetData()
+	}
+	return data, err
+}
+
+// benchmarkPoll performs n back-to-back radio reads and prints their latency statistics.
+func benchmarkPoll(client RadioClient, n int) {
+	var latencies []time.Duration
+	errorCounts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		_, err := client.GetData()
+		elapsed := time.Since(start)
+		if err != nil {
+			errorCounts[err.Error()]++
+			continue
+		}
+		latencies = append(latencies, elapsed)
+	}
+
+	fmt.Printf("Polls: %d, succeeded: %d, failed: %d\n", n, len(latencies), n-len(latencies))
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var total time.Duration
+		for _, l := range latencies {
+			total += l
+		}
+		p95 := latencies[(len(latencies)*95+99)/100-1]
+		fmt.Printf("Latency min: %s, avg: %s, max: %s, p95: %s\n",
+			latencies[0], total/time.Duration(len(latencies)), latencies[len(latencies)-1], p95)
+	}
+	for msg, count := range errorCounts {
+		fmt.Printf("Error (%d times): %s\n", count, msg)
+	}
+}
+
+// modeDebouncer holds back mode changes until the new mode has settled, so that the
+// intermediate modes some rigs report while switching are not posted.
+type modeDebouncer struct {
+	settle  time.Duration
+	pending [2]string // VFO A and B modes waiting to settle
+	since   time.Time // when the pending modes were first seen
+}
+
+// Apply returns current with the modes of posted, the last state sent to Wavelog, kept
+// until the new modes have been seen for the settle time. Other fields pass through, and
+// toggling split sends the new modes at once, as it changes which VFO each describes.
+func (d *modeDebouncer) Apply(current, posted RigData, now time.Time) RigData {
+	if d.settle <= 0 || posted.Mode == "" || splitToggled(current, posted) {
+		d.since = time.Time{}
+		return current
+	}
+	modes := [2]string{current.Mode, current.ModeB}
+	if modes == [2]string{posted.Mode, posted.ModeB} {
+		d.since = time.Time{}
+		return current
+	}
+	if modes != d.pending || d.since.IsZero() {
+		d.pending = modes
+		d.since = now
+	}
+	if now.Sub(d.since) >= d.settle {
+		return current
+	}
+	log.Debugf("Mode %s/%s not settled yet; keeping %s/%s", current.Mode, current.ModeB, posted.Mode, posted.ModeB)
+	current.Mode, current.ModeB = posted.Mode, posted.ModeB
+	return current
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// serviceArgs returns the command line arguments with the -service flag removed, for
+// running the installed service with the same configuration.
+func serviceArgs(args []string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if name == "service" {
+			i++ // skip the separate value
+			continue
+		}
+		if strings.HasPrefix(name, "service=") {
+			continue
+		}
+		result = append(result, args[i])
+	}
+	return result
 }
 
-func loadConfig(path string) (ConfigFile, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return ConfigFile{}, err // Error includes file not found
+// transientErrnos are the socket errors seen while a backend is not running, restarting
+// or briefly unreachable.
+var transientErrnos = []syscall.Errno{
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EPIPE,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+	syscall.ETIMEDOUT,
+}
+
+// isTransientConnError reports whether err looks like the radio backend is not (yet)
+// reachable or dropped the connection, rather than a real failure.
+func isTransientConnError(err error) bool {
+	if err == nil {
+		return false
 	}
-	var cfg ConfigFile
-	err = json.Unmarshal(data, &cfg)
-	if err != nil {
-		return ConfigFile{}, fmt.Errorf("failed to unmarshal config file: %w", err)
+	if errors.Is(err, errReconnectBackoff) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
 	}
-	return cfg, nil
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// Covers refused connections on platforms whose socket errors are not syscall errnos
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
 }
 
-func saveConfig(path string, cfg ConfigFile) error {
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal config to JSON: %w", err)
-	}
-	return os.WriteFile(path, data, 0600)
+// errorRepeatEvery is how often a repeated identical error is logged again when no
+// error_summary_every is configured.
+const errorRepeatEvery = 60
+
+// repeatFilter suppresses consecutive identical errors, letting the first and then
+// every Every-th occurrence through as a "still failing" summary. An Every of 1 or less
+// lets every error through.
+type repeatFilter struct {
+	Every int
+	last  string
+	count int
 }
 
-func setupLogging(levelStr string) {
-	log.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
+// newRepeatFilter returns a filter for the profile's error_summary_every, or one that
+// lets every error through with log_repeated_errors.
+func newRepeatFilter(config ProfileConfig) repeatFilter {
+	switch {
+	case config.LogRepeatedErrors:
+		return repeatFilter{Every: 1}
+	case config.ErrorSummaryEvery > 0:
+		return repeatFilter{Every: config.ErrorSummaryEvery}
+	}
+	return repeatFilter{Every: errorRepeatEvery}
+}
 
-	level, err := logrus.ParseLevel(levelStr)
-	if err != nil {
-		log.SetLevel(logrus.ErrorLevel)
-		log.Errorf("Invalid log level '%s'. Defaulting to 'error'.", levelStr)
-		return
+// Allow records err and reports whether it should be logged, with the number of
+// consecutive times it has occurred.
+func (r *repeatFilter) Allow(err error) (bool, int) {
+	msg := err.Error()
+	if msg != r.last {
+		r.last = msg
+		r.count = 0
 	}
-	log.SetLevel(level)
+	r.count++
+	return r.Every <= 1 || r.count%r.Every == 1, r.count
 }
 
-func (f *FlrigClient) GetData() (RigData, error) {
-	var data RigData
-	var vfoA string
-	var power int
-	var vfoB string
+// Reset forgets the last error, e.g. after a successful poll.
+func (r *repeatFilter) Reset() {
+	r.last = ""
+	r.count = 0
+}
 
-	client, err := xmlrpc.NewClient(fmt.Sprintf("http://%s:%d/", f.Host, f.Port), nil)
-	if err != nil {
-		return data, err
+// repeatMessage formats an error that repeatFilter let through, as the first failure to
+// do action (e.g. "post to Wavelog") or as a summary of count consecutive failures.
+func repeatMessage(action string, count int, err error) string {
+	if count > 1 {
+		return fmt.Sprintf("Still failing to %s (%d times): %v", action, count, err)
 	}
-	defer client.Close()
+	return fmt.Sprintf("Failed to %s: %v", action, err)
+}
 
-	if err := client.Call("rig.get_vfo", nil, &vfoA); err != nil {
-		return RigData{}, fmt.Errorf("call failed to rig.get_vfo: %w", err)
-	}
-	if data.FreqVFOA, err = strconv.ParseFloat(vfoA, 64); err != nil {
-		log.Errorf("Failed to parse vfo frequency %s: %s", vfoA, err)
-		return RigData{}, err
+// rxFrequency returns the effective receive frequency: VFO A shifted by any RIT offset.
+func rxFrequency(data RigData) float64 {
+	return data.FreqVFOA + data.RIT
+}
+
+// txFrequency returns the effective transmit frequency: VFO B in split, otherwise VFO A
+// plus any repeater shift, shifted by any XIT offset.
+func txFrequency(data RigData) float64 {
+	freq := data.FreqVFOA + data.Shift
+	if data.Split != 0 {
+		freq = data.FreqVFOB
 	}
+	return freq + data.XIT
+}
 
-	if err := client.Call("rig.get_mode", nil, &data.Mode); err != nil {
-		return RigData{}, fmt.Errorf("call failed to rig.get_mode: %w", err)
+// userAgent returns the configured User-Agent, or one identifying WaveLogGoat, its version and the radio.
+func userAgent(config ProfileConfig) string {
+	if config.UserAgent != "" {
+		return config.UserAgent
 	}
+	return fmt.Sprintf("WaveLogGoat/%s (%s)", version, config.RadioName)
+}
 
-	if err := client.Call("rig.get_power", nil, &power); err != nil {
-		log.Debugf("call failed to rig.get_power (flrig): %v. Sending 0 power.", err)
-		power = 0
+// txMode returns the transmit mode: VFO B's mode in split, otherwise VFO A's.
+func txMode(data RigData) string {
+	if data.Split != 0 {
+		return data.ModeB
 	}
-	data.Power = float64(power)
+	return data.Mode
+}
 
-	if err := client.Call("rig.get_split", nil, &data.Split); err != nil {
-		log.Warnf("call failed to rig.get_split (flrig): %v. Sending Split=0.", err)
-		data.Split = 0
+// expandRadioName substitutes the {band} and {mode} placeholders in a radio_name
+// template, e.g. "IC-7300 {band}" becomes "IC-7300 20m". Names without placeholders are
+// returned unchanged.
+func expandRadioName(name string, freq float64, mode string) string {
+	if !strings.Contains(name, "{") {
+		return name
 	}
+	return strings.NewReplacer("{band}", bandForFrequency(freq), "{mode}", mode).Replace(name)
+}
 
-	if err := client.Call("rig.get_vfoB", nil, &vfoB); err != nil {
-		log.Debugf("call failed to rig.get_vfoB (flrig): %v. Sending vfoA %s.", err, vfoA)
-		vfoB = vfoA
+// buildPayload constructs the complete Wavelog update from a single radio state snapshot,
+// so that frequency, mode, power and split fields always describe the same moment.
+func buildPayload(config ProfileConfig, data RigData) WavelogJSONRequest {
+	payload := WavelogJSONRequest{
+		Key:        config.WavelogKey,
+		Radio:      config.RadioName,
+		Frequency:  freqHz(txFrequency(data)),
+		Mode:       txMode(data),
+		GridSquare: data.GridSquare,
+		StationID:  config.StationID,
 	}
-	if data.FreqVFOB, err = strconv.ParseFloat(vfoB, 64); err != nil {
-		log.Errorf("Failed to parse vfoB frequency %s: %s", vfoB, err)
-		return RigData{}, err
+	if !data.NoPower {
+		payload.Power = data.Power
 	}
-
-	if err := client.Call("rig.get_modeB", nil, &data.ModeB); err != nil {
-		log.Debugf("call failed to rig.get_modeB (flrig): %v. Sending ModeA.", err)
-		data.ModeB = data.Mode
+	// RX differs from TX in split, through a repeater, and also in simplex when RIT is active
+	if data.Split != 0 || data.RIT != 0 || data.Shift != 0 {
+		payload.FrequencyRX = freqHz(rxFrequency(data))
+		payload.ModeRX = data.Mode
 	}
-
-	log.Debugf("Got data %#v", data)
-	return data, nil
+	// The TX side of a split is only the operating frequency while actually transmitting
+	if config.FollowPTT && data.Split != 0 && !data.PTT {
+		payload.Frequency = freqHz(rxFrequency(data))
+		payload.Mode = data.Mode
+	}
+	// Some rigs receive on VFO B in an independent mode without the split flag set
+	if data.Split == 0 && data.ModeB != "" && data.ModeB != data.Mode {
+		payload.ModeRX = data.ModeB
+	}
+	if config.SendBandwidth {
+		if data.Split != 0 {
+			payload.Bandwidth = freqHz(data.BandwidthB)
+			payload.BandwidthRX = freqHz(data.Bandwidth)
+		} else {
+			payload.Bandwidth = freqHz(data.Bandwidth)
+		}
+	}
+	// Backend mode names are not necessarily the ones Wavelog records
+	var submode string
+	payload.Mode, submode = translateMode(config, payload.Mode, float64(payload.Frequency))
+	payload.ModeRX, _ = translateMode(config, payload.ModeRX, rxFrequency(data))
+	if config.SendSubmode {
+		payload.Submode = submode
+	}
+	payload.Radio = expandRadioName(config.RadioName, float64(payload.Frequency), payload.Mode)
+	if config.RadioNameSource {
+		source := data.Source
+		if source == "" {
+			source = strings.ToLower(config.DataSource)
+		}
+		payload.Radio += "-" + source
+	}
+	if config.SendSWR {
+		payload.SWR = data.SWR
+	}
+	if config.SendVersion {
+		payload.Software = "WaveLogGoat/" + version
+	}
+	if config.SendBand {
+		payload.Band = bandForFrequency(float64(payload.Frequency))
+	}
+	// The POST may be delayed, so say when the state was actually read
+	if !data.ReadAt.IsZero() {
+		switch strings.ToLower(config.SendTimestamp) {
+		case "rfc3339":
+			payload.Timestamp = data.ReadAt.UTC().Format(time.RFC3339)
+		case "epoch":
+			payload.Timestamp = data.ReadAt.Unix()
+		}
+	}
+	// Satellites are worked cross-band: uplink (TX) on VFO B, downlink (RX) on VFO A
+	if config.Satellite && isCrossBandSplit(data) {
+		payload.PropMode = "SAT"
+		payload.SatName = config.SatName
+	}
+	return payload
 }
 
-// Hamlib support is UNTESTED and was partially confabulated ("hallucinated") by Gemini, so it
-// is very unlikely to actually work. Please report errors in order to fix it.
-
-func (h *HamlibClient) GetData() (RigData, error) {
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", h.Host, h.Port))
-	if err != nil {
-		return RigData{}, fmt.Errorf("hamlib connection error: %w", err)
+// minimalPayload keeps only the key, radio, frequency and mode of a payload, for endpoints
+// that reject fields they do not know. The other fields are all omitted when empty.
+func minimalPayload(payload WavelogJSONRequest) WavelogJSONRequest {
+	return WavelogJSONRequest{
+		Key:       payload.Key,
+		Radio:     payload.Radio,
+		Frequency: payload.Frequency,
+		Mode:      payload.Mode,
 	}
-	defer conn.Close()
-
-	reader := bufio.NewReader(conn)
-	data := RigData{}
+}
 
-	// Query Frequency (VFO A)
-	if _, err := fmt.Fprintf(conn, "f\n"); err != nil {
-		return RigData{}, fmt.Errorf("failed to send 'f' command to hamlib: %w", err)
+// proxyURL parses a proxy address, adding scheme when the address has none.
+func proxyURL(addr, scheme string) (*url.URL, error) {
+	if !strings.Contains(addr, "://") {
+		addr = scheme + "://" + addr
 	}
-	freqStr, _, err := reader.ReadLine()
+	u, err := url.Parse(addr)
 	if err != nil {
-		return RigData{}, fmt.Errorf("failed to read frequency response from hamlib: %w", err)
-	}
-	data.FreqVFOA, err = strconv.ParseFloat(string(freqStr), 64)
-	if err != nil {
-		return RigData{}, fmt.Errorf("failed to parse frequency '%s': %w", freqStr, err)
+		return nil, fmt.Errorf("invalid proxy '%s': %w", addr, err)
 	}
+	return u, nil
+}
 
-	// Query Mode (TX/RX mode is assumed to be the same, and no separate RX mode is readily available)
-	if _, err := fmt.Fprintf(conn, "m\n"); err != nil {
-		return RigData{}, fmt.Errorf("failed to send 'm' command to hamlib: %w", err)
+// newWavelogClient returns the HTTP client shared by all Wavelog updates for a profile.
+func newWavelogClient(config ProfileConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		log.Warnf("TLS certificate verification for Wavelog is DISABLED (insecure_skip_verify). Connections can be intercepted!")
 	}
-	modeResp, _, err := reader.ReadLine() // e.g., "USB 2400"
-	if err != nil {
-		return RigData{}, fmt.Errorf("failed to read mode response from hamlib: %w", err)
+	// The cloned transport already uses HTTP_PROXY/HTTPS_PROXY/NO_PROXY from the environment
+	switch {
+	case config.SocksProxy != "":
+		proxy, err := proxyURL(config.SocksProxy, "socks5")
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		log.Infof("Connecting to Wavelog through SOCKS proxy %s", proxy.Host)
+	case config.HTTPProxy != "":
+		proxy, err := proxyURL(config.HTTPProxy, "http")
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		log.Infof("Connecting to Wavelog through HTTP proxy %s", proxy.Host)
 	}
-	modeParts := strings.Fields(string(modeResp))
-	if len(modeParts) > 0 {
-		data.Mode = modeParts[0]
-		data.ModeB = modeParts[0] // Default modeB to Mode/RX for simplicity
-	} else {
-		return RigData{}, fmt.Errorf("invalid mode response format from hamlib: '%s'", modeResp)
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}, nil
+}
+
+// defaultAPIPath is the path of Wavelog's radio API below the Wavelog URL.
+const defaultAPIPath = "/api/radio"
+
+// radioAPIURL returns the URL updates are posted to: wavelog_url followed by api_path.
+func radioAPIURL(config ProfileConfig) string {
+	path := config.APIPath
+	if path == "" {
+		path = defaultAPIPath
 	}
+	return strings.TrimSuffix(config.WavelogURL, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// postOffline sends the final clear_on_exit update: the state last sent with zero power
+// and PTT off. The last frequency is kept so the logbook still knows where the radio was.
+func postOffline(client *http.Client, config ProfileConfig, last RigData, apiURL *string) error {
+	offline := last
+	offline.Power = 0
+	offline.NoPower = false
+	offline.PTT = false
+	offline.ReadAt = time.Now()
+	return postToWavelog(client, config, offline, apiURL)
+}
 
-	// Query Power (P)
-	if _, err := fmt.Fprintf(conn, "P\n"); err != nil {
-		log.Warnf("Failed to send 'P' (power) command to hamlib: %v. Sending 0 W.", err)
-		data.Power = 0.0
+// alternateAPIURL returns the radio API URL with index.php added to or removed from
+// wavelog_url, as Wavelog answers on one or the other depending on how its web server
+// rewrites URLs.
+func alternateAPIURL(config ProfileConfig) string {
+	base := strings.TrimSuffix(config.WavelogURL, "/")
+	if trimmed, ok := strings.CutSuffix(base, "/index.php"); ok {
+		config.WavelogURL = trimmed
 	} else {
-		powerStr, _, err := reader.ReadLine()
-		if err != nil {
-			log.Warnf("Failed to read power response from hamlib: %v. Sending 0 W.", err)
-			data.Power = 0.0
-		} else {
-			// Hamlib returns 0-100 float percentage
-			powerPercent, err := strconv.ParseFloat(string(powerStr), 64)
-			if err != nil {
-				log.Warnf("Failed to parse power '%s': %v. Sending 0 W.", powerStr, err)
-				data.Power = 0.0
-			} else {
-				// Convert percentage to 100W max for simple display (Wavelog typically expects watts)
-				data.Power = powerPercent
-			}
-		}
+		config.WavelogURL = base + "/index.php"
 	}
+	return radioAPIURL(config)
+}
 
-	// WaveLogGate doesn't try either
-	data.Split = 0
-	data.FreqVFOB = data.FreqVFOA
+// wavelogStatusError is a non-200 response from the Wavelog API.
+type wavelogStatusError struct {
+	Code int
+	Body string
+}
 
-	return data, nil
+func (e *wavelogStatusError) Error() string {
+	return fmt.Sprintf("wavelog API returned non-200 status code: %d. Body: %s", e.Code, e.Body)
 }
 
-func postToWavelog(config ProfileConfig, data RigData) error {
-	payload := WavelogJSONRequest{
-		Key:       config.WavelogKey,
-		Radio:     config.RadioName,
-		Power:     data.Power,
-		Frequency: int(data.FreqVFOA),
-		Mode:      data.Mode,
+// postToWavelog sends the radio state to *apiURL, or to the configured radio API URL
+// while *apiURL is "". Until an update has succeeded, a 404 is retried once on the
+// alternateAPIURL; the URL that answers is kept in *apiURL for later updates.
+func postToWavelog(client *http.Client, config ProfileConfig, data RigData, apiURL *string) error {
+	if *apiURL != "" {
+		return postToAPIURL(client, *apiURL, config, data)
 	}
-	if data.Split != 0 {
-		payload.Frequency = int(data.FreqVFOB)
-		payload.Mode = data.ModeB
-		payload.FrequencyRX = int(data.FreqVFOA)
-		payload.ModeRX = data.Mode
+	url := radioAPIURL(config)
+	err := postToAPIURL(client, url, config, data)
+	var statusErr *wavelogStatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		alternate := alternateAPIURL(config)
+		log.Debugf("Wavelog answered 404 at %s; trying %s", url, alternate)
+		if postToAPIURL(client, alternate, config, data) != nil {
+			return err
+		}
+		url, err = alternate, nil
 	}
+	if err == nil {
+		log.Infof("Wavelog radio API found at %s", url)
+		*apiURL = url
+	}
+	return err
+}
 
+func postToAPIURL(client *http.Client, url string, config ProfileConfig, data RigData) error {
+	payload := buildPayload(config, data)
+	if config.MinimalPayload {
+		payload = minimalPayload(payload)
+	}
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON payload: %w", err)
 	}
-	url := config.WavelogURL + "/api/radio"
 	log.Infof("Sending to %s: %s", url, string(jsonPayload))
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
@@ -292,17 +2327,31 @@ func postToWavelog(config ProfileConfig, data RigData) error {
 
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent(config))
 
-	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to execute HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("wavelog API returned non-200 status code: %d. Body: %s", resp.StatusCode, string(body))
+		return &wavelogStatusError{Code: resp.StatusCode, Body: string(body)}
+	}
+	log.Debugf("Wavelog response: %s", string(body))
+
+	// Wavelog may report a failure in the body of a 200 response
+	var apiResp WavelogJSONResponse
+	if err := json.Unmarshal(body, &apiResp); err == nil {
+		switch strings.ToLower(apiResp.Status) {
+		case "error", "failed", "failure":
+			reason := apiResp.Reason
+			if reason == "" {
+				reason = apiResp.Message
+			}
+			return fmt.Errorf("wavelog API reported status '%s': %s", apiResp.Status, reason)
+		}
 	}
 
 	return nil
@@ -310,38 +2359,147 @@ func postToWavelog(config ProfileConfig, data RigData) error {
 
 func main() {
 	defaultConfig := ProfileConfig{
-		WavelogURL: "http://localhost/index.php",
-		WavelogKey: "YOUR_API_KEY",
-		RadioName:  "RIG",
-		FlrigHost:  "127.0.0.1",
-		FlrigPort:  12345,
-		HamlibHost: "127.0.0.1",
-		HamlibPort: 4532,
-		Interval:   "1s",
-		DataSource: "flrig",
-		LogLevel:   "error",
+		WavelogURL:           "http://localhost/index.php",
+		WavelogKey:           "YOUR_API_KEY",
+		RadioName:            "RIG",
+		FlrigHost:            "127.0.0.1",
+		FlrigPort:            12345,
+		FlrigScheme:          "http",
+		HamlibHost:           "127.0.0.1",
+		HamlibPort:           4532,
+		Interval:             "1s",
+		DataSource:           "flrig",
+		LogLevel:             "error",
+		GpsdHost:             "127.0.0.1",
+		GpsdPort:             defaultGpsdPort,
+		LogMaxSize:           defaultLogMaxSize,
+		LogMaxFiles:          defaultLogMaxFiles,
+		SyslogFacility:       defaultSyslogFacility,
+		SyslogTag:            defaultSyslogTag,
+		HamlibTimeout:        "3s",
+		HamlibConnectTimeout: "5s",
+		HamlibKeepAlive:      "30s",
+		MaxUpdateInterval:    "1m",
+		SSBSideband:          "auto",
+		PacketModes:          "data",
+		ImplausiblePower:     "clamp",
 	}
 
 	var currentProfileName string
 	var saveProfileName string
 	var setDefaultProfileName string
+	var exportProfileName string
+	var importProfileName string
+	var diffProfileName string
 
 	showVersion := flag.Bool("version", false, "Print version information and exit")
+	traceWire := flag.Bool("trace", false, "Log every raw command and response exchanged with rigctld (same as -log-level=trace).")
+	runInit := flag.Bool("init", false, "Interactively set up the selected profile (default 'default'), check connectivity, save it as the default profile and exit.")
+	attach := flag.String("attach", "", "Connect to the status server (status_listen address, e.g. 127.0.0.1:8080) of a running instance and print its updates as they are sent, then exit on Ctrl-C.")
+	printSchema := flag.Bool("schema", false, "Print a JSON Schema of the configuration file, with descriptions and valid values of each setting, and exit.")
+	watch := flag.Bool("watch", false, "Print each radio state change to stdout as a line of JSON instead of sending it to Wavelog (logs stay on stderr).")
+	useTUI := flag.Bool("tui", false, "Show a full-screen live status display instead of scrolling logs.")
+	testAllProfiles := flag.Bool("test-all-profiles", false, "Read the radio and check Wavelog is reachable for every profile in the configuration file, print a summary and exit (nothing is sent to Wavelog).")
+	benchmarkPolls := flag.Int("benchmark-poll", 0, "Read the radio this many times, print latency statistics and exit (nothing is sent to Wavelog).")
+	configPathFlag := flag.String("config", "", "Path to the configuration file (overrides the default location).")
+	serviceCommand := flag.String("service", "", "Windows service control: 'install' (with the other flags given), 'uninstall', 'start' or 'stop'.")
 
 	flag.StringVar(&currentProfileName, "profile", "", "Select a named configuration profile to run (overrides default).")
 	flag.StringVar(&saveProfileName, "save-profile", "", "Saves the current configuration flags (excluding this flag) to the specified profile name and exits.")
 	flag.StringVar(&setDefaultProfileName, "set-default-profile", "", "Sets the default profile to the specified name and exits.")
+	flag.StringVar(&exportProfileName, "export-profile", "", "Writes the named profile, without its API key, flrig password or MQTT password, to the file given as the next argument and exits.")
+	flag.StringVar(&diffProfileName, "diff-config", "", "Prints the settings that differ between this profile and the one given as the next argument and exits.")
+	flag.StringVar(&importProfileName, "import-profile", "", "Reads a profile from the file given as the next argument, saves it under this name and exits.")
 
 	wavelogURL := flag.String("wavelog-url", defaultConfig.WavelogURL, "Wavelog API URL for radio status.")
 	wavelogKey := flag.String("wavelog-key", defaultConfig.WavelogKey, "Wavelog API Key.")
-	radioName := flag.String("radio-name", defaultConfig.RadioName, "Name of the radio (e.g., FT-891).")
+	radioName := flag.String("radio-name", defaultConfig.RadioName, "Name of the radio (e.g., FT-891); {band} and {mode} are replaced with the current band and mode.")
 	flrigHost := flag.String("flrig-host", defaultConfig.FlrigHost, "flrig XML-RPC host address.")
 	flrigPort := flag.Int("flrig-port", defaultConfig.FlrigPort, "flrig XML-RPC port.")
 	hamlibHost := flag.String("hamlib-host", defaultConfig.HamlibHost, "Hamlib rigctld host address.")
 	hamlibPort := flag.Int("hamlib-port", defaultConfig.HamlibPort, "Hamlib rigctld port.")
 	interval := flag.String("interval", defaultConfig.Interval, "Polling interval (e.g., 1s, 1500ms).")
-	dataSource := flag.String("data-source", defaultConfig.DataSource, "Data source: 'flrig' or 'hamlib'.")
-	logLevel := flag.String("log-level", defaultConfig.LogLevel, "Logging level: 'debug', 'info', 'warn', or 'error'.")
+	intervalJitter := flag.Int("interval-jitter", defaultConfig.IntervalJitter, "Randomize each polling interval by up to this percentage (0-100).")
+	dataSource := flag.String("data-source", defaultConfig.DataSource, "Data source: 'flrig', 'hamlib', 'serial' (runs rigctld on -serial-port) or 'auto' (whichever of flrig and rigctld answers).")
+	logLevel := flag.String("log-level", defaultConfig.LogLevel, "Logging level: 'trace', 'debug', 'info', 'warn', or 'error'.")
+	satellite := flag.Bool("satellite", defaultConfig.Satellite, "Mark this profile as a satellite station; cross-band VHF/UHF split is sent with prop_mode=SAT.")
+	satName := flag.String("sat-name", defaultConfig.SatName, "Satellite name sent with prop_mode=SAT (e.g., SO-50).")
+	gridSquare := flag.String("grid-square", defaultConfig.GridSquare, "Station Maidenhead grid square sent to Wavelog (e.g., FN31pr).")
+	gpsd := flag.Bool("gpsd", defaultConfig.Gpsd, "Read the grid square from gpsd, falling back to -grid-square without a fix.")
+	gpsdHost := flag.String("gpsd-host", defaultConfig.GpsdHost, "gpsd host address.")
+	gpsdPort := flag.Int("gpsd-port", defaultConfig.GpsdPort, "gpsd port.")
+	userAgentFlag := flag.String("user-agent", defaultConfig.UserAgent, "User-Agent header sent to Wavelog (default \"WaveLogGoat/<version> (<radio-name>)\").")
+	logFile := flag.String("log-file", defaultConfig.LogFile, "Write logs to this file, rotated by size, instead of stderr.")
+	logMaxSize := flag.Int("log-max-size", defaultConfig.LogMaxSize, "Size in megabytes at which the log file is rotated.")
+	logMaxFiles := flag.Int("log-max-files", defaultConfig.LogMaxFiles, "Number of rotated log files to keep.")
+	logFrequencyUnit := flag.String("log-frequency-unit", defaultConfig.LogFrequencyUnit, "Unit of frequencies in log messages: 'hz', 'khz' or 'mhz' (default Hz).")
+	logFrequencyDecimals := flag.Int("log-frequency-decimals", defaultConfig.LogFrequencyDecimals, "Decimal places of logged frequencies; 0 shows them to the Hz in -log-frequency-unit.")
+	logTimestampFormat := flag.String("log-timestamp-format", defaultConfig.LogTimestampFormat, "Log timestamp format: 'rfc3339', 'rfc3339nano', 'datetime', 'timeonly' or a Go time layout (e.g. '15:04:05.000').")
+	logTargetFlag := flag.String("log-target", defaultConfig.LogTarget, "Where to log: 'stderr', 'file' (log-file) or 'syslog'. Empty uses the log file when one is set.")
+	syslogFacility := flag.String("syslog-facility", defaultConfig.SyslogFacility, "Syslog facility when logging to syslog, e.g. 'user', 'daemon' or 'local0'.")
+	syslogTag := flag.String("syslog-tag", defaultConfig.SyslogTag, "Syslog tag when logging to syslog.")
+	insecureSkipVerify := flag.Bool("insecure-skip-verify", defaultConfig.InsecureSkipVerify, "Do not verify Wavelog's TLS certificate (for self-signed certificates). Insecure!")
+	hookOnBandChange := flag.Bool("hook-on-band-change", defaultConfig.HookOnBandChange, "Run the on-change command only on band changes, not while tuning within a band.")
+	bandChangeHz := flag.Float64("band-change-hz", defaultConfig.BandChangeHz, "Treat a frequency move larger than this many Hz as a band change even within a band; 0 counts only band boundary crossings.")
+	onChangeCommand := flag.String("on-change-command", defaultConfig.OnChangeCommand, "Shell command run after each Wavelog update, with WAVELOGGOAT_* environment variables describing the radio state.")
+	autoRadioName := flag.Bool("auto-radio-name", defaultConfig.AutoRadioName, "Use the rig model reported by flrig or hamlib as the radio name when -radio-name is not set.")
+	hamlibTimeout := flag.String("hamlib-timeout", defaultConfig.HamlibTimeout, "Deadline for each rigctld command (e.g., 3s).")
+	sendBandwidth := flag.Bool("send-bandwidth", defaultConfig.SendBandwidth, "Include the filter passband as bandwidth (and bandwidth_rx in split) in the Wavelog payload.")
+	maxUpdateIntervalFlag := flag.String("max-update-interval", defaultConfig.MaxUpdateInterval, "Resend the current state to Wavelog if nothing changed for this long (e.g., 1m), so it does not show the radio as offline.")
+	httpProxy := flag.String("http-proxy", defaultConfig.HTTPProxy, "HTTP proxy URL for the Wavelog connection (default: HTTP_PROXY/HTTPS_PROXY environment).")
+	socksProxy := flag.String("socks-proxy", defaultConfig.SocksProxy, "SOCKS5 proxy (host:port or socks5:// URL) for the Wavelog connection.")
+	stationID := flag.String("station-id", defaultConfig.StationID, "Station/operator position identifier sent to Wavelog as station_id (for multi-op stations).")
+	followPTT := flag.Bool("follow-ptt", defaultConfig.FollowPTT, "In split, send the RX frequency and mode as the primary frequency while receiving and switch to TX only while PTT is keyed.")
+	suppressHamlibWarning := flag.Bool("suppress-hamlib-warning", defaultConfig.SuppressHamlibWarning, "Do not show the warning that hamlib support is untested.")
+	ssbSideband := flag.String("ssb-sideband", defaultConfig.SSBSideband, "Send a bare SSB mode as 'usb', 'lsb', or by band convention with 'auto' (LSB below 10 MHz except 60m); 'off' sends SSB unchanged.")
+	postOnTXOnly := flag.Bool("post-on-tx-only", defaultConfig.PostOnTXOnly, "Only update Wavelog while PTT is keyed, plus one update with the final state when transmitting stops.")
+	dataSourcesFlag := flag.String("data-sources", "", "Comma-separated data sources in order of preference (e.g., flrig,hamlib); fails over when one is down. Overrides -data-source.")
+	sendTimestamp := flag.String("send-timestamp", defaultConfig.SendTimestamp, "Include the time the radio was read in the payload as 'rfc3339' or 'epoch' (Unix seconds); empty to omit.")
+	packetModes := flag.String("packet-modes", defaultConfig.PacketModes, "Send hamlib packet modes (PKTUSB, PKTLSB, PKTFM, ...) as 'data' (DATA) or 'sideband' (USB, LSB, FM).")
+	dataModesFlag := flag.String("data-modes", "", "Comma-separated modes to send to Wavelog as DATA (e.g., FT8,RTTY).")
+	sendSubmode := flag.Bool("send-submode", defaultConfig.SendSubmode, "Send the submode split from vendor mode strings (e.g., USB-D as DATA/USB) or the original mode of a -data-modes rewrite.")
+	powerOnTXOnly := flag.Bool("power-on-tx-only", defaultConfig.PowerOnTXOnly, "While receiving, send the power of the last transmission (0 before the first) instead of the rig's set power level.")
+	hamlibConnectTimeout := flag.String("hamlib-connect-timeout", defaultConfig.HamlibConnectTimeout, "Deadline for connecting to rigctld (e.g., 5s), separate from -hamlib-timeout.")
+	hamlibKeepAlive := flag.String("hamlib-keepalive", defaultConfig.HamlibKeepAlive, "TCP keepalive period for the persistent rigctld connection (e.g., 30s); 0 to disable.")
+	waitForRadio := flag.Bool("wait-for-radio", defaultConfig.WaitForRadio, "Wait quietly for the first successful radio read before starting normal operation, logging failures until then only at debug level.")
+	clearOnExit := flag.Bool("clear-on-exit", defaultConfig.ClearOnExit, "On clean shutdown, send a final update with zero power so Wavelog does not show the radio as transmitting.")
+	flrigScheme := flag.String("flrig-scheme", defaultConfig.FlrigScheme, "flrig XML-RPC scheme: 'http', or 'https' for flrig behind a TLS reverse proxy.")
+	flrigUser := flag.String("flrig-user", defaultConfig.FlrigUser, "HTTP basic auth user for flrig, if required by a reverse proxy.")
+	flrigPassword := flag.String("flrig-password", defaultConfig.FlrigPassword, "HTTP basic auth password for flrig.")
+	modeSettle := flag.String("mode-settle", defaultConfig.ModeSettle, "Only send a mode change once the new mode has been reported for this long (e.g., 2s), ignoring transient modes; frequency changes are still sent at once.")
+	sendSWR := flag.Bool("send-swr", defaultConfig.SendSWR, "Include the SWR meter reading (while transmitting) in the Wavelog payload.")
+	radioNameSource := flag.Bool("radio-name-source", defaultConfig.RadioNameSource, "Append the data source to the radio name sent to Wavelog (e.g., FT-891-flrig), to tell backends for the same rig apart.")
+	sendBand := flag.Bool("send-band", defaultConfig.SendBand, "Include the band of the frequency (e.g. 20m) in the Wavelog payload.")
+	sendVersion := flag.Bool("send-version", defaultConfig.SendVersion, "Include the WaveLogGoat version in the Wavelog payload as 'software'.")
+	powerChangeThreshold := flag.String("power-change-threshold", defaultConfig.PowerChangeThreshold, "Only send a power change on its own when it exceeds this, in watts (e.g. 5) or percent (e.g. 10%).")
+	minimalPayloadFlag := flag.Bool("minimal-payload", defaultConfig.MinimalPayload, "Send Wavelog only the key, radio, frequency and mode, for endpoints that reject other fields.")
+	errorSummaryEvery := flag.Int("error-summary-every", defaultConfig.ErrorSummaryEvery, "Log an identical repeated radio read or Wavelog post error only once, then again every this many times (0 for the default of 60).")
+	logRepeatedErrors := flag.Bool("log-repeated-errors", defaultConfig.LogRepeatedErrors, "Log every repeated radio read or Wavelog post error instead of periodic summaries.")
+	parseRetriesFlag := flag.Int("parse-retries", defaultParseRetries, "Re-read the radio up to this many times (0-5) when the backend returns a malformed response.")
+	serialPort := flag.String("serial-port", defaultConfig.SerialPort, "Serial port of a directly attached rig (e.g., /dev/ttyUSB0 or COM3), for -data-source serial.")
+	baud := flag.Int("baud", defaultConfig.Baud, "Serial port speed for -data-source serial; 0 uses the rig's default.")
+	rigModel := flag.Int("rig-model", defaultConfig.RigModel, "Hamlib rig model number (see 'rigctl -l') for -data-source serial.")
+	rigctldPath := flag.String("rigctld-path", defaultConfig.RigctldPath, "rigctld executable to run for -data-source serial (default: rigctld from the PATH).")
+	transverterOffsetHz := flag.Float64("transverter-offset-hz", defaultConfig.TransverterOffsetHz, "Add this many Hz to the frequencies read from the rig, for a transverter (e.g., 116000000 for 2m on a 28 MHz IF).")
+	maxPlausiblePower := flag.Float64("max-plausible-power", defaultConfig.MaxPlausiblePower, "Treat power readings above this many watts as garbage from the backend; 0 accepts any value.")
+	implausiblePower := flag.String("implausible-power", defaultConfig.ImplausiblePower, "What to do with a power reading above -max-plausible-power: 'clamp' it to the maximum or 'drop' it from the update.")
+	readIFShift := flag.Bool("read-if-shift", defaultConfig.ReadIFShift, "Also read the IF shift and report the filter width each poll for -tui and the status endpoint (not sent to Wavelog).")
+	readReceiverState := flag.Bool("read-receiver-state", defaultConfig.ReadReceiverState, "Also read the AGC, preamp and attenuator settings each poll for -tui and the status endpoint (not sent to Wavelog).")
+	bandAllowlistFlag := flag.String("band-allowlist", "", "Comma-separated bands to update Wavelog on (e.g., 20m,40m); other frequencies are skipped unless in -freq-ranges.")
+	freqRangesFlag := flag.String("freq-ranges", "", "Comma-separated frequency ranges in Hz to update Wavelog on (e.g., 14000000-14350000), in addition to -band-allowlist.")
+	mqttBroker := flag.String("mqtt-broker", defaultConfig.MQTTBroker, "Also publish each radio state change as JSON to this MQTT broker (e.g., tcp://localhost:1883, ssl://broker:8883).")
+	mqttTopic := flag.String("mqtt-topic", defaultConfig.MQTTTopic, "MQTT topic to publish the radio state on (default waveloggoat/radio).")
+	mqttUser := flag.String("mqtt-user", defaultConfig.MQTTUser, "Username for the MQTT broker.")
+	mqttPassword := flag.String("mqtt-password", defaultConfig.MQTTPassword, "Password for the MQTT broker.")
+	mqttRetain := flag.Bool("mqtt-retain", defaultConfig.MQTTRetain, "Publish the radio state as a retained MQTT message, so new subscribers receive the current state at once.")
+	vfoBSplitOnly := flag.Bool("vfo-b-split-only", defaultConfig.VFOBSplitOnly, "With flrig, read the VFO B frequency and mode only while split is on, saving two requests per poll in simplex (mode_rx is then not sent for a different VFO B mode without split).")
+	inferSplitFlag := flag.Bool("infer-split", defaultConfig.InferSplit, "With flrig, infer split when the rig cannot report it: VFO B differs from VFO A and was in use while transmitting.")
+	measuredPower := flag.Bool("measured-power", defaultConfig.MeasuredPower, "While transmitting, read the power meter and send the measured output instead of the set power level.")
+	historySize := flag.Int("history-size", defaultConfig.HistorySize, "Number of recent Wavelog updates listed at /history on the status server (default 20).")
+	checkClockFlag := flag.Bool("check-clock", defaultConfig.CheckClock, "Every 10 minutes compare the rig's clock with the system clock and warn on skew (rigctld with clock support only).")
+	clockSkewFlag := flag.String("clock-skew", defaultConfig.ClockSkew, "Clock skew to warn about with -check-clock (e.g., 2s).")
+	apiPath := flag.String("api-path", defaultConfig.APIPath, "Path of the radio API appended to -wavelog-url, for Cloudlog or a reverse proxy (default /api/radio).")
+	statusListen := flag.String("status-listen", defaultConfig.StatusListen, "Address (host:port) to serve the /status JSON endpoint on; empty to disable.")
 
 	// Parse flags initially to handle the special -save-profile and -set-default-profile flags
 	flag.Parse()
@@ -351,9 +2509,42 @@ func main() {
 		return
 	}
 
-	configPath, err := getConfigPath()
-	if err != nil {
-		log.Fatalf("Fatal: Could not determine configuration path: %v", err)
+	if *printSchema {
+		if err := writeConfigSchema(os.Stdout, defaultConfig); err != nil {
+			log.Fatalf("Fatal: Failed to write the schema: %v", err)
+		}
+		return
+	}
+
+	if *attach != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runAttach(ctx, *attach, os.Stdout); err != nil {
+			log.Fatalf("Fatal: %v", err)
+		}
+		return
+	}
+
+	configPath := *configPathFlag
+	if configPath == "" {
+		var err error
+		configPath, err = getConfigPath()
+		if err != nil {
+			log.Fatalf("Fatal: Could not determine configuration path: %v", err)
+		}
+	}
+
+	if *serviceCommand != "" {
+		// The service runs as another user, so pin it to this user's configuration file
+		args := serviceArgs(os.Args[1:])
+		if *configPathFlag == "" {
+			args = append(args, "-config", configPath)
+		}
+		if err := handleServiceCommand(*serviceCommand, args); err != nil {
+			log.Fatalf("Fatal: Service %s failed: %v", *serviceCommand, err)
+		}
+		fmt.Printf("Service %s succeeded.\n", *serviceCommand)
+		return
 	}
 
 	cfgFile := ConfigFile{
@@ -367,49 +2558,212 @@ func main() {
 		log.Warnf("Configuration file found but failed to load (%s). Starting with defaults. Error: %v", configPath, err)
 	}
 
-	profileToUse := cfgFile.DefaultProfile
-	if currentProfileName != "" {
-		profileToUse = currentProfileName
-	}
-	if profileToUse == "" {
-		profileToUse = "default"
-	}
-
-	// Merge configuration (Default -> File -> Flags)
-	currentProfileConfig := defaultConfig
-	if p, ok := cfgFile.Profiles[profileToUse]; ok {
-		currentProfileConfig = p
+	selectProfile := func(cfg ConfigFile) (string, ProfileConfig) {
+		name := cfg.DefaultProfile
+		if currentProfileName != "" {
+			name = currentProfileName
+		}
+		if name == "" {
+			name = "default"
+		}
+		// Merge configuration (Default -> File -> Flags)
+		if p, ok := cfg.Profiles[name]; ok {
+			return name, p
+		}
+		return name, defaultConfig
 	}
+	profileToUse, currentProfileConfig := selectProfile(cfgFile)
 
 	// Override config with command-line flags (only those that were set explicitly)
 	// We need to re-parse flags but track if they were explicitly set.
 	// Since the flag package doesn't natively expose "was set," we use the parsed values.
 	// This approach means if a flag is *not* passed, we use the profile config value.
-
-	flag.Visit(func(f *flag.Flag) {
-		switch f.Name {
-		case "wavelog-url":
-			currentProfileConfig.WavelogURL = *wavelogURL
-		case "wavelog-key":
-			currentProfileConfig.WavelogKey = *wavelogKey
-		case "radio-name":
-			currentProfileConfig.RadioName = *radioName
-		case "flrig-host":
-			currentProfileConfig.FlrigHost = *flrigHost
-		case "flrig-port":
-			currentProfileConfig.FlrigPort = *flrigPort
-		case "hamlib-host":
-			currentProfileConfig.HamlibHost = *hamlibHost
-		case "hamlib-port":
-			currentProfileConfig.HamlibPort = *hamlibPort
-		case "interval":
-			currentProfileConfig.Interval = *interval
-		case "data-source":
-			currentProfileConfig.DataSource = *dataSource
-		case "log-level":
-			currentProfileConfig.LogLevel = *logLevel
-		}
-	})
+	// The same overrides are applied to a profile reloaded on SIGHUP, so flags still win.
+	applyFlags := func(config *ProfileConfig) {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "wavelog-url":
+				config.WavelogURL = *wavelogURL
+			case "wavelog-key":
+				config.WavelogKey = *wavelogKey
+			case "radio-name":
+				config.RadioName = *radioName
+			case "flrig-host":
+				config.FlrigHost = *flrigHost
+			case "flrig-port":
+				config.FlrigPort = *flrigPort
+			case "hamlib-host":
+				config.HamlibHost = *hamlibHost
+			case "hamlib-port":
+				config.HamlibPort = *hamlibPort
+			case "interval":
+				config.Interval = *interval
+			case "interval-jitter":
+				config.IntervalJitter = *intervalJitter
+			case "data-source":
+				config.DataSource = *dataSource
+			case "log-level":
+				config.LogLevel = *logLevel
+			case "satellite":
+				config.Satellite = *satellite
+			case "sat-name":
+				config.SatName = *satName
+			case "grid-square":
+				config.GridSquare = *gridSquare
+			case "gpsd":
+				config.Gpsd = *gpsd
+			case "gpsd-host":
+				config.GpsdHost = *gpsdHost
+			case "gpsd-port":
+				config.GpsdPort = *gpsdPort
+			case "insecure-skip-verify":
+				config.InsecureSkipVerify = *insecureSkipVerify
+			case "on-change-command":
+				config.OnChangeCommand = *onChangeCommand
+			case "hook-on-band-change":
+				config.HookOnBandChange = *hookOnBandChange
+			case "band-change-hz":
+				config.BandChangeHz = *bandChangeHz
+			case "auto-radio-name":
+				config.AutoRadioName = *autoRadioName
+			case "hamlib-timeout":
+				config.HamlibTimeout = *hamlibTimeout
+			case "send-bandwidth":
+				config.SendBandwidth = *sendBandwidth
+			case "max-update-interval":
+				config.MaxUpdateInterval = *maxUpdateIntervalFlag
+			case "http-proxy":
+				config.HTTPProxy = *httpProxy
+			case "socks-proxy":
+				config.SocksProxy = *socksProxy
+			case "station-id":
+				config.StationID = *stationID
+			case "follow-ptt":
+				config.FollowPTT = *followPTT
+			case "suppress-hamlib-warning":
+				config.SuppressHamlibWarning = *suppressHamlibWarning
+			case "ssb-sideband":
+				config.SSBSideband = *ssbSideband
+			case "post-on-tx-only":
+				config.PostOnTXOnly = *postOnTXOnly
+			case "data-sources":
+				config.DataSources = splitList(*dataSourcesFlag)
+			case "data-modes":
+				config.DataModes = splitList(*dataModesFlag)
+			case "band-allowlist":
+				config.BandAllowlist = splitList(*bandAllowlistFlag)
+			case "freq-ranges":
+				config.FreqRanges = splitList(*freqRangesFlag)
+			case "send-timestamp":
+				config.SendTimestamp = *sendTimestamp
+			case "packet-modes":
+				config.PacketModes = *packetModes
+			case "send-submode":
+				config.SendSubmode = *sendSubmode
+			case "power-on-tx-only":
+				config.PowerOnTXOnly = *powerOnTXOnly
+			case "hamlib-keepalive":
+				config.HamlibKeepAlive = *hamlibKeepAlive
+			case "hamlib-connect-timeout":
+				config.HamlibConnectTimeout = *hamlibConnectTimeout
+			case "clear-on-exit":
+				config.ClearOnExit = *clearOnExit
+			case "wait-for-radio":
+				config.WaitForRadio = *waitForRadio
+			case "flrig-scheme":
+				config.FlrigScheme = *flrigScheme
+			case "flrig-user":
+				config.FlrigUser = *flrigUser
+			case "flrig-password":
+				config.FlrigPassword = *flrigPassword
+			case "mode-settle":
+				config.ModeSettle = *modeSettle
+			case "send-swr":
+				config.SendSWR = *sendSWR
+			case "send-band":
+				config.SendBand = *sendBand
+			case "radio-name-source":
+				config.RadioNameSource = *radioNameSource
+			case "send-version":
+				config.SendVersion = *sendVersion
+			case "power-change-threshold":
+				config.PowerChangeThreshold = *powerChangeThreshold
+			case "minimal-payload":
+				config.MinimalPayload = *minimalPayloadFlag
+			case "error-summary-every":
+				config.ErrorSummaryEvery = *errorSummaryEvery
+			case "log-repeated-errors":
+				config.LogRepeatedErrors = *logRepeatedErrors
+			case "parse-retries":
+				config.ParseRetries = parseRetriesFlag
+			case "serial-port":
+				config.SerialPort = *serialPort
+			case "baud":
+				config.Baud = *baud
+			case "rig-model":
+				config.RigModel = *rigModel
+			case "rigctld-path":
+				config.RigctldPath = *rigctldPath
+			case "max-plausible-power":
+				config.MaxPlausiblePower = *maxPlausiblePower
+			case "transverter-offset-hz":
+				config.TransverterOffsetHz = *transverterOffsetHz
+			case "implausible-power":
+				config.ImplausiblePower = *implausiblePower
+			case "read-receiver-state":
+				config.ReadReceiverState = *readReceiverState
+			case "read-if-shift":
+				config.ReadIFShift = *readIFShift
+			case "mqtt-broker":
+				config.MQTTBroker = *mqttBroker
+			case "mqtt-topic":
+				config.MQTTTopic = *mqttTopic
+			case "mqtt-user":
+				config.MQTTUser = *mqttUser
+			case "mqtt-password":
+				config.MQTTPassword = *mqttPassword
+			case "mqtt-retain":
+				config.MQTTRetain = *mqttRetain
+			case "measured-power":
+				config.MeasuredPower = *measuredPower
+			case "infer-split":
+				config.InferSplit = *inferSplitFlag
+			case "vfo-b-split-only":
+				config.VFOBSplitOnly = *vfoBSplitOnly
+			case "history-size":
+				config.HistorySize = *historySize
+			case "check-clock":
+				config.CheckClock = *checkClockFlag
+			case "clock-skew":
+				config.ClockSkew = *clockSkewFlag
+			case "api-path":
+				config.APIPath = *apiPath
+			case "status-listen":
+				config.StatusListen = *statusListen
+			case "user-agent":
+				config.UserAgent = *userAgentFlag
+			case "log-file":
+				config.LogFile = *logFile
+			case "log-max-size":
+				config.LogMaxSize = *logMaxSize
+			case "log-max-files":
+				config.LogMaxFiles = *logMaxFiles
+			case "log-frequency-unit":
+				config.LogFrequencyUnit = *logFrequencyUnit
+			case "log-frequency-decimals":
+				config.LogFrequencyDecimals = *logFrequencyDecimals
+			case "log-timestamp-format":
+				config.LogTimestampFormat = *logTimestampFormat
+			case "log-target":
+				config.LogTarget = *logTargetFlag
+			case "syslog-facility":
+				config.SyslogFacility = *syslogFacility
+			case "syslog-tag":
+				config.SyslogTag = *syslogTag
+			}
+		})
+	}
+	applyFlags(&currentProfileConfig)
 
 	if setDefaultProfileName != "" {
 		if _, ok := cfgFile.Profiles[setDefaultProfileName]; !ok {
@@ -423,6 +2777,62 @@ func main() {
 		return
 	}
 
+	if exportProfileName != "" {
+		if flag.NArg() != 1 {
+			log.Fatalf("Fatal: Usage: -export-profile <name> <file>")
+		}
+		if err := exportProfile(cfgFile, exportProfileName, flag.Arg(0)); err != nil {
+			log.Fatalf("Fatal: Failed to export profile: %v", err)
+		}
+		fmt.Printf("Profile '%s' exported to %s (API key, flrig password and MQTT password removed).\n", exportProfileName, flag.Arg(0))
+		return
+	}
+
+	if diffProfileName != "" {
+		if flag.NArg() != 1 {
+			log.Fatalf("Fatal: Usage: -diff-config <profileA> <profileB>")
+		}
+		if err := printProfileDiff(os.Stdout, cfgFile, diffProfileName, flag.Arg(0)); err != nil {
+			log.Fatalf("Fatal: Failed to compare profiles: %v", err)
+		}
+		return
+	}
+
+	if importProfileName != "" {
+		if flag.NArg() != 1 {
+			log.Fatalf("Fatal: Usage: -import-profile <name> <file>")
+		}
+		if err := importProfile(&cfgFile, importProfileName, flag.Arg(0)); err != nil {
+			log.Fatalf("Fatal: Failed to import profile: %v", err)
+		}
+		if err := saveConfig(configPath, cfgFile); err != nil {
+			log.Fatalf("Fatal: Failed to save configuration file: %v", err)
+		}
+		fmt.Printf("Profile '%s' imported from %s into %s\n", importProfileName, flag.Arg(0), configPath)
+		return
+	}
+
+	if *runInit {
+		if !isInteractive(os.Stdin) {
+			log.Fatalf("Fatal: -init needs an interactive terminal. Use -save-profile with flags to create a profile non-interactively.")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := runInitWizard(ctx, os.Stdin, os.Stdout, &cfgFile, profileToUse, currentProfileConfig, defaultConfig.WavelogKey)
+		stop()
+		if errors.Is(err, errWizardCancelled) {
+			fmt.Println("\nSetup cancelled; nothing was saved.")
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Fatalf("Fatal: Setup failed: %v", err)
+		}
+		if err := saveConfig(configPath, cfgFile); err != nil {
+			log.Fatalf("Fatal: Failed to save configuration file: %v", err)
+		}
+		fmt.Printf("Profile '%s' saved to %s and set as the default. Run WaveLogGoat without flags to start.\n", profileToUse, configPath)
+		return
+	}
+
 	if saveProfileName != "" {
 		if saveProfileName == "" {
 			log.Fatalf("Fatal: The --save-profile flag requires a profile name.")
@@ -435,65 +2845,343 @@ func main() {
 		return
 	}
 
-	setupLogging(currentProfileConfig.LogLevel)
+	logLevelFromFlag := false
+	flag.Visit(func(f *flag.Flag) { logLevelFromFlag = logLevelFromFlag || f.Name == "log-level" })
+	setupLogging(currentProfileConfig.LogLevel, currentProfileConfig.LogTimestampFormat, logLevelFromFlag)
+	if *traceWire {
+		log.SetLevel(logrus.TraceLevel)
+	}
+	setupLogOutput(currentProfileConfig)
 
-	if currentProfileConfig.WavelogKey == "" || currentProfileConfig.WavelogKey == defaultConfig.WavelogKey {
-		log.Fatalf("Fatal: Wavelog API key is required. Please set via --wavelog-key or in the config file.")
+	if *testAllProfiles {
+		if !testProfiles(cfgFile, defaultConfig.WavelogKey) {
+			os.Exit(1)
+		}
+		return
 	}
-	if currentProfileConfig.WavelogURL == "" {
-		log.Fatalf("Fatal: Wavelog URL is required.")
+
+	client, err := newRadioClient(currentProfileConfig)
+	if err != nil {
+		log.Fatalf("Fatal: %v", err)
 	}
+	logRadioClient(client, currentProfileConfig, profileToUse, configPath)
 
-	var client RadioClient
-	switch strings.ToLower(currentProfileConfig.DataSource) {
-	case "flrig":
-		client = &FlrigClient{Host: currentProfileConfig.FlrigHost, Port: currentProfileConfig.FlrigPort}
-		log.Infof("Using flrig client at %s:%d (Profile: %s)", currentProfileConfig.FlrigHost, currentProfileConfig.FlrigPort, profileToUse)
-	case "hamlib":
-		client = &HamlibClient{Host: currentProfileConfig.HamlibHost, Port: currentProfileConfig.HamlibPort}
-		log.Infof("Using Hamlib client at %s:%d (Profile: %s)", currentProfileConfig.HamlibHost, currentProfileConfig.HamlibPort, profileToUse)
-		log.Warnf("Hamlib support is untested and presumed broken. Please report success or failure to debug or remove this message!")
-	default:
-		log.Fatalf("Fatal: Invalid data source specified: '%s'. Must be 'flrig' or 'hamlib'.", currentProfileConfig.DataSource)
+	if *benchmarkPolls > 0 {
+		benchmarkPoll(client, *benchmarkPolls)
+		return
+	}
+
+	if *watch {
+		// Watching never contacts Wavelog, so it needs no URL or key
+		if *useTUI {
+			log.Fatalf("Fatal: -watch and -tui both use stdout and cannot be combined.")
+		}
+	} else if err := validateProfile(currentProfileConfig, defaultConfig.WavelogKey); err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	settings, err := parseRunSettings(currentProfileConfig)
+	if err != nil {
+		log.Fatalf("Fatal: %v", err)
 	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	intervalDuration, err := time.ParseDuration(currentProfileConfig.Interval)
+	newGpsdClient := func(config ProfileConfig) *GpsdClient {
+		if !config.Gpsd {
+			return nil
+		}
+		gpsd := &GpsdClient{Host: config.GpsdHost, Port: config.GpsdPort}
+		log.Infof("Using gpsd at %s for grid square", gpsd.Address())
+		return gpsd
+	}
+	gpsdClient := newGpsdClient(currentProfileConfig)
+
+	httpClient, err := newWavelogClient(currentProfileConfig)
 	if err != nil {
-		log.Fatalf("Fatal: Invalid interval duration format: %v", err)
+		log.Fatalf("Fatal: %v", err)
+	}
+
+	// The model is read after the first successful poll, when the backend is known to be up
+	identifier, canIdentify := client.(RadioIdentifier)
+	needRadioName := currentProfileConfig.AutoRadioName && currentProfileConfig.RadioName == defaultConfig.RadioName && canIdentify
+
+	status := NewStatus(currentProfileConfig.HistorySize)
+	duty := status.DutyCycle()
+	if currentProfileConfig.StatusListen != "" {
+		// Tolerate a couple of slow or jittered polls before reporting unhealthy
+		healthWindow := 3*settings.interval + 10*time.Second
+		startStatusServer(currentProfileConfig.StatusListen, status, healthWindow)
+	}
+
+	var tui *TUI
+	if *useTUI {
+		tui = NewTUI(os.Stdout, profileToUse, currentProfileConfig.DataSource)
+		tui.Start()
+		defer tui.Stop()
 	}
 
+	// Stop cleanly on Ctrl-C, SIGTERM, or a stop request from the Windows service manager
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, serviceDone := serviceContext(ctx)
+	defer serviceDone()
+	// The client and publisher may be replaced by a reload, so close whichever is current
+	defer func() { closeRadioClient(client) }()
+
+	var publisher *MQTTPublisher
+	if currentProfileConfig.MQTTBroker != "" && !*watch {
+		publisher = newMQTTPublisher(currentProfileConfig)
+	}
+	defer func() {
+		if publisher != nil {
+			publisher.Close()
+		}
+	}()
+
+	sdNotifier := NewSDNotifier()
+
 	var lastData RigData
 	lastUpdate := time.Time{}
-	log.Infof("Starting WaveLogGoat polling every %s...", intervalDuration)
+	var apiURL string // the radio API URL Wavelog answered on, found by the first update
+	log.Infof("Starting WaveLogGoat polling every %s...", settings.interval)
+
+	var pollErr error
+	// With wait_for_radio, errors before the first successful read are expected while the
+	// radio or its backend is still starting
+	waitingForRadio := currentProfileConfig.WaitForRadio
+	waitAttempts := 0
+	readErrors, postErrors := newRepeatFilter(currentProfileConfig), newRepeatFilter(currentProfileConfig)
+	var txPower txPowerMemory
+	var lastClockCheck time.Time
+	modes := &modeDebouncer{settle: settings.modeSettle}
+
+	// reloadConfig re-reads the configuration file and switches to the updated profile. On
+	// any error the running configuration is kept.
+	reloadConfig := func() error {
+		loaded, err := loadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		name, config := selectProfile(loaded)
+		applyFlags(&config)
+		if !*watch {
+			if err := validateProfile(config, defaultConfig.WavelogKey); err != nil {
+				return err
+			}
+		}
+		newSettings, err := parseRunSettings(config)
+		if err != nil {
+			return err
+		}
+		newHTTPClient, err := newWavelogClient(config)
+		if err != nil {
+			return err
+		}
+		newClient := client
+		if !sameSettings(config, currentProfileConfig, radioSettings) {
+			if newClient, err = newRadioClient(config); err != nil {
+				return err
+			}
+			closeRadioClient(client)
+			logRadioClient(newClient, config, name, configPath)
+		}
+		if !sameSettings(config, currentProfileConfig, mqttSettings) {
+			if publisher != nil {
+				publisher.Close()
+				publisher = nil
+			}
+			if config.MQTTBroker != "" && !*watch {
+				publisher = newMQTTPublisher(config)
+			}
+		}
+		if config.StatusListen != currentProfileConfig.StatusListen {
+			log.Warnf("status_listen changed to '%s'; restart WaveLogGoat for it to take effect.", config.StatusListen)
+		}
+		if config.HistorySize != currentProfileConfig.HistorySize {
+			log.Warnf("history_size changed to %d; restart WaveLogGoat for it to take effect.", config.HistorySize)
+		}
+
+		setupLogging(config.LogLevel, config.LogTimestampFormat, logLevelFromFlag)
+		if *traceWire {
+			log.SetLevel(logrus.TraceLevel)
+		}
+		if !sameSettings(config, currentProfileConfig, logSettings) {
+			setupLogOutput(config)
+			if tui != nil {
+				tui.logOut = log.Out
+				log.SetOutput(tui)
+			}
+		}
+
+		client, httpClient, settings = newClient, newHTTPClient, newSettings
+		if !sameSettings(config, currentProfileConfig, gpsdSettings) {
+			gpsdClient = newGpsdClient(config)
+		}
+		identifier, canIdentify = client.(RadioIdentifier)
+		needRadioName = config.AutoRadioName && config.RadioName == defaultConfig.RadioName && canIdentify
+		modes.settle = settings.modeSettle
+		readErrors.Every = newRepeatFilter(config).Every
+		postErrors.Every = readErrors.Every
+		if config.WavelogURL != currentProfileConfig.WavelogURL || config.APIPath != currentProfileConfig.APIPath {
+			apiURL = ""
+		}
+		profileToUse, currentProfileConfig = name, config
+		// Send the state again, as the new profile may report it differently
+		lastData, lastUpdate = RigData{}, time.Time{}
+		log.Infof("Reloaded profile '%s' from %s", profileToUse, configPath)
+		return nil
+	}
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
 
 	for {
-		time.Sleep(intervalDuration)
+		if tui != nil {
+			tui.Render(status, pollErr)
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("Shutting down.")
+			sdNotifier.Stopping()
+			if currentProfileConfig.ClearOnExit && !*watch && !lastUpdate.IsZero() {
+				if err := postOffline(httpClient, currentProfileConfig, lastData, &apiURL); err != nil {
+					log.Errorf("Error sending final update to Wavelog: %v", err)
+				} else {
+					log.Info("Sent final zero-power update to Wavelog.")
+				}
+			}
+			return
+		case <-reload:
+			if err := reloadConfig(); err != nil {
+				log.Errorf("Failed to reload configuration, keeping the current one: %v", err)
+			}
+			continue
+		case <-time.After(jitteredInterval(settings.interval, currentProfileConfig.IntervalJitter, rng)):
+		}
 
-		currentData, err := client.GetData()
+		currentData, err := readRadio(client, parseRetries(currentProfileConfig))
+		currentData.ReadAt = time.Now()
+		pollErr = err
 		if err != nil {
 			// Do not be noisy about connection errors, because flrig or hamlib may not yet/currently be started.
 			// Wait patiently.
-			var netErr net.Error
-			if errors.As(err, &netErr) && netErr.Timeout() || strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "dial tcp") {
+			if waitingForRadio {
+				if waitAttempts++; waitAttempts%10 == 1 {
+					log.Debugf("Waiting for the radio to become reachable (attempt %d): %v", waitAttempts, err)
+				}
+			} else if errors.Is(err, errRigPoweredOff) {
+				log.Debug("Rig powered off. Waiting for it to be switched on.")
+			} else if show, count := readErrors.Allow(err); !show {
+				log.Tracef("Error fetching radio data repeated %d times: %v", count, err)
+			} else if isTransientConnError(err) {
 				log.Debugf("Connection error fetching radio data: %v", err)
 			} else {
-				log.Errorf("Error fetching radio data: %v", err)
+				log.Error(repeatMessage("fetch radio data", count, err))
 			}
+			status.SetError(err)
+			duty.Gap()
 			continue
 		}
+		if waitingForRadio && waitAttempts > 0 {
+			log.Infof("Radio is reachable after %d failed attempts; starting normal operation.", waitAttempts)
+		}
+		waitingForRadio = false
+		readErrors.Reset()
+		duty.Observe(currentData.PTT, time.Now())
+
+		currentData = checkPlausiblePower(currentProfileConfig, currentData)
+		currentData = applyTransverterOffset(currentProfileConfig, currentData)
+
+		// On receive the backends report the set power level, not what was transmitted
+		if currentProfileConfig.PowerOnTXOnly {
+			currentData = txPower.Apply(currentData)
+		}
+		sdNotifier.PollSucceeded()
+
+		if needRadioName {
+			if model, err := identifier.GetRadioModel(); err != nil {
+				log.Debugf("Failed to read radio model: %v", err)
+			} else if model != "" {
+				currentProfileConfig.RadioName = model
+				needRadioName = false
+				log.Infof("Using radio name '%s' reported by %s", model, currentProfileConfig.DataSource)
+			}
+		}
+
+		if currentProfileConfig.CheckClock && time.Since(lastClockCheck) >= clockCheckInterval {
+			lastClockCheck = time.Now()
+			if reader, ok := client.(ClockReader); ok {
+				checkClock(reader, settings.clockSkew)
+			} else {
+				log.Warnf("check_clock is set, but the %s data source cannot read the rig clock.", currentProfileConfig.DataSource)
+			}
+		}
+
+		currentData.GridSquare = currentProfileConfig.GridSquare
+		if gpsdClient != nil {
+			grid, err := gpsdClient.GridSquare()
+			if err != nil {
+				log.Debugf("Failed to read position from gpsd: %v", err)
+			}
+			if grid != "" {
+				currentData.GridSquare = grid
+			}
+		}
+
+		status.SetData(currentData)
+		currentData = modes.Apply(currentData, lastData, time.Now())
 
-		sinceLast := time.Now().Sub(lastUpdate)
-		if currentData == lastData && sinceLast < time.Minute {
+		if txGated(currentProfileConfig, currentData, lastData) {
+			log.Debug("Not transmitting. Skipping update.")
+			continue
+		}
+
+		if freq := float64(buildPayload(currentProfileConfig, currentData).Frequency); !frequencyAllowed(freq, currentProfileConfig.BandAllowlist, settings.allowedRanges) {
+			log.Debugf("Frequency %.0f Hz is outside band_allowlist and freq_ranges. Skipping update.", freq)
+			continue
+		}
+
+		if !settings.updateDue(currentData, lastData, time.Since(lastUpdate), !*watch) {
 			log.Debug("Radio data unchanged. Skipping update.")
 			continue
 		}
 
-		log.Infof("Radio state changed; freq: %.0f Hz, mode: %s). Updating Wavelog...", currentData.FreqVFOA, currentData.Mode)
+		if *watch {
+			if err := writeWatchEvent(os.Stdout, currentProfileConfig, currentData); err != nil {
+				log.Fatalf("Fatal: Failed to write to stdout: %v", err)
+			}
+			runChangeHook(currentProfileConfig, currentData, lastData)
+			lastData = currentData
+			lastUpdate = time.Now()
+			continue
+		}
+
+		power := fmt.Sprintf("%g W", currentData.Power)
+		if currentData.PowerActual > 0 {
+			power = fmt.Sprintf("%g W (set %g W, measured %g W)", currentData.Power, currentData.PowerSet, currentData.PowerActual)
+		}
+		freq := formatFrequency(txFrequency(currentData), currentProfileConfig.LogFrequencyUnit, currentProfileConfig.LogFrequencyDecimals)
+		log.Infof("Radio state changed (freq: %s, mode: %s, power: %s, split: %d). Updating Wavelog...", freq, txMode(currentData), power, currentData.Split)
+
+		// Publish independently of Wavelog, so that home automation keeps working while it is down
+		if publisher != nil {
+			if err := publisher.Publish(currentProfileConfig, currentData); err != nil {
+				log.Warnf("Error publishing to MQTT: %v", err)
+			}
+		}
 
-		if err := postToWavelog(currentProfileConfig, currentData); err != nil {
-			log.Errorf("Error posting to Wavelog: %v", err)
+		if err := postToWavelog(httpClient, currentProfileConfig, currentData, &apiURL); err != nil {
+			if show, count := postErrors.Allow(err); !show {
+				log.Tracef("Error posting to Wavelog repeated %d times: %v", count, err)
+			} else {
+				log.Error(repeatMessage("post to Wavelog", count, err))
+			}
+			status.SetError(err)
 			continue
 		}
+		postErrors.Reset()
+		status.SetSuccess()
+		status.History().Add(time.Now(), buildPayload(currentProfileConfig, currentData))
+		runChangeHook(currentProfileConfig, currentData, lastData)
 
 		lastData = currentData
 		lastUpdate = time.Now()
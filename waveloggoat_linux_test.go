@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// socketOption reads an integer socket option from a TCP connection.
+func socketOption(t *testing.T, conn *net.TCPConn, level, opt int) int {
+	t.Helper()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	var optErr error
+	if err := raw.Control(func(fd uintptr) {
+		value, optErr = syscall.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if optErr != nil {
+		t.Fatal(optErr)
+	}
+	return value
+}
+
+func TestHamlibKeepAlive(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+
+	tests := []struct {
+		name      string
+		keepAlive time.Duration
+		enabled   int
+	}{
+		{"45s", 45 * time.Second, 1},
+		{"disabled", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &HamlibClient{Host: "127.0.0.1", Port: addr.Port, KeepAlive: tt.keepAlive}
+			sess, err := client.dial()
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer sess.conn.Close()
+			tcp := sess.conn.(*net.TCPConn)
+			if got := socketOption(t, tcp, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); got != tt.enabled {
+				t.Errorf("SO_KEEPALIVE = %d, want %d", got, tt.enabled)
+			}
+			if tt.enabled == 1 {
+				if got := socketOption(t, tcp, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); got != 45 {
+					t.Errorf("TCP_KEEPIDLE = %ds, want 45s", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,3152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	stdlog "log"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestMain keeps the warnings that tests provoke on purpose out of the test output.
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// captureLog collects log output at level until the end of the test.
+func captureLog(t testing.TB, level logrus.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	oldLevel, oldFormatter := log.GetLevel(), log.Formatter
+	log.SetOutput(&buf)
+	log.SetLevel(level)
+	t.Cleanup(func() {
+		log.SetOutput(io.Discard)
+		log.SetLevel(oldLevel)
+		log.SetFormatter(oldFormatter)
+	})
+	return &buf
+}
+
+// fakeFlrig is an XML-RPC server answering flrig methods with fixed values. Methods
+// without a value answer with a fault, as flrig does for methods it does not know.
+type fakeFlrig struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	values map[string]interface{}
+	calls  map[string]int
+	delay  time.Duration // added to every call, to make round trips measurable
+}
+
+func newFakeFlrig(t testing.TB, values map[string]interface{}) *fakeFlrig {
+	t.Helper()
+	f := &fakeFlrig{values: values, calls: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// simplexFlrig is a transceiver on 20m FT8 in simplex.
+func simplexFlrig() map[string]interface{} {
+	return map[string]interface{}{
+		"rig.get_vfo":   "14074000",
+		"rig.get_vfoB":  "14074000",
+		"rig.get_modeA": "USB",
+		"rig.get_modeB": "USB",
+		"rig.get_power": 50,
+		"rig.get_ptt":   0,
+		"rig.get_split": 0,
+		"rig.get_bw":    []interface{}{"3000", ""},
+		"rig.get_rit":   0,
+		"rig.get_xit":   0,
+		"rig.get_xcvr":  "FT-891",
+	}
+}
+
+func (f *fakeFlrig) serve(w http.ResponseWriter, r *http.Request) {
+	var call struct {
+		MethodName string `xml:"methodName"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	if err := xml.Unmarshal(body, &call); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.calls[call.MethodName]++
+	value, ok := f.values[call.MethodName]
+	delay := f.delay
+	f.mu.Unlock()
+	time.Sleep(delay)
+
+	w.Header().Set("Content-Type", "text/xml")
+	if !ok {
+		fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><fault><value><struct>`+
+			`<member><name>faultCode</name><value><int>-1</int></value></member>`+
+			`<member><name>faultString</name><value><string>%s: unknown method name</string></value></member>`+
+			`</struct></value></fault></methodResponse>`, call.MethodName)
+		return
+	}
+	fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param>%s</param></params></methodResponse>`, xmlrpcValue(value))
+}
+
+// xmlrpcValue encodes the value types flrig answers with.
+func xmlrpcValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return "<value><string>" + html.EscapeString(v) + "</string></value>"
+	case int:
+		return "<value><int>" + strconv.Itoa(v) + "</int></value>"
+	case float64:
+		return "<value><double>" + strconv.FormatFloat(v, 'f', -1, 64) + "</double></value>"
+	case []interface{}:
+		s := "<value><array><data>"
+		for _, e := range v {
+			s += xmlrpcValue(e)
+		}
+		return s + "</data></array></value>"
+	}
+	panic(fmt.Sprintf("xmlrpcValue: unsupported type %T", v))
+}
+
+// set changes the value a method answers with; nil makes it answer with a fault.
+func (f *fakeFlrig) set(method string, v interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if v == nil {
+		delete(f.values, method)
+		return
+	}
+	f.values[method] = v
+}
+
+// count returns how often a method has been called.
+func (f *fakeFlrig) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// client returns a FlrigClient talking to the fake server.
+func (f *fakeFlrig) client() *FlrigClient {
+	u, _ := url.Parse(f.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	p, _ := strconv.Atoi(port)
+	return &FlrigClient{Host: host, Port: p}
+}
+
+func TestFlrigClientReusesClients(t *testing.T) {
+	client := newFakeFlrig(t, simplexFlrig()).client()
+	defer client.Close()
+
+	// Without reuse every call of every poll would need a client of its own
+	seen := make(map[interface{}]bool)
+	for i := 0; i < 4; i++ {
+		if _, err := client.GetData(); err != nil {
+			t.Fatalf("GetData: %v", err)
+		}
+		for _, c := range client.idle {
+			seen[c] = true
+		}
+	}
+	if len(seen) == 0 || len(seen) > flrigConcurrency {
+		t.Errorf("4 polls used %d XML-RPC clients, want 1 to %d", len(seen), flrigConcurrency)
+	}
+}
+
+func BenchmarkFlrigCall(b *testing.B) {
+	fake := newFakeFlrig(b, simplexFlrig())
+	var vfo string
+
+	b.Run("cached", func(b *testing.B) {
+		client := fake.client()
+		defer client.Close()
+		for i := 0; i < b.N; i++ {
+			if err := client.call("rig.get_vfo", nil, &vfo); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("new client per call", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			client := fake.client()
+			if err := client.call("rig.get_vfo", nil, &vfo); err != nil {
+				b.Fatal(err)
+			}
+			client.Close()
+		}
+	})
+}
+
+// fakeRigctld answers rigctld commands over a net.Pipe with canned responses and records
+// the commands it receives. A response keyed "VFOB:f" is used for "f" only while VFO B is
+// selected with "V VFOB"; commands without a response answer "RPRT -11".
+type fakeRigctld struct {
+	mu        sync.Mutex
+	responses map[string]string // command to its response lines
+	silent    map[string]bool   // commands left unanswered, as by a hung rig
+	vfo       string
+	commands  []string
+}
+
+// newFakeRigctld returns a fake rigctld and a HamlibClient already connected to it, in
+// the VFO mode given.
+func newFakeRigctld(t testing.TB, responses map[string]string, vfoMode bool) (*fakeRigctld, *HamlibClient) {
+	t.Helper()
+	server, conn := net.Pipe()
+	r := &fakeRigctld{responses: responses, silent: make(map[string]bool), vfo: "VFOA"}
+	go r.serve(server)
+	t.Cleanup(func() {
+		server.Close()
+		conn.Close()
+	})
+	sess := &hamlibSession{conn: conn, reader: bufio.NewReader(conn), timeout: time.Second, vfoMode: vfoMode}
+	return r, &HamlibClient{sess: sess, vfoMode: vfoMode, vfoChecked: true}
+}
+
+func (r *fakeRigctld) serve(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := scanner.Text()
+		r.mu.Lock()
+		r.commands = append(r.commands, cmd)
+		if r.silent[cmd] {
+			r.mu.Unlock()
+			continue
+		}
+		resp, ok := r.responses[r.vfo+":"+cmd]
+		if !ok {
+			resp, ok = r.responses[cmd]
+		}
+		if vfo, isSet := strings.CutPrefix(cmd, "V "); isSet && !ok {
+			r.vfo, resp, ok = vfo, "RPRT 0", true
+		}
+		r.mu.Unlock()
+		if !ok {
+			resp = "RPRT -11"
+		}
+		if _, err := io.WriteString(conn, resp+"\n"); err != nil {
+			return
+		}
+	}
+}
+
+// listenFakeRigctld serves a fake rigctld on a loopback TCP port and returns a
+// HamlibClient that connects to it, so that connecting and \chk_vfo are exercised too.
+func listenFakeRigctld(t testing.TB, responses map[string]string) (*fakeRigctld, *HamlibClient) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	r := &fakeRigctld{responses: responses, silent: make(map[string]bool), vfo: "VFOA"}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			go r.serve(conn)
+		}
+	}()
+	client := &HamlibClient{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}
+	t.Cleanup(func() { client.Close() })
+	return r, client
+}
+
+// sent returns the commands received so far.
+func (r *fakeRigctld) sent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.commands...)
+}
+
+// selected returns the VFO last selected with "V".
+func (r *fakeRigctld) selected() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.vfo
+}
+
+func TestReadSplitVFORestoresVFO(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "read succeeds",
+			responses: map[string]string{"VFOB:f": "14076000", "VFOB:m": "PKTUSB\n3000"},
+			want:      []string{"V VFOB", "f", "m", "V VFOA"},
+		},
+		{
+			name:      "read fails",
+			responses: map[string]string{"VFOB:f": "RPRT -9"},
+			want:      []string{"V VFOB", "f", "V VFOA"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rig, client := newFakeRigctld(t, tt.responses, false)
+			vfo, err := client.sess.readSplitVFO("VFOA", "VFOB")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readSplitVFO error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (vfo.Freq != 14076000 || vfo.Mode != "PKTUSB") {
+				t.Errorf("readSplitVFO = %+v, want 14076000 PKTUSB", vfo)
+			}
+			if got := rig.sent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands = %q, want %q", got, tt.want)
+			}
+			if vfo := rig.selected(); vfo != "VFOA" {
+				t.Errorf("rig left on %s, want VFOA", vfo)
+			}
+		})
+	}
+}
+
+func TestHamlibGetDataSwitchesVFOForSplit(t *testing.T) {
+	// The rig cannot read the TX VFO with 'i' and 'x', so VFO B is selected and restored
+	rig, client := newFakeRigctld(t, map[string]string{
+		"f": "14074000", "m": "USB\n2400", "l RFPOWER": "0.5", "t": "0",
+		"s": "1\nVFOB", "v": "VFOA",
+		"VFOB:f": "14076000", "VFOB:m": "PKTUSB\n3000",
+	}, false)
+	data, err := client.GetData()
+	if err != nil {
+		t.Fatalf("GetData: %v", err)
+	}
+	if data.Split != 1 || data.FreqVFOA != 14074000 || data.FreqVFOB != 14076000 || data.ModeB != "PKTUSB" {
+		t.Errorf("GetData = %+v, want split with RX 14074000 and TX 14076000 PKTUSB", data)
+	}
+	cmds := rig.sent()
+	if last := cmds[len(cmds)-1]; last != "V VFOA" {
+		t.Errorf("last command %q, want the VFO restored with 'V VFOA' (sent %q)", last, cmds)
+	}
+}
+
+func TestExportImportProfileRoundTrip(t *testing.T) {
+	profile := ProfileConfig{
+		WavelogURL:    "https://log.example.org/index.php",
+		WavelogKey:    "secret-key",
+		RadioName:     "FT-891",
+		DataSource:    "flrig",
+		FlrigHost:     "shack.local",
+		FlrigPort:     12345,
+		FlrigPassword: "flrig-secret",
+		MQTTPassword:  "mqtt-secret",
+		Interval:      "2s",
+		BandAllowlist: []string{"20m", "40m"},
+		ModeMap:       map[string]string{"USB-D": "FT8"},
+	}
+	path := t.TempDir() + "/portable.json"
+	if err := exportProfile(ConfigFile{Profiles: map[string]ProfileConfig{"portable": profile}}, "portable", path); err != nil {
+		t.Fatalf("exportProfile: %v", err)
+	}
+	exported, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-key", "flrig-secret", "mqtt-secret"} {
+		if strings.Contains(string(exported), secret) {
+			t.Errorf("exported profile contains %q", secret)
+		}
+	}
+
+	// Importing over an existing profile keeps its API key
+	cfg := ConfigFile{Profiles: map[string]ProfileConfig{"home": {WavelogKey: "home-key"}}}
+	if err := importProfile(&cfg, "home", path); err != nil {
+		t.Fatalf("importProfile: %v", err)
+	}
+	want := profile
+	want.WavelogKey, want.FlrigPassword, want.MQTTPassword = "home-key", "", ""
+	if got := cfg.Profiles["home"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("imported profile = %+v, want %+v", got, want)
+	}
+
+	// A new profile has no key to keep, and a config without profiles gets a map
+	var empty ConfigFile
+	if err := importProfile(&empty, "new", path); err != nil {
+		t.Fatalf("importProfile: %v", err)
+	}
+	if got := empty.Profiles["new"].WavelogKey; got != "" {
+		t.Errorf("new profile has API key %q, want none", got)
+	}
+
+	if err := exportProfile(cfg, "missing", path); err == nil {
+		t.Error("exporting a missing profile succeeded")
+	}
+}
+
+// fakeWavelog is a Wavelog radio API answering every request with a fixed status and
+// body, recording the requests it receives.
+type fakeWavelog struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	body     string
+	paths    []string
+	headers  []http.Header
+	bodies   []string
+	payloads []WavelogJSONRequest
+}
+
+func newFakeWavelog(t testing.TB, status int, body string) *fakeWavelog {
+	t.Helper()
+	w := &fakeWavelog{status: status, body: body}
+	w.Server = httptest.NewServer(http.HandlerFunc(w.serve))
+	t.Cleanup(w.Close)
+	return w
+}
+
+func (w *fakeWavelog) serve(rw http.ResponseWriter, r *http.Request) {
+	var payload WavelogJSONRequest
+	request, _ := io.ReadAll(r.Body)
+	json.Unmarshal(request, &payload)
+	w.mu.Lock()
+	w.paths = append(w.paths, r.URL.Path)
+	w.headers = append(w.headers, r.Header.Clone())
+	w.bodies = append(w.bodies, string(request))
+	w.payloads = append(w.payloads, payload)
+	status, body := w.status, w.body
+	w.mu.Unlock()
+	rw.WriteHeader(status)
+	io.WriteString(rw, body)
+}
+
+// post sends data to the fake with config, as the polling loop does.
+func (w *fakeWavelog) post(t testing.TB, config ProfileConfig, data RigData) error {
+	t.Helper()
+	if config.WavelogURL == "" {
+		config.WavelogURL = w.URL
+	}
+	client, err := newWavelogClient(config)
+	if err != nil {
+		t.Fatalf("newWavelogClient: %v", err)
+	}
+	var apiURL string
+	return postToWavelog(client, config, data, &apiURL)
+}
+
+// lastPayload returns the payload of the last request received.
+func (w *fakeWavelog) lastPayload(t testing.TB) WavelogJSONRequest {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.payloads) == 0 {
+		t.Fatal("no request received")
+	}
+	return w.payloads[len(w.payloads)-1]
+}
+
+// lastHeader returns the headers of the last request received.
+func (w *fakeWavelog) lastHeader(t testing.TB) http.Header {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.headers) == 0 {
+		t.Fatal("no request received")
+	}
+	return w.headers[len(w.headers)-1]
+}
+
+// waitForPayload waits for a request whose payload satisfies match.
+func (w *fakeWavelog) waitForPayload(t testing.TB, what string, match func(WavelogJSONRequest) bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		w.mu.Lock()
+		for _, p := range w.payloads {
+			if match(p) {
+				w.mu.Unlock()
+				return
+			}
+		}
+		w.mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no update with %s received", what)
+}
+
+// TestMainHelper is not a test: started by startMain, it runs main with the arguments
+// after "--" in a child process, for tests of the program as a whole.
+func TestMainHelper(t *testing.T) {
+	if os.Getenv("WAVELOGGOAT_RUN_MAIN") == "" {
+		return
+	}
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	os.Args = append([]string{"waveloggoat"}, args...)
+	flag.CommandLine = flag.NewFlagSet("waveloggoat", flag.ExitOnError)
+	main()
+	os.Exit(0)
+}
+
+// mainProcess is WaveLogGoat running in a child process.
+type mainProcess struct {
+	*exec.Cmd
+	output *syncBuffer
+	done   chan struct{}
+}
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes and reads of a child's output.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// startMain runs WaveLogGoat with args in a child process, which is stopped at the end
+// of the test.
+func startMain(t *testing.T, env []string, args ...string) *mainProcess {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestMainHelper$", "--"}, args...)...)
+	cmd.Env = append(append(os.Environ(), "WAVELOGGOAT_RUN_MAIN=1"), env...)
+	p := &mainProcess{Cmd: cmd, output: &syncBuffer{}, done: make(chan struct{})}
+	cmd.Stdout, cmd.Stderr = p.output, p.output
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		cmd.Wait()
+		close(p.done)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-p.done
+		if t.Failed() {
+			t.Logf("output of waveloggoat %s:\n%s", strings.Join(args, " "), p.output)
+		}
+	})
+	return p
+}
+
+// waitForOutput waits for the child's output to contain text.
+func (p *mainProcess) waitForOutput(t *testing.T, text string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(p.output.String(), text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %q in the output", text)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestPostToWavelogResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"success", http.StatusOK, `{"status":"success"}`, ""},
+		{"empty body", http.StatusOK, ``, ""},
+		{"error status in 200", http.StatusOK, `{"status":"failed","reason":"missing api key"}`, "missing api key"},
+		{"error message in 200", http.StatusOK, `{"status":"error","message":"radio not found"}`, "radio not found"},
+		{"HTTP error", http.StatusUnauthorized, `denied`, "401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavelog := newFakeWavelog(t, tt.status, tt.body)
+			logged := captureLog(t, logrus.DebugLevel)
+			err := wavelog.post(t, ProfileConfig{WavelogKey: "key", RadioName: "RIG"}, RigData{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "USB"})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("postToWavelog: %v", err)
+				}
+				if !strings.Contains(logged.String(), "Wavelog response: "+strings.Trim(strconv.Quote(tt.body), `"`)) {
+					t.Errorf("response body not logged at debug level:\n%s", logged)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("postToWavelog error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJitteredIntervalBounds(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		base    time.Duration
+		percent int
+	}{
+		{time.Second, 10},
+		{time.Second, 100},
+		{5 * time.Second, 25},
+		{time.Nanosecond, 50}, // spread rounds to nothing
+	}
+	for _, tt := range tests {
+		low := tt.base - tt.base*time.Duration(tt.percent)/100
+		high := tt.base + tt.base*time.Duration(tt.percent)/100
+		varied := false
+		for i := 0; i < 1000; i++ {
+			got := jitteredInterval(tt.base, tt.percent, rng)
+			if got < low || got > high {
+				t.Fatalf("jitteredInterval(%s, %d%%) = %s, want within [%s, %s]", tt.base, tt.percent, got, low, high)
+			}
+			varied = varied || got != tt.base
+		}
+		if !varied && low != high {
+			t.Errorf("jitteredInterval(%s, %d%%) never varied", tt.base, tt.percent)
+		}
+	}
+
+	for _, percent := range []int{0, -5} {
+		if got := jitteredInterval(time.Second, percent, rng); got != time.Second {
+			t.Errorf("jitteredInterval(1s, %d%%) = %s, want 1s unchanged", percent, got)
+		}
+	}
+}
+
+func TestFlrigClientReconnectsWithBackoff(t *testing.T) {
+	fake := newFakeFlrig(t, simplexFlrig())
+	client := fake.client()
+	defer client.Close()
+	if _, err := client.GetData(); err != nil {
+		t.Fatalf("GetData: %v", err)
+	}
+
+	// flrig exits: the cached clients are dropped and a reconnect is scheduled
+	fake.Close()
+	if _, err := client.GetData(); err == nil || !isTransientConnError(err) {
+		t.Fatalf("GetData with flrig stopped = %v, want a connection error", err)
+	}
+	if len(client.idle) != 0 || client.failures != 1 {
+		t.Errorf("after the failure: %d idle clients, %d failures; want 0, 1", len(client.idle), client.failures)
+	}
+
+	// flrig is back on a new port, but polls during the backoff do not try to connect
+	restarted := newFakeFlrig(t, simplexFlrig())
+	client.Host, client.Port = restarted.client().Host, restarted.client().Port
+	if _, err := client.GetData(); !errors.Is(err, errReconnectBackoff) {
+		t.Errorf("GetData during the backoff = %v, want %v", err, errReconnectBackoff)
+	}
+	if n := restarted.count("rig.get_vfo"); n != 0 {
+		t.Errorf("flrig was called %d times during the backoff", n)
+	}
+
+	// Once the backoff has expired the client reconnects and the failure count resets
+	client.retryAt = time.Time{}
+	data, err := client.GetData()
+	if err != nil {
+		t.Fatalf("GetData after the backoff: %v", err)
+	}
+	if data.FreqVFOA != 14074000 || client.failures != 0 {
+		t.Errorf("after reconnecting: frequency %.0f, %d failures; want 14074000, 0", data.FreqVFOA, client.failures)
+	}
+}
+
+func TestFlrigClientBackoffIsCapped(t *testing.T) {
+	fake := newFakeFlrig(t, simplexFlrig())
+	client := fake.client()
+	fake.Close()
+
+	want := flrigBackoffMin
+	for i := 0; i < 8; i++ {
+		client.retryAt = time.Time{}
+		var vfo string
+		if err := client.call("rig.get_vfo", nil, &vfo); err == nil {
+			t.Fatal("call succeeded with flrig stopped")
+		}
+		got := time.Until(client.retryAt)
+		if got > want || got < want-time.Second {
+			t.Errorf("backoff after %d failures = %s, want %s", i+1, got.Round(time.Millisecond), want)
+		}
+		want = min(2*want, flrigBackoffMax)
+	}
+}
+
+func TestNormalizeFrequency(t *testing.T) {
+	tests := []struct {
+		name string
+		freq float64
+		want float64
+		warn bool
+	}{
+		{"Hz", 14074000, 14074000, false},
+		{"decimal Hz", 14074000.6, 14074000.6, false},
+		{"Hz outside the bands", 162550000, 162550000, false},
+		{"kHz", 14074, 14074000, false},
+		{"decimal kHz", 7074.5, 7074500, false},
+		{"kHz on 6m", 50313, 50313000, false},
+		{"kHz on 30m rather than MHz on 3cm", 10136, 10136000, false},
+		{"MHz", 14.074, 14074000, false},
+		{"MHz on 2m", 144.3, 144300000, false},
+		{"MHz on 23cm", 1296.2, 1296200000, false},
+		{"MHz on 13cm", 2400, 2400000000, false},
+		{"Hz on 2200m", 136000, 136000, false},
+		{"Hz on 630m", 474200, 474200, false},
+		{"kHz on 2200m", 137.5, 137500, false},
+		{"kHz on 2200m low edge", 135.7, 135700, false},
+		{"kHz on 630m", 474.2, 474200, false},
+		{"kHz on 630m high edge", 479, 479000, false},
+		{"kHz off every band", 7400, 7400, true},
+		{"MHz off every band", 0.5, 0.5, true},
+		{"zero", 0, 0, true},
+		{"above 30 GHz", 47e9, 47e9, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t, logrus.WarnLevel)
+			if got := normalizeFrequency(tt.freq); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("normalizeFrequency(%g) = %g, want %g", tt.freq, got, tt.want)
+			}
+			if warned := logs.Len() > 0; warned != tt.warn {
+				t.Errorf("normalizeFrequency(%g) warned %v, want %v: %s", tt.freq, warned, tt.warn, logs)
+			}
+		})
+	}
+}
+
+func TestFrequencyUnitsFromRadio(t *testing.T) {
+	tests := []struct {
+		name string
+		freq string
+		want float64
+	}{
+		{"Hz", "14074000", 14074000},
+		{"kHz", "14074", 14074000},
+		{"MHz", "14.074", 14074000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := simplexFlrig()
+			values["rig.get_vfo"], values["rig.get_vfoB"] = tt.freq, tt.freq
+			flrig := newFakeFlrig(t, values)
+			if data, err := flrig.client().GetData(); err != nil || data.FreqVFOA != tt.want || data.FreqVFOB != tt.want {
+				t.Errorf("flrig reporting %s: GetData = %+v, %v; want %g on both VFOs", tt.freq, data, err, tt.want)
+			}
+
+			responses := map[string]string{"f": tt.freq, "m": "USB\n2400", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA"}
+			_, client := newFakeRigctld(t, responses, false)
+			if data, err := client.GetData(); err != nil || data.FreqVFOA != tt.want {
+				t.Errorf("rigctld reporting %s: GetData = %+v, %v; want %g", tt.freq, data, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPayloadRITXIT(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        RigData
+		frequency   int
+		frequencyRX int
+	}{
+		{"no offsets", RigData{FreqVFOA: 7030000}, 7030000, 0},
+		{"positive RIT", RigData{FreqVFOA: 7030000, RIT: 250}, 7030000, 7030250},
+		{"negative RIT", RigData{FreqVFOA: 7030000, RIT: -1200}, 7030000, 7028800},
+		{"positive XIT", RigData{FreqVFOA: 7030000, XIT: 500}, 7030500, 0},
+		{"negative XIT", RigData{FreqVFOA: 7030000, XIT: -500}, 7029500, 0},
+		{"RIT and XIT", RigData{FreqVFOA: 7030000, RIT: -300, XIT: 300}, 7030300, 7029700},
+		{"XIT in split", RigData{FreqVFOA: 7030000, FreqVFOB: 7032000, Split: 1, XIT: -100}, 7031900, 7030000},
+		{"RIT in split", RigData{FreqVFOA: 7030000, FreqVFOB: 7032000, Split: 1, RIT: 150}, 7032000, 7030150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := buildPayload(ProfileConfig{RadioName: "K3"}, tt.data)
+			if payload.Frequency != tt.frequency || payload.FrequencyRX != tt.frequencyRX {
+				t.Errorf("frequency = %d, frequency_rx = %d; want %d, %d", payload.Frequency, payload.FrequencyRX, tt.frequency, tt.frequencyRX)
+			}
+		})
+	}
+}
+
+func TestReadRITXIT(t *testing.T) {
+	t.Run("hamlib", func(t *testing.T) {
+		_, client := newFakeRigctld(t, map[string]string{
+			"f": "7030000", "m": "CW\n500", "l RFPOWER": "0.1", "t": "0", "s": "0\nVFOA",
+			"j": "-250", "z": "100",
+		}, false)
+		data, err := client.GetData()
+		if err != nil {
+			t.Fatalf("GetData: %v", err)
+		}
+		if data.RIT != -250 || data.XIT != 100 {
+			t.Errorf("RIT, XIT = %g, %g; want -250, 100", data.RIT, data.XIT)
+		}
+	})
+	t.Run("hamlib without RIT", func(t *testing.T) {
+		_, client := newFakeRigctld(t, map[string]string{
+			"f": "7030000", "m": "CW\n500", "l RFPOWER": "0.1", "t": "0", "s": "0\nVFOA",
+		}, false)
+		data, err := client.GetData()
+		if err != nil {
+			t.Fatalf("GetData: %v", err)
+		}
+		if data.RIT != 0 || data.XIT != 0 {
+			t.Errorf("RIT, XIT = %g, %g; want 0 when the rig rejects 'j' and 'z'", data.RIT, data.XIT)
+		}
+	})
+	t.Run("flrig", func(t *testing.T) {
+		values := simplexFlrig()
+		values["rig.get_rit"], values["rig.get_xit"] = 400, -150
+		client := newFakeFlrig(t, values).client()
+		defer client.Close()
+		data, err := client.GetData()
+		if err != nil {
+			t.Fatalf("GetData: %v", err)
+		}
+		if data.RIT != 400 || data.XIT != -150 {
+			t.Errorf("RIT, XIT = %g, %g; want 400, -150", data.RIT, data.XIT)
+		}
+	})
+}
+
+func TestPostToWavelogUserAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ProfileConfig
+		want   string
+	}{
+		{"default", ProfileConfig{RadioName: "IC-7300"}, "WaveLogGoat/" + version + " (IC-7300)"},
+		{"configured", ProfileConfig{RadioName: "IC-7300", UserAgent: "shack-pi-1"}, "shack-pi-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+			if err := wavelog.post(t, tt.config, RigData{FreqVFOA: 14074000, Mode: "USB"}); err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			if got := wavelog.lastHeader(t).Get("User-Agent"); got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlrigModeReads(t *testing.T) {
+	tests := []struct {
+		name    string
+		modeA   interface{} // rig.get_modeA; nil makes it fault, as on older flrig
+		mode    interface{} // rig.get_mode
+		want    string
+		wantErr bool
+	}{
+		{"explicit VFO A", "CW", "USB", "CW", false},
+		{"fallback to rig.get_mode", nil, "LSB", "LSB", false},
+		{"neither", nil, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeFlrig(t, simplexFlrig())
+			fake.set("rig.get_modeA", tt.modeA)
+			fake.set("rig.get_mode", tt.mode)
+			client := fake.client()
+			defer client.Close()
+
+			data, err := client.GetData()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetData error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && data.Mode != tt.want {
+				t.Errorf("Mode = %q, want %q", data.Mode, tt.want)
+			}
+			if n := fake.count("rig.get_mode"); (tt.modeA == nil) != (n > 0) {
+				t.Errorf("rig.get_mode called %d times with rig.get_modeA answering %v", n, tt.modeA)
+			}
+		})
+	}
+}
+
+func TestSetupLoggingTimestampFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		layout string
+	}{
+		{"", ""},
+		{"rfc3339", time.RFC3339},
+		{"RFC3339Nano", time.RFC3339Nano},
+		{"datetime", time.DateTime},
+		{" timeonly ", time.TimeOnly},
+		{"15:04:05.000", "15:04:05.000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			t.Setenv(logLevelEnv, "")
+			logs := captureLog(t, logrus.InfoLevel)
+			setupLogging("info", tt.format, false)
+			formatter, ok := log.Formatter.(*logrus.TextFormatter)
+			if !ok || formatter.TimestampFormat != tt.layout || !formatter.FullTimestamp {
+				t.Fatalf("formatter = %#v, want full timestamps with layout %q", log.Formatter, tt.layout)
+			}
+			if tt.layout == "" {
+				return
+			}
+			log.Info("hello")
+			_, stamp, _ := strings.Cut(logs.String(), "time=")
+			if quoted, ok := strings.CutPrefix(stamp, `"`); ok {
+				stamp, _, _ = strings.Cut(quoted, `"`)
+			} else {
+				stamp, _, _ = strings.Cut(stamp, " ")
+			}
+			if _, err := time.Parse(tt.layout, stamp); err != nil {
+				t.Errorf("timestamp %q in %q does not have layout %q: %v", stamp, logs.String(), tt.layout, err)
+			}
+		})
+	}
+}
+
+func TestLogLevelPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string // log_level, or -log-level when fromFlag
+		env      string
+		fromFlag bool
+		want     logrus.Level
+	}{
+		{"config", "warn", "", false, logrus.WarnLevel},
+		{"env over config", "warn", "debug", false, logrus.DebugLevel},
+		{"env with spaces", "warn", " trace ", false, logrus.TraceLevel},
+		{"flag over env", "info", "debug", true, logrus.InfoLevel},
+		{"flag without env", "debug", "", true, logrus.DebugLevel},
+		{"invalid env", "warn", "loud", false, logrus.ErrorLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(logLevelEnv, tt.env)
+			captureLog(t, logrus.InfoLevel)
+			setupLogging(tt.level, "", tt.fromFlag)
+			if got := log.GetLevel(); got != tt.want {
+				t.Errorf("log level = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogLevelEnvOverridesProfile(t *testing.T) {
+	wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+	radio := newFakeFlrig(t, simplexFlrig()).client()
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := ConfigFile{DefaultProfile: "home", Profiles: map[string]ProfileConfig{"home": {
+		WavelogURL: wavelog.URL + "/index.php", WavelogKey: "key", RadioName: "IC-7300", LogLevel: "error",
+		DataSource: "flrig", FlrigHost: radio.Host, FlrigPort: radio.Port, Interval: "20ms",
+	}}}
+	if err := saveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	p := startMain(t, []string{logLevelEnv + "=info"}, "-config", path)
+	p.waitForOutput(t, "Radio state changed")
+
+	// -log-level beats the environment: once an update was posted, nothing was logged
+	wavelog = newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+	cfg.Profiles["home"] = ProfileConfig{
+		WavelogURL: wavelog.URL + "/index.php", WavelogKey: "key", RadioName: "IC-7300", LogLevel: "info",
+		DataSource: "flrig", FlrigHost: radio.Host, FlrigPort: radio.Port, Interval: "20ms",
+	}
+	if err := saveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	p = startMain(t, []string{logLevelEnv + "=info"}, "-config", path, "-log-level", "error")
+	wavelog.waitForPayload(t, "an update", func(WavelogJSONRequest) bool { return true })
+	if out := p.output.String(); strings.Contains(out, "level=info") {
+		t.Errorf("info logged with -log-level error:\n%s", out)
+	}
+}
+
+func TestNewLogFileDefaults(t *testing.T) {
+	logFile := newLogFile(ProfileConfig{LogFile: "waveloggoat.log"})
+	if logFile.MaxSize != 10 || logFile.MaxBackups != 3 {
+		t.Errorf("unset rotation settings = %d MB, %d files; want 10 MB, 3 files", logFile.MaxSize, logFile.MaxBackups)
+	}
+	logFile = newLogFile(ProfileConfig{LogFile: "waveloggoat.log", LogMaxSize: 50, LogMaxFiles: 7})
+	if logFile.MaxSize != 50 || logFile.MaxBackups != 7 {
+		t.Errorf("rotation settings = %d MB, %d files; want 50 MB, 7 files", logFile.MaxSize, logFile.MaxBackups)
+	}
+}
+
+func TestLogFileRotatesAtMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	logFile := newLogFile(ProfileConfig{LogFile: dir + "/waveloggoat.log", LogMaxSize: 1})
+	defer logFile.Close()
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	files := func() int {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+	// Just under 1 MB stays in the one file...
+	for i := 0; i < 1023; i++ {
+		if _, err := logFile.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := files(); n != 1 {
+		t.Fatalf("%d files below the size threshold, want 1", n)
+	}
+	// ...and the write crossing it starts a new file
+	for i := 0; i < 2; i++ {
+		if _, err := logFile.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := files(); n != 2 {
+		t.Errorf("%d files after crossing the size threshold, want the log and one backup", n)
+	}
+}
+
+func TestPowerOnlyChangeSendsCurrentState(t *testing.T) {
+	last := RigData{FreqVFOA: 14074000, FreqVFOB: 14076000, Mode: "USB", ModeB: "USB", Split: 1, Power: 50, PowerSet: 50}
+	current := last
+	current.Power, current.PowerSet = 100, 100
+
+	if !hasMeaningfulChange(current, last, powerThreshold{}) {
+		t.Fatal("a power-only change was not sent")
+	}
+	payload := buildPayload(ProfileConfig{RadioName: "FT-991"}, current)
+	if payload.Power != 100.0 || payload.Frequency != 14076000 || payload.FrequencyRX != 14074000 || payload.Mode != "USB" {
+		t.Errorf("payload = %+v, want 100 W with the split TX 14076000 and RX 14074000 USB", payload)
+	}
+}
+
+func TestPostToWavelogSelfSignedTLS(t *testing.T) {
+	wavelog := &fakeWavelog{status: http.StatusOK, body: `{"status":"success"}`}
+	wavelog.Server = httptest.NewUnstartedServer(http.HandlerFunc(wavelog.serve))
+	wavelog.Config.ErrorLog = stdlog.New(io.Discard, "", 0) // the rejected handshake
+	wavelog.StartTLS()
+	defer wavelog.Close()
+	data := RigData{FreqVFOA: 14074000, Mode: "USB"}
+
+	if err := wavelog.post(t, ProfileConfig{RadioName: "IC-7300"}, data); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("post to a self-signed server = %v, want a certificate error", err)
+	}
+	if err := wavelog.post(t, ProfileConfig{RadioName: "IC-7300", InsecureSkipVerify: true}, data); err != nil {
+		t.Errorf("post with insecure_skip_verify: %v", err)
+	}
+	if got := wavelog.lastPayload(t).Frequency; got != 14074000 {
+		t.Errorf("frequency = %d, want 14074000", got)
+	}
+}
+
+func TestParseHamlibModelName(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []string
+		want string
+	}{
+		{"dump_caps", []string{"Caps dump for model: 3073", "Model name:\tIC-7300", "Mfg name:\tIcom", "Backend version:\t20230109.0"}, "IC-7300"},
+		{"spaces", []string{"Model name:   FT-991A  "}, "FT-991A"},
+		{"dummy rig", []string{"Caps dump for model: 1", "Model name:\tDummy", "Mfg name:\tHamlib"}, "Dummy"},
+		{"no model line", []string{"Caps dump for model: 1", "Mfg name:\tHamlib"}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseHamlibModelName(tt.caps); got != tt.want {
+				t.Errorf("parseHamlibModelName(%q) = %q, want %q", tt.caps, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRadioModel(t *testing.T) {
+	t.Run("hamlib", func(t *testing.T) {
+		_, client := newFakeRigctld(t, map[string]string{
+			"+\\dump_caps": "dump_caps:\nCaps dump for model: 3073\nModel name:\tIC-7300\nMfg name:\tIcom\nRPRT 0",
+		}, false)
+		if model, err := client.GetRadioModel(); err != nil || model != "IC-7300" {
+			t.Errorf("GetRadioModel = %q, %v; want IC-7300", model, err)
+		}
+	})
+	t.Run("flrig", func(t *testing.T) {
+		fake := newFakeFlrig(t, simplexFlrig())
+		fake.set("rig.get_xcvr", " FT-891\n")
+		client := fake.client()
+		defer client.Close()
+		if model, err := client.GetRadioModel(); err != nil || model != "FT-891" {
+			t.Errorf("GetRadioModel = %q, %v; want FT-891", model, err)
+		}
+	})
+}
+
+func TestBuildPayloadRITOnly(t *testing.T) {
+	config := ProfileConfig{RadioName: "K3"}
+	payload := buildPayload(config, RigData{FreqVFOA: 10116000, Mode: "CW", RIT: 600})
+	if payload.Frequency != 10116000 || payload.FrequencyRX != 10116600 || payload.ModeRX != "CW" {
+		t.Errorf("RIT-only payload = %+v, want TX 10116000, RX 10116600 CW", payload)
+	}
+
+	payload = buildPayload(config, RigData{FreqVFOA: 10116000, Mode: "CW"})
+	if payload.FrequencyRX != 0 || payload.ModeRX != "" {
+		t.Errorf("simplex payload sent frequency_rx %d, mode_rx %q; want neither", payload.FrequencyRX, payload.ModeRX)
+	}
+	body, _ := json.Marshal(payload)
+	if strings.Contains(string(body), "_rx") {
+		t.Errorf("simplex payload %s contains RX fields", body)
+	}
+}
+
+func TestBuildPayloadModeRXWithoutSplit(t *testing.T) {
+	config := ProfileConfig{RadioName: "FT-991"}
+	payload := buildPayload(config, RigData{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "USB", ModeB: "CW"})
+	if payload.Mode != "USB" || payload.ModeRX != "CW" {
+		t.Errorf("mode = %q, mode_rx = %q; want USB, CW", payload.Mode, payload.ModeRX)
+	}
+	payload = buildPayload(config, RigData{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "USB", ModeB: "USB"})
+	if payload.ModeRX != "" {
+		t.Errorf("mode_rx = %q with both VFOs in USB, want none", payload.ModeRX)
+	}
+}
+
+func TestHamlibTimeoutOnHungRigctld(t *testing.T) {
+	rig, client := newFakeRigctld(t, map[string]string{"f": "14074000"}, false)
+	rig.silent["f"] = true
+	sess := client.sess
+	sess.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := client.GetData()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GetData took %s against a hung rigctld, want about the 100ms timeout", elapsed)
+	}
+	if err == nil || !isTransientConnError(err) {
+		t.Fatalf("GetData = %v, want a transient connection error", err)
+	}
+	if !sess.broken || client.sess != nil {
+		t.Error("the timed out session was kept, so a late reply would be read as the next answer")
+	}
+}
+
+func TestHamlibValue(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"14074000", "14074000"},
+		{"Frequency: 14074000", "14074000"},
+		{"VFOA 14074000", "14074000"},
+		{"VFOA: USB", "USB"},
+		{"Mode: PKTUSB", "PKTUSB"},
+		{"  2400  ", "2400"},
+		{"", ""},
+		{"Frequency:", ""},
+	}
+	for _, tt := range tests {
+		if got := hamlibValue(tt.line); got != tt.want {
+			t.Errorf("hamlibValue(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestIsHamlibEcho(t *testing.T) {
+	tests := []struct {
+		cmd, line string
+		want      bool
+	}{
+		{"f", "f", true},
+		{"f", "get_freq:", true},
+		{"f", "14074000", false},
+		{"f", "Frequency: 14074000", false},
+		{"m", "get_mode:", true},
+		{"m", "USB", false},
+	}
+	for _, tt := range tests {
+		if got := isHamlibEcho(tt.cmd, tt.line); got != tt.want {
+			t.Errorf("isHamlibEcho(%q, %q) = %v, want %v", tt.cmd, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestHamlibResponseFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]string
+	}{
+		{"plain", map[string]string{"f": "14074000", "m": "USB\n2400"}},
+		{"echoed", map[string]string{"f": "get_freq:\n14074000", "m": "get_mode:\nUSB\n2400"}},
+		{"labelled", map[string]string{"f": "Frequency: 14074000", "m": "Mode: USB\nPassband: 2400"}},
+		{"VFO prefixed", map[string]string{"f": "VFOA 14074000", "m": "VFOA: USB\n2400"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, client := newFakeRigctld(t, tt.responses, false)
+			vfo, err := client.sess.readFreqMode()
+			if err != nil {
+				t.Fatalf("readFreqMode: %v", err)
+			}
+			if vfo.Freq != 14074000 || vfo.Mode != "USB" || vfo.Passband != 2400 {
+				t.Errorf("readFreqMode = %+v, want 14074000 USB 2400", vfo)
+			}
+		})
+	}
+}
+
+func TestBandwidthSerialization(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ProfileConfig
+		data   RigData
+		want   map[string]interface{} // bandwidth fields expected in the JSON; absent ones must be omitted
+	}{
+		{"disabled", ProfileConfig{}, RigData{FreqVFOA: 14074000, Bandwidth: 2400}, map[string]interface{}{}},
+		{"simplex", ProfileConfig{SendBandwidth: true}, RigData{FreqVFOA: 14074000, Bandwidth: 2400.4}, map[string]interface{}{"bandwidth": 2400.0}},
+		{"split", ProfileConfig{SendBandwidth: true}, RigData{FreqVFOA: 14074000, FreqVFOB: 14076000, Split: 1, Bandwidth: 500, BandwidthB: 2700},
+			map[string]interface{}{"bandwidth": 2700.0, "bandwidth_rx": 500.0}},
+		{"unknown", ProfileConfig{SendBandwidth: true}, RigData{FreqVFOA: 14074000}, map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(buildPayload(tt.config, tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(body, &fields); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]interface{})
+			for _, name := range []string{"bandwidth", "bandwidth_rx"} {
+				if v, ok := fields[name]; ok {
+					got[name] = v
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bandwidth fields = %v, want %v in %s", got, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestPostToWavelogThroughHTTPProxy(t *testing.T) {
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		io.WriteString(w, `{"status":"success"}`)
+	}))
+	defer proxy.Close()
+
+	// The Wavelog host does not resolve, so the update only arrives through the proxy
+	config := ProfileConfig{RadioName: "IC-7300", WavelogURL: "http://wavelog.invalid/index.php", HTTPProxy: proxy.URL}
+	client, err := newWavelogClient(config)
+	if err != nil {
+		t.Fatalf("newWavelogClient: %v", err)
+	}
+	var apiURL string
+	if err := postToWavelog(client, config, RigData{FreqVFOA: 14074000, Mode: "USB"}, &apiURL); err != nil {
+		t.Fatalf("post through the proxy: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"http://wavelog.invalid/index.php/api/radio"}; !reflect.DeepEqual(proxied, want) {
+		t.Errorf("proxied requests = %q, want %q", proxied, want)
+	}
+}
+
+// socks5Stub is a minimal SOCKS5 server without authentication, recording the
+// destinations it connects to.
+type socks5Stub struct {
+	net.Listener
+	mu           sync.Mutex
+	destinations []string
+}
+
+func newSocks5Stub(t *testing.T) *socks5Stub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socks5Stub{Listener: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Stub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// Greeting: version, method count and methods; choose "no authentication"
+	hello := make([]byte, 2)
+	if _, err := io.ReadFull(r, hello); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(r, make([]byte, hello[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	// CONNECT request: version, command, reserved, address type, address, port
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case 3:
+		n, _ := r.ReadByte()
+		name := make([]byte, n)
+		io.ReadFull(r, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return
+	}
+	dest := net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+	s.mu.Lock()
+	s.destinations = append(s.destinations, dest)
+	s.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", dest)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(upstream, r)
+	io.Copy(conn, upstream)
+}
+
+func TestPostToWavelogThroughSocksProxy(t *testing.T) {
+	wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+	socks := newSocks5Stub(t)
+	config := ProfileConfig{RadioName: "IC-7300", SocksProxy: socks.Addr().String(), HTTPProxy: "http://127.0.0.1:1"}
+	if err := wavelog.post(t, config, RigData{FreqVFOA: 14074000, Mode: "USB"}); err != nil {
+		t.Fatalf("post through the SOCKS proxy: %v", err)
+	}
+	socks.mu.Lock()
+	defer socks.mu.Unlock()
+	if want := []string{wavelog.Listener.Addr().String()}; !reflect.DeepEqual(socks.destinations, want) {
+		t.Errorf("SOCKS destinations = %q, want %q", socks.destinations, want)
+	}
+}
+
+func TestHamlibSplitFreqMode(t *testing.T) {
+	base := map[string]string{"f": "14025000", "m": "CW\n500", "l RFPOWER": "0.5", "t": "0", "v": "VFOA"}
+	tests := []struct {
+		name      string
+		responses map[string]string
+		split     int
+		freqB     float64
+		modeB     string
+		switched  bool // VFO B was selected to read it
+	}{
+		{"split on", map[string]string{"s": "1\nVFOB", "i": "14027000", "x": "CW\n500"}, 1, 14027000, "CW", false},
+		{"split commands rejected", map[string]string{"s": "1\nVFOB", "i": "RPRT -11", "VFOB:f": "14027000", "VFOB:m": "CW\n500"}, 1, 14027000, "CW", true},
+		{"split off", map[string]string{"s": "0\nVFOA", "i": "RPRT -11"}, 0, 14025000, "CW", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := make(map[string]string)
+			for k, v := range base {
+				responses[k] = v
+			}
+			for k, v := range tt.responses {
+				responses[k] = v
+			}
+			rig, client := newFakeRigctld(t, responses, false)
+			data, err := client.GetData()
+			if err != nil {
+				t.Fatalf("GetData: %v", err)
+			}
+			if data.Split != tt.split || data.FreqVFOB != tt.freqB || data.ModeB != tt.modeB {
+				t.Errorf("split %d, VFO B %.0f %s; want %d, %.0f %s", data.Split, data.FreqVFOB, data.ModeB, tt.split, tt.freqB, tt.modeB)
+			}
+			sent := strings.Join(rig.sent(), ",")
+			if switched := strings.Contains(sent, "V VFOB"); switched != tt.switched {
+				t.Errorf("VFO B selected: %v, want %v (sent %s)", switched, tt.switched, sent)
+			}
+			if tt.split == 0 && strings.Contains(sent, ",i,") {
+				t.Errorf("split frequency read with split off (sent %s)", sent)
+			}
+		})
+	}
+}
+
+func TestStationIDSerialization(t *testing.T) {
+	data := RigData{FreqVFOA: 14074000, Mode: "USB"}
+	body, _ := json.Marshal(buildPayload(ProfileConfig{RadioName: "IC-7300", StationID: "OP2"}, data))
+	if !strings.Contains(string(body), `"station_id":"OP2"`) {
+		t.Errorf("payload %s does not carry station_id OP2", body)
+	}
+	body, _ = json.Marshal(buildPayload(ProfileConfig{RadioName: "IC-7300"}, data))
+	if strings.Contains(string(body), "station_id") {
+		t.Errorf("payload %s carries station_id although none is configured", body)
+	}
+}
+
+func TestHamlibTraceLogsWire(t *testing.T) {
+	_, client := newFakeRigctld(t, map[string]string{"f": "\t14074000"}, false)
+	logs := captureLog(t, logrus.TraceLevel)
+	log.SetFormatter(&logrus.TextFormatter{DisableQuote: true, DisableTimestamp: true})
+
+	if _, err := client.sess.query("f", 1); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	for _, want := range []string{"hamlib > f", `hamlib < \x0914074000`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("trace output %q does not contain %q", logs, want)
+		}
+	}
+
+	logs.Reset()
+	log.SetLevel(logrus.DebugLevel)
+	if _, err := client.sess.query("f", 1); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if strings.Contains(logs.String(), "hamlib >") {
+		t.Errorf("wire traffic logged at debug level: %q", logs)
+	}
+}
+
+func TestFlrigSplitFallbackMethod(t *testing.T) {
+	fake := newFakeFlrig(t, simplexFlrig())
+	fake.set("rig.get_split", nil)
+	fake.set("rig.get_splitstate", 1)
+	client := fake.client()
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		data, err := client.GetData()
+		if err != nil {
+			t.Fatalf("GetData: %v", err)
+		}
+		if data.Split != 1 {
+			t.Errorf("poll %d: Split = %d, want 1 from rig.get_splitstate", i+1, data.Split)
+		}
+	}
+	if client.splitMethod != "rig.get_splitstate" {
+		t.Errorf("cached split method %q, want rig.get_splitstate", client.splitMethod)
+	}
+	// The unsupported name is only tried until the working one is known
+	if n := fake.count("rig.get_split"); n != 1 {
+		t.Errorf("rig.get_split called %d times, want 1", n)
+	}
+	if n := fake.count("rig.getsplit"); n != 0 {
+		t.Errorf("rig.getsplit called %d times, want 0", n)
+	}
+}
+
+func TestSplitInferred(t *testing.T) {
+	tests := []struct {
+		name         string
+		freqA, freqB float64
+		txVFO        string
+		want         bool
+	}{
+		{"transmitting on a different VFO B", 14195000, 14225000, "B", true},
+		{"transmitting on VFO A", 14195000, 14225000, "A", false},
+		{"VFOs on the same frequency", 14195000, 14195000, "B", false},
+		{"VFOs within a hertz", 14195000.2, 14195000.4, "B", false},
+		{"not transmitted yet", 14195000, 14225000, "", false},
+		{"VFO B unknown", 14195000, 0, "B", false},
+	}
+	for _, tt := range tests {
+		if got := splitInferred(tt.freqA, tt.freqB, tt.txVFO); got != tt.want {
+			t.Errorf("%s: splitInferred(%g, %g, %q) = %v, want %v", tt.name, tt.freqA, tt.freqB, tt.txVFO, got, tt.want)
+		}
+	}
+}
+
+func TestFlrigInferSplit(t *testing.T) {
+	values := simplexFlrig()
+	values["rig.get_vfoB"] = "14225000"
+	values["rig.get_AB"] = "B"
+	fake := newFakeFlrig(t, values)
+	for _, method := range flrigSplitMethods {
+		fake.set(method, nil)
+	}
+	client := fake.client()
+	client.InferSplit = true
+	defer client.Close()
+
+	steps := []struct {
+		name  string
+		ptt   int
+		txVFO string
+		want  int
+	}{
+		{"receiving before transmitting", 0, "B", 0},
+		{"transmitting on VFO B", 1, "B", 1},
+		{"receiving after transmitting on VFO B", 0, "A", 1},
+		{"transmitting on VFO A", 1, "A", 0},
+	}
+	for _, step := range steps {
+		fake.set("rig.get_ptt", step.ptt)
+		fake.set("rig.get_AB", step.txVFO)
+		if data, err := client.GetData(); err != nil || data.Split != step.want {
+			t.Errorf("%s: Split = %d, %v; want %d", step.name, data.Split, err, step.want)
+		}
+	}
+
+	// Without infer_split, or when flrig reports split, nothing is inferred
+	transmittingOnB := func() map[string]interface{} {
+		values := simplexFlrig()
+		values["rig.get_vfoB"] = "14225000"
+		values["rig.get_AB"] = "B"
+		values["rig.get_ptt"] = 1
+		return values
+	}
+	fake = newFakeFlrig(t, transmittingOnB())
+	for _, method := range flrigSplitMethods {
+		fake.set(method, nil)
+	}
+	plain := fake.client()
+	defer plain.Close()
+	if data, _ := plain.GetData(); data.Split != 0 {
+		t.Errorf("without infer_split Split = %d, want 0", data.Split)
+	}
+	reported := newFakeFlrig(t, transmittingOnB())
+	reporting := reported.client()
+	reporting.InferSplit = true
+	defer reporting.Close()
+	if data, _ := reporting.GetData(); data.Split != 0 || reported.count("rig.get_AB") != 0 {
+		t.Errorf("with the split state reported Split = %d and rig.get_AB read %d times; want 0 and no inference", data.Split, reported.count("rig.get_AB"))
+	}
+}
+
+func TestFlrigVFOBSplitOnly(t *testing.T) {
+	tests := []struct {
+		name         string
+		splitOnly    bool
+		split        interface{} // rig.get_split answer, nil for a rig that cannot report it
+		readsB       bool
+		freqB, modeB string
+	}{
+		{"simplex", true, 0, false, "14074000", "USB"},
+		{"split", true, 1, true, "14076000", "CW"},
+		{"split state unknown", true, nil, true, "14076000", "CW"},
+		{"simplex without vfo_b_split_only", false, 0, true, "14076000", "CW"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := simplexFlrig()
+			values["rig.get_vfoB"] = "14076000"
+			values["rig.get_modeB"] = "CW"
+			fake := newFakeFlrig(t, values)
+			if tt.split == nil {
+				for _, method := range flrigSplitMethods {
+					fake.set(method, nil)
+				}
+			} else {
+				fake.set("rig.get_split", tt.split)
+			}
+			client := fake.client()
+			client.VFOBSplitOnly = tt.splitOnly
+			defer client.Close()
+			data, err := client.GetData()
+			if err != nil {
+				t.Fatal(err)
+			}
+			reads := fake.count("rig.get_vfoB") + fake.count("rig.get_modeB")
+			if (reads > 0) != tt.readsB {
+				t.Errorf("%d VFO B reads, want reads %v", reads, tt.readsB)
+			}
+			if got := strconv.FormatFloat(data.FreqVFOB, 'f', -1, 64); got != tt.freqB || data.ModeB != tt.modeB {
+				t.Errorf("VFO B = %s %s, want %s %s", got, data.ModeB, tt.freqB, tt.modeB)
+			}
+		})
+	}
+}
+
+func TestBuildPayloadFollowPTT(t *testing.T) {
+	split := RigData{FreqVFOA: 14195000, FreqVFOB: 14225000, Mode: "USB", ModeB: "USB", Split: 1}
+	tests := []struct {
+		name        string
+		followPTT   bool
+		ptt         bool
+		frequency   int
+		frequencyRX int
+	}{
+		{"unkeyed", true, false, 14195000, 14195000},
+		{"keyed", true, true, 14225000, 14195000},
+		{"without follow_ptt unkeyed", false, false, 14225000, 14195000},
+		{"without follow_ptt keyed", false, true, 14225000, 14195000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := split
+			data.PTT = tt.ptt
+			payload := buildPayload(ProfileConfig{RadioName: "FTdx10", FollowPTT: tt.followPTT}, data)
+			if payload.Frequency != tt.frequency || payload.FrequencyRX != tt.frequencyRX {
+				t.Errorf("frequency = %d, frequency_rx = %d; want %d, %d", payload.Frequency, payload.FrequencyRX, tt.frequency, tt.frequencyRX)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error that timed out, as returned by a connection deadline.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientConnError(t *testing.T) {
+	opErr := func(op string, err error) error {
+		return &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", opErr("dial", syscall.ECONNREFUSED), true},
+		{"reset by peer", opErr("read", syscall.ECONNRESET), true},
+		{"connection aborted", opErr("read", syscall.ECONNABORTED), true},
+		{"broken pipe", opErr("write", syscall.EPIPE), true},
+		{"no route to host", opErr("dial", syscall.EHOSTUNREACH), true},
+		{"network unreachable", opErr("dial", syscall.ENETUNREACH), true},
+		{"timed out errno", opErr("read", syscall.ETIMEDOUT), true},
+		{"deadline", fmt.Errorf("failed to read 'f' response from hamlib: %w", timeoutError{}), true},
+		{"EOF", fmt.Errorf("call failed to rig.get_vfo: %w", io.EOF), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"failed dial", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("lookup rig.invalid: no such host")}, true},
+		{"reconnect backoff", fmt.Errorf("flrig %w in 2s", errReconnectBackoff), true},
+		{"permission denied", opErr("write", syscall.EACCES), false},
+		{"parse error", &ParseError{What: "vfo frequency", Value: "abc", Err: strconv.ErrSyntax}, false},
+		{"RPRT error", errors.New("hamlib command 'f' failed: RPRT -9"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientConnError(tt.err); got != tt.want {
+				t.Errorf("isTransientConnError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransientConnErrorRealDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, err = net.DialTimeout("tcp", addr, time.Second)
+	if err == nil || !isTransientConnError(err) {
+		t.Errorf("dialing a closed port: %v, want a transient error", err)
+	}
+}
+
+func TestRepeatFilter(t *testing.T) {
+	errA, errB := errors.New("connection refused"), errors.New("RPRT -9")
+	tests := []struct {
+		name   string
+		filter repeatFilter
+		errs   []error
+		shown  []bool
+		counts []int
+	}{
+		{"first shown, repeats suppressed", repeatFilter{Every: 3}, []error{errA, errA, errA, errA, errA}, []bool{true, false, false, true, false}, []int{1, 2, 3, 4, 5}},
+		{"a different error is shown", repeatFilter{Every: 3}, []error{errA, errA, errB, errA}, []bool{true, false, true, true}, []int{1, 2, 1, 1}},
+		{"every error with Every 1", repeatFilter{Every: 1}, []error{errA, errA, errA}, []bool{true, true, true}, []int{1, 2, 3}},
+		{"every error with Every 0", repeatFilter{}, []error{errA, errA}, []bool{true, true}, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, err := range tt.errs {
+				shown, count := tt.filter.Allow(err)
+				if shown != tt.shown[i] || count != tt.counts[i] {
+					t.Errorf("error %d (%v): Allow = %v, %d; want %v, %d", i+1, err, shown, count, tt.shown[i], tt.counts[i])
+				}
+			}
+		})
+	}
+
+	f := repeatFilter{Every: 3}
+	f.Allow(errA)
+	f.Allow(errA)
+	f.Reset()
+	if shown, count := f.Allow(errA); !shown || count != 1 {
+		t.Errorf("after Reset: Allow = %v, %d; want true, 1", shown, count)
+	}
+}
+
+func TestRepeatMessage(t *testing.T) {
+	err := errors.New("connection refused")
+	tests := []struct {
+		action string
+		count  int
+		want   string
+	}{
+		{"fetch radio data", 1, "Failed to fetch radio data: connection refused"},
+		{"fetch radio data", 61, "Still failing to fetch radio data (61 times): connection refused"},
+		{"post to Wavelog", 1, "Failed to post to Wavelog: connection refused"},
+		{"post to Wavelog", 2, "Still failing to post to Wavelog (2 times): connection refused"},
+	}
+	for _, tt := range tests {
+		if got := repeatMessage(tt.action, tt.count, err); got != tt.want {
+			t.Errorf("repeatMessage(%q, %d) = %q, want %q", tt.action, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestRepeatedPostErrorsAreSummarized(t *testing.T) {
+	wavelog := newFakeWavelog(t, http.StatusInternalServerError, `down for maintenance`)
+	radio := newFakeFlrig(t, simplexFlrig()).client()
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := ConfigFile{DefaultProfile: "home", Profiles: map[string]ProfileConfig{"home": {
+		WavelogURL: wavelog.URL + "/index.php", WavelogKey: "key", RadioName: "IC-7300",
+		DataSource: "flrig", FlrigHost: radio.Host, FlrigPort: radio.Port, Interval: "20ms", ErrorSummaryEvery: 3,
+	}}}
+	if err := saveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	p := startMain(t, nil, "-config", path)
+	p.waitForOutput(t, "Still failing to post to Wavelog (7 times)")
+	out := p.output.String()
+	if n := strings.Count(out, "Failed to post to Wavelog"); n != 1 {
+		t.Errorf("first failure logged %d times, want once:\n%s", n, out)
+	}
+	if !strings.Contains(out, "Still failing to post to Wavelog (4 times)") || strings.Contains(out, "(2 times)") || strings.Contains(out, "(3 times)") {
+		t.Errorf("repeats not summarized every 3 failures:\n%s", out)
+	}
+}
+
+func TestWaitForRadio(t *testing.T) {
+	wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+	flrig := newFakeFlrig(t, simplexFlrig())
+	flrig.set("rig.get_vfo", nil) // flrig is up but the rig is not yet connected
+	radio := flrig.client()
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := ConfigFile{DefaultProfile: "home", Profiles: map[string]ProfileConfig{"home": {
+		WavelogURL: wavelog.URL + "/index.php", WavelogKey: "key", RadioName: "IC-7300", LogLevel: "debug",
+		DataSource: "flrig", FlrigHost: radio.Host, FlrigPort: radio.Port, Interval: "20ms", WaitForRadio: true,
+	}}}
+	if err := saveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	p := startMain(t, nil, "-config", path)
+
+	// Failures while waiting are only logged at debug level, and nothing is posted
+	p.waitForOutput(t, "Waiting for the radio to become reachable (attempt 11)")
+	if out := p.output.String(); strings.Contains(out, "level=error") {
+		t.Errorf("errors logged while waiting for the radio:\n%s", out)
+	}
+	wavelog.mu.Lock()
+	posted := len(wavelog.payloads)
+	wavelog.mu.Unlock()
+	if posted != 0 {
+		t.Errorf("%d updates posted before the radio was reachable", posted)
+	}
+
+	// The first successful read starts normal operation...
+	flrig.set("rig.get_vfo", "14074000")
+	p.waitForOutput(t, "Radio is reachable after")
+	wavelog.waitForPayload(t, "14074000", func(r WavelogJSONRequest) bool { return r.Frequency == 14074000 })
+
+	// ...after which failures are reported as usual
+	flrig.set("rig.get_vfo", nil)
+	p.waitForOutput(t, "Failed to fetch radio data")
+}
+
+func TestQRPPowerEndToEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		power interface{} // rig.get_power answer
+	}{
+		{"double", 0.5},
+		{"string", "0.5"},
+	}
+	for _, tt := range tests {
+		t.Run("flrig "+tt.name, func(t *testing.T) {
+			fake := newFakeFlrig(t, simplexFlrig())
+			fake.set("rig.get_power", tt.power)
+			client := fake.client()
+			defer client.Close()
+			data, err := client.GetData()
+			if err != nil {
+				t.Fatalf("GetData: %v", err)
+			}
+
+			wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+			if err := wavelog.post(t, ProfileConfig{RadioName: "KX2"}, data); err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			if got := wavelog.lastPayload(t).Power; got != 0.5 {
+				t.Errorf("power sent = %v, want 0.5", got)
+			}
+		})
+	}
+	t.Run("hamlib", func(t *testing.T) {
+		_, client := newFakeRigctld(t, map[string]string{
+			"f": "7030000", "m": "CW\n500", "l RFPOWER": "0.005", "t": "0", "s": "0\nVFOA",
+		}, false)
+		data, err := client.GetData()
+		if err != nil {
+			t.Fatalf("GetData: %v", err)
+		}
+		if math.Abs(data.Power-0.5) > 1e-9 {
+			t.Errorf("power = %v, want 0.5", data.Power)
+		}
+	})
+}
+
+func TestPostOnTXOnly(t *testing.T) {
+	rx := RigData{FreqVFOA: 14074000, Mode: "USB", Power: 50}
+	tuned := rx
+	tuned.FreqVFOA = 14076000
+	tx := tuned
+	tx.PTT = true
+
+	// Run the sequence through the loop's gating and change checks, remembering what was sent
+	config := ProfileConfig{PostOnTXOnly: true}
+	sequence := []struct {
+		name string
+		data RigData
+		sent bool
+	}{
+		{"listening", rx, false},
+		{"tuning while receiving", tuned, false},
+		{"keyed", tx, true},
+		{"still keyed", tx, false},
+		{"TX dropped", tuned, true},
+		{"receiving after TX", tuned, false},
+		{"tuning after TX", rx, false},
+	}
+	var last RigData
+	for _, step := range sequence {
+		sent := !txGated(config, step.data, last) && hasMeaningfulChange(step.data, last, powerThreshold{})
+		if sent != step.sent {
+			t.Errorf("%s: sent = %v, want %v", step.name, sent, step.sent)
+		}
+		if sent {
+			last = step.data
+		}
+	}
+
+	if txGated(ProfileConfig{}, rx, rx) {
+		t.Error("updates gated without post_on_tx_only")
+	}
+}
+
+func TestTimestampSerialization(t *testing.T) {
+	readAt := time.Date(2026, 3, 14, 15, 9, 26, 500000000, time.FixedZone("EST", -5*3600))
+	tests := []struct {
+		name   string
+		format string
+		readAt time.Time
+		want   string // the timestamp member of the JSON, "" when omitted
+	}{
+		{"off", "", readAt, ""},
+		{"rfc3339", "rfc3339", readAt, `"timestamp":"2026-03-14T20:09:26Z"`},
+		{"epoch", "epoch", readAt, `"timestamp":1773518966`},
+		{"upper case", "RFC3339", readAt, `"timestamp":"2026-03-14T20:09:26Z"`},
+		{"read time unknown", "epoch", time.Time{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := ProfileConfig{RadioName: "IC-7300", SendTimestamp: tt.format}
+			body, err := json.Marshal(buildPayload(config, RigData{FreqVFOA: 14074000, Mode: "USB", ReadAt: tt.readAt}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" && strings.Contains(string(body), "timestamp") {
+				t.Errorf("payload %s contains a timestamp", body)
+			}
+			if tt.want != "" && !strings.Contains(string(body), tt.want) {
+				t.Errorf("payload %s does not contain %s", body, tt.want)
+			}
+		})
+	}
+}
+
+// splitFlrig is a transceiver working split on 20m with every optional read answered.
+func splitFlrig() map[string]interface{} {
+	values := simplexFlrig()
+	values["rig.get_vfoB"] = "14076000"
+	values["rig.get_modeB"] = "CW"
+	values["rig.get_split"] = 1
+	values["rig.get_ptt"] = 1
+	values["rig.get_rit"] = 120
+	values["rig.get_swrmeter"] = 1.4
+	return values
+}
+
+func TestFlrigParallelReadsMatchSerial(t *testing.T) {
+	for name, values := range map[string]map[string]interface{}{"simplex": simplexFlrig(), "split": splitFlrig()} {
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeFlrig(t, values)
+			serial, parallel := fake.client(), fake.client()
+			serial.concurrency = 1
+			defer serial.Close()
+			defer parallel.Close()
+
+			want, err := serial.GetData()
+			if err != nil {
+				t.Fatalf("serial GetData: %v", err)
+			}
+			for i := 0; i < 5; i++ {
+				got, err := parallel.GetData()
+				if err != nil {
+					t.Fatalf("parallel GetData: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("parallel GetData = %+v, want the serial result %+v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFlrigGetData(b *testing.B) {
+	fake := newFakeFlrig(b, splitFlrig())
+	fake.delay = time.Millisecond // a round trip to flrig on another host
+	for _, bm := range []struct {
+		name        string
+		concurrency int
+	}{{"serial", 1}, {"parallel", flrigConcurrency}} {
+		b.Run(bm.name, func(b *testing.B) {
+			client := fake.client()
+			client.concurrency = bm.concurrency
+			defer client.Close()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.GetData(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTXPowerMemory(t *testing.T) {
+	var m txPowerMemory
+	steps := []struct {
+		name    string
+		data    RigData
+		want    float64
+		noPower bool
+	}{
+		{"receiving before any TX", RigData{Power: 100}, 0, false},
+		{"transmitting", RigData{PTT: true, Power: 35}, 35, false},
+		{"receiving after TX", RigData{Power: 100}, 35, false},
+		{"transmitting with a dropped reading", RigData{PTT: true, NoPower: true}, 0, true},
+		{"receiving keeps the last real TX power", RigData{Power: 100, NoPower: true}, 35, false},
+		{"transmitting at a new level", RigData{PTT: true, Power: 5}, 5, false},
+		{"receiving again", RigData{Power: 100}, 5, false},
+	}
+	for _, s := range steps {
+		got := m.Apply(s.data)
+		if got.Power != s.want || got.NoPower != s.noPower {
+			t.Errorf("%s: power %g (NoPower %v), want %g (NoPower %v)", s.name, got.Power, got.NoPower, s.want, s.noPower)
+		}
+	}
+}
+
+func TestNewHamlibClientKeepAlive(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", defaultHamlibKeepAlive, false},
+		{"15s", 15 * time.Second, false},
+		{"0", 0, false},
+		{"often", 0, true},
+	}
+	for _, tt := range tests {
+		client, err := newHamlibClient(ProfileConfig{HamlibKeepAlive: tt.setting}, "127.0.0.1", 4532)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("hamlib_keepalive %q: error %v, want error %v", tt.setting, err, tt.wantErr)
+			continue
+		}
+		if err == nil && client.KeepAlive != tt.want {
+			t.Errorf("hamlib_keepalive %q: KeepAlive = %s, want %s", tt.setting, client.KeepAlive, tt.want)
+		}
+	}
+}
+
+func TestNewHamlibClientConnectTimeout(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", defaultHamlibConnectTimeout, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		client, err := newHamlibClient(ProfileConfig{HamlibConnectTimeout: tt.setting}, "127.0.0.1", 4532)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("hamlib_connect_timeout %q: error %v, want error %v", tt.setting, err, tt.wantErr)
+			continue
+		}
+		if err == nil && client.DialTimeout != tt.want {
+			t.Errorf("hamlib_connect_timeout %q: DialTimeout = %s, want %s", tt.setting, client.DialTimeout, tt.want)
+		}
+	}
+}
+
+func TestHamlibConnectTimeoutUnroutable(t *testing.T) {
+	// 10.255.255.1 is private and normally unrouted, so connecting to it either hangs
+	// until the deadline or fails at once, but never for the OS default
+	client := &HamlibClient{Host: "10.255.255.1", Port: 4532, DialTimeout: 200 * time.Millisecond}
+	start := time.Now()
+	_, err := client.GetData()
+	if err == nil {
+		t.Fatal("GetData from an unroutable rigctld succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("connecting to an unroutable rigctld took %s, want the 200ms connect timeout", elapsed.Round(time.Millisecond))
+	}
+}
+
+func TestPostOffline(t *testing.T) {
+	wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+	config := ProfileConfig{RadioName: "IC-7300", WavelogURL: wavelog.URL, ClearOnExit: true}
+	client, err := newWavelogClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiURL string
+	last := RigData{FreqVFOA: 14074000, Mode: "USB", Power: 100, PTT: true}
+	if err := postOffline(client, config, last, &apiURL); err != nil {
+		t.Fatalf("postOffline: %v", err)
+	}
+
+	// Power must be sent as 0 rather than left out, which would keep the last power
+	wavelog.mu.Lock()
+	n := len(wavelog.payloads)
+	wavelog.mu.Unlock()
+	payload := wavelog.lastPayload(t)
+	if n != 1 || payload.Frequency != 14074000 || payload.Mode != "USB" || payload.Power != 0.0 {
+		t.Errorf("%d shutdown POSTs, last %+v; want one at 14074000 USB with power 0", n, payload)
+	}
+}
+
+func TestRepeaterShift(t *testing.T) {
+	tests := []struct {
+		name      string
+		shift     string // 'r' response
+		offset    string // 'o' response
+		want      float64
+		frequency int
+	}{
+		{"plus", "+", "600000", 600000, 146940000 + 600000},
+		{"minus", "-", "600000", -600000, 146940000 - 600000},
+		{"minus with signed offset", "-", "-5000000", -5000000, 146940000 - 5000000},
+		{"simplex", "None", "600000", 0, 146940000},
+		{"unsupported", "RPRT -11", "", 0, 146940000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]string{"f": "146940000", "m": "FM\n15000", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA", "r": tt.shift}
+			if tt.offset != "" {
+				responses["o"] = tt.offset
+			}
+			_, client := newFakeRigctld(t, responses, false)
+			data, err := client.GetData()
+			if err != nil {
+				t.Fatalf("GetData: %v", err)
+			}
+			if data.Shift != tt.want {
+				t.Errorf("Shift = %g, want %g", data.Shift, tt.want)
+			}
+			payload := buildPayload(ProfileConfig{RadioName: "FT-2980"}, data)
+			if payload.Frequency != tt.frequency {
+				t.Errorf("frequency = %d, want TX %d", payload.Frequency, tt.frequency)
+			}
+			if tt.want != 0 && payload.FrequencyRX != 146940000 {
+				t.Errorf("frequency_rx = %d, want the repeater output 146940000", payload.FrequencyRX)
+			}
+		})
+	}
+}
+
+func TestFlrigOverHTTPSWithBasicAuth(t *testing.T) {
+	f := &fakeFlrig{values: simplexFlrig(), calls: make(map[string]int)}
+	f.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "op" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		f.serve(w, r)
+	}))
+	f.Config.ErrorLog = stdlog.New(io.Discard, "", 0)
+	f.StartTLS()
+	defer f.Close()
+
+	client := f.client()
+	client.Scheme = "https"
+	client.Username, client.Password = "op", "secret"
+	client.transport = f.Server.Client().Transport
+	defer client.Close()
+	data, err := client.GetData()
+	if err != nil {
+		t.Fatalf("GetData over HTTPS: %v", err)
+	}
+	if data.FreqVFOA != 14074000 || data.Mode != "USB" {
+		t.Errorf("GetData over HTTPS = %+v", data)
+	}
+
+	wrong := f.client()
+	wrong.Scheme = "https"
+	wrong.Username, wrong.Password = "op", "wrong"
+	wrong.transport = f.Server.Client().Transport
+	defer wrong.Close()
+	if _, err := wrong.GetData(); err == nil {
+		t.Error("GetData with the wrong password succeeded")
+	}
+
+	plain := f.client()
+	plain.Username, plain.Password = "op", "secret"
+	defer plain.Close()
+	if _, err := plain.GetData(); err == nil {
+		t.Error("GetData over plain HTTP to an HTTPS server succeeded")
+	}
+}
+
+func TestModeDebouncerTransientMode(t *testing.T) {
+	d := &modeDebouncer{settle: 2 * time.Second}
+	posted := RigData{FreqVFOA: 14074000, Mode: "USB", ModeB: "USB"}
+	start := time.Now()
+
+	// Switching USB to CW briefly reports AM; neither is sent until CW has settled
+	steps := []struct {
+		at   time.Duration
+		mode string
+		want string
+	}{
+		{0, "AM", "USB"},
+		{500 * time.Millisecond, "CW", "USB"},
+		{2 * time.Second, "CW", "USB"},
+		{2500 * time.Millisecond, "CW", "CW"},
+	}
+	for _, s := range steps {
+		current := RigData{FreqVFOA: 14074000, Mode: s.mode, ModeB: s.mode}
+		got := d.Apply(current, posted, start.Add(s.at))
+		if got.Mode != s.want || got.ModeB != s.want {
+			t.Errorf("at %s with %s reported, mode = %s/%s; want %s", s.at, s.mode, got.Mode, got.ModeB, s.want)
+		}
+		if hasMeaningfulChange(got, posted, powerThreshold{}) != (s.want != posted.Mode) {
+			t.Errorf("at %s a change was detected for mode %s", s.at, got.Mode)
+		}
+	}
+
+	// A frequency change is not held back while the mode settles
+	d = &modeDebouncer{settle: 2 * time.Second}
+	got := d.Apply(RigData{FreqVFOA: 14075000, Mode: "AM", ModeB: "AM"}, posted, start)
+	if got.FreqVFOA != 14075000 || got.Mode != "USB" || !hasMeaningfulChange(got, posted, powerThreshold{}) {
+		t.Errorf("frequency change during a transient mode = %+v, want it sent with USB", got)
+	}
+
+	// A mode seen again after reverting starts a new settle window
+	d = &modeDebouncer{settle: 2 * time.Second}
+	d.Apply(RigData{Mode: "AM", ModeB: "AM"}, posted, start)
+	d.Apply(posted, posted, start.Add(time.Second))
+	if got := d.Apply(RigData{Mode: "AM", ModeB: "AM"}, posted, start.Add(2*time.Second)); got.Mode != "USB" {
+		t.Errorf("mode AM seen again after reverting was sent at once")
+	}
+
+	// Without a settle time modes are sent at once
+	if got := (&modeDebouncer{}).Apply(RigData{Mode: "AM"}, posted, start); got.Mode != "AM" {
+		t.Errorf("without mode_settle mode = %s, want AM", got.Mode)
+	}
+}
+
+func TestParseFlrigNumber(t *testing.T) {
+	tests := []struct {
+		reply interface{}
+		want  float64
+		ok    bool
+	}{
+		{int64(100), 100, true},
+		{1.5, 1.5, true},
+		{"2.3", 2.3, true},
+		{" 1.1 \n", 1.1, true},
+		{"", 0, false},
+		{"n/a", 0, false},
+		{nil, 0, false},
+		{[]interface{}{"1.5"}, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseFlrigNumber(tt.reply); got != tt.want || ok != tt.ok {
+			t.Errorf("parseFlrigNumber(%#v) = %v, %v; want %v, %v", tt.reply, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFlrigSWRMeter(t *testing.T) {
+	values := simplexFlrig()
+	values["rig.get_swrmeter"] = "1.8"
+	rig := newFakeFlrig(t, values)
+	client := rig.client()
+	defer client.Close()
+
+	// The meter is only read while transmitting
+	data, err := client.GetData()
+	if err != nil || data.SWR != 0 || rig.count("rig.get_swrmeter") != 0 {
+		t.Errorf("receiving: SWR = %v, %d meter reads, %v; want no reads", data.SWR, rig.count("rig.get_swrmeter"), err)
+	}
+	rig.set("rig.get_ptt", 1)
+	if data, err = client.GetData(); err != nil || data.SWR != 1.8 {
+		t.Errorf("transmitting: SWR = %v, %v; want 1.8", data.SWR, err)
+	}
+	// Fluctuating SWR readings are not a change of state
+	other := data
+	other.SWR = 2.1
+	if !sameState(data, other) {
+		t.Error("a different SWR reading counts as a change of state")
+	}
+
+	// A rig without an SWR meter is not asked again on this connection
+	rig.set("rig.get_swrmeter", nil)
+	client.GetData()
+	client.GetData()
+	if n := rig.count("rig.get_swrmeter"); n != 2 {
+		t.Errorf("rig.get_swrmeter called %d times, want it skipped after the fault", n)
+	}
+}
+
+func TestHamlibSWRMeter(t *testing.T) {
+	rig, client := newFakeRigctld(t, map[string]string{
+		"f": "14074000", "m": "USB\n2400", "l RFPOWER": "0.5", "t": "1", "s": "0\nVFOA",
+		"l SWR": "1.500000",
+	}, false)
+	data, err := client.GetData()
+	if err != nil || data.SWR != 1.5 {
+		t.Errorf("transmitting: SWR = %v, %v; want 1.5", data.SWR, err)
+	}
+	payload := buildPayload(ProfileConfig{RadioName: "IC-7300", SendSWR: true}, data)
+	if payload.SWR != 1.5 {
+		t.Errorf("payload SWR = %v with send_swr, want 1.5", payload.SWR)
+	}
+	if payload := buildPayload(ProfileConfig{RadioName: "IC-7300"}, data); payload.SWR != 0 {
+		t.Errorf("payload SWR = %v without send_swr, want it omitted", payload.SWR)
+	}
+
+	// A rig without the level answers with an error and the reading is skipped
+	rig2, client2 := newFakeRigctld(t, map[string]string{
+		"f": "14074000", "m": "USB\n2400", "l RFPOWER": "0.5", "t": "1", "s": "0\nVFOA",
+	}, false)
+	if data, err := client2.GetData(); err != nil || data.SWR != 0 {
+		t.Errorf("without an SWR meter: SWR = %v, %v; want 0 and no error", data.SWR, err)
+	}
+	for _, r := range []*fakeRigctld{rig, rig2} {
+		if !strings.Contains(strings.Join(r.sent(), "\n"), "l SWR") {
+			t.Errorf("SWR not read while transmitting (sent %q)", r.sent())
+		}
+	}
+}
+
+func TestExpandRadioName(t *testing.T) {
+	tests := []struct {
+		name string
+		freq float64
+		mode string
+		want string
+	}{
+		{"IC-7300", 14074000, "USB", "IC-7300"},
+		{"IC-7300 {band}", 14074000, "USB", "IC-7300 20m"},
+		{"IC-7300 {mode}", 7030000, "CW", "IC-7300 CW"},
+		{"{band}-{mode}-{band}", 50313000, "DATA", "6m-DATA-6m"},
+		{"IC-7300 {band}", 15000000, "AM", "IC-7300 "},
+		{"IC-7300 {vfo}", 14074000, "USB", "IC-7300 {vfo}"},
+	}
+	for _, tt := range tests {
+		if got := expandRadioName(tt.name, tt.freq, tt.mode); got != tt.want {
+			t.Errorf("expandRadioName(%q, %v, %q) = %q, want %q", tt.name, tt.freq, tt.mode, got, tt.want)
+		}
+	}
+
+	// The payload uses the band and the translated mode of the TX side
+	config := ProfileConfig{RadioName: "FT-991 {band} {mode}"}
+	data := RigData{FreqVFOA: 7074000, FreqVFOB: 14074000, Mode: "LSB", ModeB: "PKTUSB", Split: 1}
+	if payload := buildPayload(config, data); payload.Radio != "FT-991 20m DATA" {
+		t.Errorf("payload radio = %q, want %q", payload.Radio, "FT-991 20m DATA")
+	}
+}
+
+func TestHamlibPoweredOff(t *testing.T) {
+	rigOn := map[string]string{"f": "14074000", "m": "USB\n2400", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA"}
+
+	off := map[string]string{`\get_powerstat`: "0"}
+	rig, client := newFakeRigctld(t, off, false)
+	if _, err := client.GetData(); !errors.Is(err, errRigPoweredOff) {
+		t.Errorf("GetData with the rig off = %v, want errRigPoweredOff", err)
+	}
+	if isTransientConnError(errRigPoweredOff) {
+		t.Error("a powered-off rig is reported as a connection error")
+	}
+	if got := rig.sent(); !reflect.DeepEqual(got, []string{`\get_powerstat`}) {
+		t.Errorf("commands with the rig off = %q, want only the power status read", got)
+	}
+	if client.sess == nil {
+		t.Error("the session was dropped while the rig is off")
+	}
+
+	// Rigs that are on, or that cannot report their power status, are read as usual
+	for name, powerstat := range map[string]string{"on": "1", "unsupported": "RPRT -11"} {
+		responses := map[string]string{`\get_powerstat`: powerstat}
+		for k, v := range rigOn {
+			responses[k] = v
+		}
+		_, client := newFakeRigctld(t, responses, false)
+		if data, err := client.GetData(); err != nil || data.FreqVFOA != 14074000 {
+			t.Errorf("%s: GetData = %+v, %v; want 14074000", name, data, err)
+		}
+	}
+}
+
+// sequenceClient returns its results in turn, repeating the last one.
+type sequenceClient struct {
+	results []error
+	calls   int
+}
+
+func (s *sequenceClient) GetData() (RigData, error) {
+	err := s.results[min(s.calls, len(s.results)-1)]
+	s.calls++
+	if err != nil {
+		return RigData{}, err
+	}
+	return RigData{FreqVFOA: 14074000}, nil
+}
+
+func TestReadRadioRetriesParseErrors(t *testing.T) {
+	malformed := &ParseError{What: "vfo frequency", Value: "14074000RPRT 0", Err: strconv.ErrSyntax}
+	tests := []struct {
+		name    string
+		results []error
+		retries int
+		calls   int
+		wantErr bool
+	}{
+		{"malformed then clean", []error{malformed, nil}, 2, 2, false},
+		{"always malformed", []error{malformed}, 2, 3, true},
+		{"retries off", []error{malformed, nil}, 0, 1, true},
+		{"connection errors are not retried", []error{syscall.ECONNREFUSED, nil}, 2, 1, true},
+		{"retries capped", []error{malformed}, 100, maxParseRetries + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &sequenceClient{results: tt.results}
+			data, err := readRadio(client, tt.retries)
+			if (err != nil) != tt.wantErr || client.calls != tt.calls {
+				t.Errorf("readRadio = %v after %d reads; want error %v after %d", err, client.calls, tt.wantErr, tt.calls)
+			}
+			if !tt.wantErr && data.FreqVFOA != 14074000 {
+				t.Errorf("readRadio = %+v, want the clean re-read", data)
+			}
+		})
+	}
+}
+
+func TestParseRetriesDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"profiles": {"old": {"radio_name": "IC-7300"}, "off": {"parse_retries": 0}, "more": {"parse_retries": 4}}}`), 0600)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int{"old": defaultParseRetries, "off": 0, "more": 4} {
+		if got := parseRetries(cfg.Profiles[name]); got != want {
+			t.Errorf("profile %s parse_retries = %d, want %d", name, got, want)
+		}
+	}
+	if err := saveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ = loadConfig(path); parseRetries(cfg.Profiles["off"]) != 0 || parseRetries(cfg.Profiles["old"]) != defaultParseRetries {
+		t.Errorf("parse_retries not kept when the profiles are saved again: %+v", cfg.Profiles)
+	}
+}
+
+func TestCheckPlausiblePower(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       float64
+		handling  string
+		power     float64
+		wantPower interface{} // in the payload, nil when left out
+	}{
+		{"in range", 200, "clamp", 100, 100.0},
+		{"at the maximum", 200, "clamp", 200, 200.0},
+		{"QRP", 200, "drop", 0.5, 0.5},
+		{"clamped", 200, "clamp", 2400, 200.0},
+		{"clamped by default", 200, "", 2400, 200.0},
+		{"dropped", 200, "drop", 2400, nil},
+		{"dropped, any case", 200, "DROP", 2400, nil},
+		{"no maximum", 0, "drop", 2400, 2400.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := ProfileConfig{RadioName: "IC-7300", MaxPlausiblePower: tt.max, ImplausiblePower: tt.handling}
+			data := checkPlausiblePower(config, RigData{FreqVFOA: 14074000, Mode: "USB", Power: tt.power})
+			if got := buildPayload(config, data).Power; got != tt.wantPower {
+				t.Errorf("payload power for %g W = %v, want %v", tt.power, got, tt.wantPower)
+			}
+		})
+	}
+
+	valid := ProfileConfig{WavelogKey: "key", WavelogURL: "http://localhost/index.php", Interval: "1s", MaxPlausiblePower: 200}
+	for _, handling := range []string{"clamp", "drop", ""} {
+		config := valid
+		config.ImplausiblePower = handling
+		if err := validateProfile(config, ""); err != nil {
+			t.Errorf("implausible_power %q rejected: %v", handling, err)
+		}
+	}
+	config := valid
+	config.ImplausiblePower = "ignore"
+	if err := validateProfile(config, ""); err == nil {
+		t.Error("implausible_power \"ignore\" accepted")
+	}
+	config = valid
+	config.MaxPlausiblePower = -1
+	if err := validateProfile(config, ""); err == nil {
+		t.Error("negative max_plausible_power accepted")
+	}
+}
+
+func TestParseMemoryChannel(t *testing.T) {
+	tests := []struct{ resp, want string }{
+		{"12", "12"},
+		{"0", "0"},
+		{" 7 ", "7"},
+		{"007", "7"},
+		{"-1", ""},
+		{"RPRT -11", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseMemoryChannel(tt.resp); got != tt.want {
+			t.Errorf("parseMemoryChannel(%q) = %q, want %q", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestHamlibMemoryChannel(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]string
+		want      string
+	}{
+		{"memory mode", map[string]string{"v": "MEM", "e": "12"}, "12"},
+		{"on a VFO", map[string]string{"v": "VFOA", "e": "12"}, ""},
+		{"channel not readable", map[string]string{"v": "MEM"}, ""},
+		{"VFO not readable", map[string]string{"e": "12"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]string{"f": "145500000", "m": "FM\n15000", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA"}
+			for k, v := range tt.responses {
+				responses[k] = v
+			}
+			_, client := newFakeRigctld(t, responses, false)
+			data, err := client.GetData()
+			if err != nil {
+				t.Fatalf("GetData: %v", err)
+			}
+			if data.Memory != tt.want {
+				t.Errorf("memory channel = %q, want %q", data.Memory, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectPower(t *testing.T) {
+	tests := []struct {
+		name string
+		data RigData
+		want float64
+	}{
+		{"receiving", RigData{PowerSet: 100}, 100},
+		{"receiving with a stale meter reading", RigData{PowerSet: 100, PowerActual: 85}, 100},
+		{"transmitting with a meter", RigData{PTT: true, PowerSet: 100, PowerActual: 85}, 85},
+		{"transmitting without a meter", RigData{PTT: true, PowerSet: 100}, 100},
+		{"QRP", RigData{PTT: true, PowerSet: 5, PowerActual: 4.5}, 4.5},
+		{"nothing known", RigData{}, 0},
+	}
+	for _, tt := range tests {
+		if got := selectPower(tt.data); got != tt.want {
+			t.Errorf("%s: selectPower = %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMeasuredPower(t *testing.T) {
+	values := simplexFlrig()
+	values["rig.get_power"] = 100
+	values["rig.get_ptt"] = 1
+	values[defaultPowerMeter] = 85
+	rig := newFakeFlrig(t, values)
+	client := rig.client()
+	client.MeasuredPower = true
+	defer client.Close()
+	data, err := client.GetData()
+	if err != nil || data.PowerSet != 100 || data.PowerActual != 85 || data.Power != 85 {
+		t.Errorf("flrig transmitting = set %g W, measured %g W, sent %g W, %v; want 100, 85, 85", data.PowerSet, data.PowerActual, data.Power, err)
+	}
+	rig.set("rig.get_ptt", 0)
+	if data, _ := client.GetData(); data.PowerActual != 0 || data.Power != 100 {
+		t.Errorf("flrig receiving = measured %g W, sent %g W; want no meter read and 100", data.PowerActual, data.Power)
+	}
+
+	_, hamlib := newFakeRigctld(t, map[string]string{
+		"f": "14074000", "m": "USB\n2400", "l RFPOWER": "1.0", "t": "1", "s": "0\nVFOA",
+		"l RFPOWER_METER_WATTS": "92.5",
+	}, false)
+	hamlib.MeasuredPower = true
+	data, err = hamlib.GetData()
+	if err != nil || data.PowerSet != 100 || data.PowerActual != 92.5 || data.Power != 92.5 {
+		t.Errorf("hamlib transmitting = set %g W, measured %g W, sent %g W, %v; want 100, 92.5, 92.5", data.PowerSet, data.PowerActual, data.Power, err)
+	}
+
+	// A changing meter reading alone is not a new state to send
+	other := data
+	other.PowerActual = 90
+	if !sameState(data, other) {
+		t.Error("a different meter reading counts as a change of state")
+	}
+}
+
+func TestPowerMeterMethod(t *testing.T) {
+	meters := map[string]string{"FM": "rig.get_pwrmeter", " usb ": "alc", "AM": " ", "PKTUSB": "rig.get_pwrmeter_scale"}
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"FM", "rig.get_pwrmeter"},
+		{"USB", "rig.get_alc"},
+		{"usb", "rig.get_alc"},
+		{"PKTUSB", "rig.get_pwrmeter_scale"},
+		{"AM", defaultPowerMeter},
+		{"CW", defaultPowerMeter},
+		{"", defaultPowerMeter},
+	}
+	for _, tt := range tests {
+		if got := powerMeterMethod(tt.mode, meters); got != tt.want {
+			t.Errorf("powerMeterMethod(%q) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+	if got := powerMeterMethod("USB", nil); got != defaultPowerMeter {
+		t.Errorf("powerMeterMethod without power_meters = %q, want %q", got, defaultPowerMeter)
+	}
+}
+
+func TestMeasuredPowerMeterByMode(t *testing.T) {
+	values := simplexFlrig()
+	values["rig.get_power"] = 100
+	values["rig.get_ptt"] = 1
+	values[defaultPowerMeter] = 85
+	values["rig.get_alc"] = 40
+	rig := newFakeFlrig(t, values)
+	client := rig.client()
+	client.MeasuredPower = true
+	client.PowerMeters = map[string]string{"USB": "alc"}
+	defer client.Close()
+
+	if data, err := client.GetData(); err != nil || data.PowerActual != 40 || rig.count(defaultPowerMeter) != 0 {
+		t.Errorf("transmitting USB = measured %g W, %v; want 40 W from rig.get_alc only", data.PowerActual, err)
+	}
+	rig.set("rig.get_modeA", "FM")
+	rig.set("rig.get_modeB", "FM")
+	if data, err := client.GetData(); err != nil || data.PowerActual != 85 || rig.count(defaultPowerMeter) != 1 {
+		t.Errorf("transmitting FM = measured %g W, %v; want 85 W from %s", data.PowerActual, err, defaultPowerMeter)
+	}
+}
+
+func TestLoadConfigErrorPosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"missing comma", "{\n  \"default_profile\": \"home\"\n  \"profiles\": {}\n}\n", "line 3, column 3: invalid character"},
+		{"wrong type", "{\n  \"profiles\": {\n    \"home\": {\"flrig_port\": \"12345\"}\n  }\n}\n", "line 3, column 34: json: cannot unmarshal string"},
+		{"truncated", "{\n  \"profiles\": {\n", "line 2, column 16: unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			_, err := loadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig error = %v, want %q", err, tt.want)
+			} else if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				t.Errorf("loadConfig error %v does not wrap the JSON error", err)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "profile.json")
+	if err := os.WriteFile(path, []byte("{\n  \"radio_name\": \"IC-7300\",\n}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ConfigFile{Profiles: map[string]ProfileConfig{}}
+	if err := importProfile(&cfg, "home", path); err == nil || !strings.Contains(err.Error(), "line 3, column 1:") {
+		t.Errorf("importProfile error = %v, want line 3, column 1", err)
+	}
+}
+
+func TestLoadConfigWithoutProfiles(t *testing.T) {
+	for name, contents := range map[string]string{
+		"absent": `{"default_profile": "home"}`,
+		"null":   `{"default_profile": "home", "profiles": null}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// As -save-profile does
+			cfg.Profiles["home"] = ProfileConfig{WavelogKey: "key", RadioName: "IC-7300"}
+			if err := saveConfig(path, cfg); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err = loadConfig(path)
+			if err != nil || cfg.DefaultProfile != "home" || cfg.Profiles["home"].RadioName != "IC-7300" {
+				t.Errorf("after saving a profile loadConfig = %+v, %v", cfg, err)
+			}
+		})
+	}
+
+	// Importing into a configuration without profiles works as well
+	var cfg ConfigFile
+	path := filepath.Join(t.TempDir(), "profile.json")
+	os.WriteFile(path, []byte(`{"radio_name": "IC-705"}`), 0600)
+	if err := importProfile(&cfg, "portable", path); err != nil || cfg.Profiles["portable"].RadioName != "IC-705" {
+		t.Errorf("importProfile into a nil profiles map = %+v, %v", cfg.Profiles, err)
+	}
+}
+
+func TestRadioAPIURL(t *testing.T) {
+	tests := []struct {
+		url, path, want string
+	}{
+		{"https://log.example.com/index.php", "", "https://log.example.com/index.php/api/radio"},
+		{"https://log.example.com/index.php/", "", "https://log.example.com/index.php/api/radio"},
+		{"https://log.example.com/cloudlog", "/index.php/api/radio", "https://log.example.com/cloudlog/index.php/api/radio"},
+		{"https://log.example.com", "proxy/radio", "https://log.example.com/proxy/radio"},
+		{"https://log.example.com/", "/custom/api/radio/", "https://log.example.com/custom/api/radio/"},
+	}
+	for _, tt := range tests {
+		config := ProfileConfig{WavelogURL: tt.url, APIPath: tt.path}
+		if got := radioAPIURL(config); got != tt.want {
+			t.Errorf("radioAPIURL(%q, %q) = %q, want %q", tt.url, tt.path, got, tt.want)
+		}
+	}
+
+	// Updates are posted to the custom path
+	wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+	if err := wavelog.post(t, ProfileConfig{WavelogKey: "key", APIPath: "/cloudlog/api/radio"}, RigData{FreqVFOA: 14074000, Mode: "USB"}); err != nil {
+		t.Fatal(err)
+	}
+	if wavelog.paths[0] != "/cloudlog/api/radio" {
+		t.Errorf("posted to %s, want /cloudlog/api/radio", wavelog.paths[0])
+	}
+}
+
+func TestAlternateAPIURL(t *testing.T) {
+	tests := []struct {
+		url, apiPath, want string
+	}{
+		{"https://log.example.com/index.php", "", "https://log.example.com/api/radio"},
+		{"https://log.example.com/index.php/", "", "https://log.example.com/api/radio"},
+		{"https://log.example.com", "", "https://log.example.com/index.php/api/radio"},
+		{"https://example.com/wavelog/", "", "https://example.com/wavelog/index.php/api/radio"},
+		{"https://log.example.com", "/cloudlog/api/radio", "https://log.example.com/index.php/cloudlog/api/radio"},
+	}
+	for _, tt := range tests {
+		if got := alternateAPIURL(ProfileConfig{WavelogURL: tt.url, APIPath: tt.apiPath}); got != tt.want {
+			t.Errorf("alternateAPIURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestPostToWavelogAlternatePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		answerPath string // the only path the server answers on
+		configured string // appended to the server URL as wavelog_url
+	}{
+		{"without index.php", "/api/radio", "/index.php"},
+		{"with index.php", "/index.php/api/radio", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				paths = append(paths, r.URL.Path)
+				mu.Unlock()
+				if r.URL.Path != tt.answerPath {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, `{"status":"success"}`)
+			}))
+			defer server.Close()
+			config := ProfileConfig{WavelogURL: server.URL + tt.configured, WavelogKey: "key", RadioName: "IC-7300"}
+			client, err := newWavelogClient(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logs := captureLog(t, logrus.InfoLevel)
+			data := RigData{FreqVFOA: 14074000, Mode: "USB"}
+
+			var apiURL string
+			if err := postToWavelog(client, config, data, &apiURL); err != nil {
+				t.Fatalf("first update: %v", err)
+			}
+			if apiURL != server.URL+tt.answerPath || !strings.Contains(logs.String(), "Wavelog radio API found at "+apiURL) {
+				t.Errorf("cached URL %q, logged %q; want %s", apiURL, logs, server.URL+tt.answerPath)
+			}
+			// Later updates go straight to the working path
+			if err := postToWavelog(client, config, data, &apiURL); err != nil {
+				t.Fatalf("second update: %v", err)
+			}
+			wantPaths := []string{strings.TrimSuffix(tt.configured, "/") + "/api/radio", tt.answerPath, tt.answerPath}
+			if !reflect.DeepEqual(paths, wantPaths) {
+				t.Errorf("requested %q, want %q", paths, wantPaths)
+			}
+		})
+	}
+
+	// When neither path answers, the error for the configured one is reported and
+	// nothing is cached
+	wavelog := newFakeWavelog(t, http.StatusNotFound, "not found")
+	config := ProfileConfig{WavelogURL: wavelog.URL + "/index.php", WavelogKey: "key"}
+	client, err := newWavelogClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiURL string
+	err = postToWavelog(client, config, RigData{FreqVFOA: 14074000, Mode: "USB"}, &apiURL)
+	var statusErr *wavelogStatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound || apiURL != "" {
+		t.Errorf("with no radio API postToWavelog = %v, cached %q; want a 404 and nothing cached", err, apiURL)
+	}
+	if !reflect.DeepEqual(wavelog.paths, []string{"/index.php/api/radio", "/api/radio"}) {
+		t.Errorf("requested %q, want the configured and the alternate path once each", wavelog.paths)
+	}
+
+	// Other errors are not retried on the alternate path
+	wavelog = newFakeWavelog(t, http.StatusUnauthorized, "denied")
+	if err := wavelog.post(t, ProfileConfig{WavelogKey: "key"}, RigData{FreqVFOA: 14074000, Mode: "USB"}); err == nil || len(wavelog.paths) != 1 {
+		t.Errorf("a 401 gave %v after %d requests, want the error after one", err, len(wavelog.paths))
+	}
+}
+
+func TestParsePowerThreshold(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    powerThreshold
+		wantErr bool
+	}{
+		{"", powerThreshold{}, false},
+		{"5", powerThreshold{value: 5}, false},
+		{"5W", powerThreshold{value: 5}, false},
+		{" 2.5 w ", powerThreshold{value: 2.5}, false},
+		{"10%", powerThreshold{value: 10, percent: true}, false},
+		{"10 %", powerThreshold{value: 10, percent: true}, false},
+		{"-5", powerThreshold{}, true},
+		{"lots", powerThreshold{}, true},
+		{"5dB", powerThreshold{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePowerThreshold(tt.setting)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePowerThreshold(%q) error %v, want error %v", tt.setting, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parsePowerThreshold(%q) = %+v, want %+v", tt.setting, got, tt.want)
+		}
+	}
+}
+
+func TestPowerChangeThreshold(t *testing.T) {
+	at := func(power float64) RigData {
+		return RigData{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "USB", ModeB: "USB", Power: power, PowerSet: power}
+	}
+	watts, _ := parsePowerThreshold("5")
+	percent, _ := parsePowerThreshold("10%")
+	tests := []struct {
+		name          string
+		threshold     powerThreshold
+		current, last RigData
+		want          bool
+	}{
+		{"no threshold, any change", powerThreshold{}, at(100.5), at(100), true},
+		{"no threshold, no change", powerThreshold{}, at(100), at(100), false},
+		{"watts below", watts, at(104), at(100), false},
+		{"watts at the threshold", watts, at(105), at(100), false},
+		{"watts above", watts, at(105.5), at(100), true},
+		{"watts falling above", watts, at(94), at(100), true},
+		{"percent below", percent, at(109), at(100), false},
+		{"percent at the threshold", percent, at(110), at(100), false},
+		{"percent above", percent, at(111), at(100), true},
+		{"percent falling at the threshold", percent, at(45), at(50), false},
+		{"percent falling above", percent, at(44), at(50), true},
+		{"percent from 0 W", percent, at(1), at(0), true},
+		{"frequency change with power below", watts, func() RigData { d := at(101); d.FreqVFOA = 14075000; return d }(), at(100), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasMeaningfulChange(tt.current, tt.last, tt.threshold); got != tt.want {
+				t.Errorf("hasMeaningfulChange(%g W after %g W) = %v, want %v", tt.current.Power, tt.last.Power, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitToggleIsSentAtOnce(t *testing.T) {
+	simplex := RigData{FreqVFOA: 14074000, FreqVFOB: 14074000, Mode: "USB", ModeB: "USB", Power: 100, PowerSet: 100}
+	split := simplex
+	split.Split = 1
+	splitLowerPower := split
+	splitLowerPower.Power, splitLowerPower.PowerSet = 95, 95
+	threshold, _ := parsePowerThreshold("10%")
+
+	tests := []struct {
+		name          string
+		current, last RigData
+		want          bool
+	}{
+		{"split turned on", split, simplex, true},
+		{"split turned off", simplex, split, true},
+		{"split unchanged", split, split, false},
+		{"split turned on with a power change below the threshold", splitLowerPower, simplex, true},
+	}
+	for _, tt := range tests {
+		if got := hasMeaningfulChange(tt.current, tt.last, threshold); got != tt.want {
+			t.Errorf("%s: hasMeaningfulChange = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Toggling split is not held back by mode_settle, and the payload gains the RX side
+	d := &modeDebouncer{settle: time.Minute}
+	toggled := split
+	toggled.ModeB = "CW"
+	if got := d.Apply(toggled, simplex, time.Now()); got.ModeB != "CW" {
+		t.Errorf("mode B after toggling split = %s, want CW at once", got.ModeB)
+	}
+	payload := buildPayload(ProfileConfig{RadioName: "IC-7300"}, split)
+	if payload.FrequencyRX != 14074000 || payload.Frequency != 14074000 {
+		t.Errorf("split payload = %+v, want TX and RX frequencies", payload)
+	}
+	if payload := buildPayload(ProfileConfig{RadioName: "IC-7300"}, simplex); payload.FrequencyRX != 0 {
+		t.Errorf("simplex payload has RX frequency %d", payload.FrequencyRX)
+	}
+}
+
+func TestHamlibCommand(t *testing.T) {
+	tests := []struct {
+		cmd, vfo, plain string
+	}{
+		{"f", "f currVFO", "f"},
+		{"m", "m currVFO", "m"},
+		{"l RFPOWER", "l currVFO RFPOWER", "l RFPOWER"},
+		{"s", "s currVFO", "s"},
+		{"v", "v", "v"},
+		{"V VFOB", "V VFOB", "V VFOB"},
+		{`\get_powerstat`, `\get_powerstat`, `\get_powerstat`},
+		{`\chk_vfo`, `\chk_vfo`, `\chk_vfo`},
+	}
+	for _, tt := range tests {
+		if got := hamlibCommand(tt.cmd, true); got != tt.vfo {
+			t.Errorf("hamlibCommand(%q) in VFO mode = %q, want %q", tt.cmd, got, tt.vfo)
+		}
+		if got := hamlibCommand(tt.cmd, false); got != tt.plain {
+			t.Errorf("hamlibCommand(%q) = %q, want %q", tt.cmd, got, tt.plain)
+		}
+	}
+}
+
+func TestHamlibChecksVFOMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		chkVFO    string
+		responses map[string]string
+		want      []string // the first commands of a poll after \chk_vfo
+	}{
+		{
+			name:      "rigctld --vfo",
+			chkVFO:    "1",
+			responses: map[string]string{"f currVFO": "14074000", "m currVFO": "USB\n2400", "l currVFO RFPOWER": "0.5", "t currVFO": "0", "s currVFO": "0\nVFOA"},
+			want:      []string{"f currVFO", "m currVFO"},
+		},
+		{
+			name:      "without --vfo",
+			chkVFO:    "0",
+			responses: map[string]string{"f": "14074000", "m": "USB\n2400", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA"},
+			want:      []string{"f", "m"},
+		},
+		{
+			name:      "rigctld without chk_vfo",
+			chkVFO:    "RPRT -11",
+			responses: map[string]string{"f": "14074000", "m": "USB\n2400", "l RFPOWER": "0.5", "t": "0", "s": "0\nVFOA"},
+			want:      []string{"f", "m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.responses[`\chk_vfo`] = tt.chkVFO
+			rig, client := listenFakeRigctld(t, tt.responses)
+			for i := 0; i < 2; i++ {
+				data, err := client.GetData()
+				if err != nil || data.FreqVFOA != 14074000 || data.Mode != "USB" {
+					t.Fatalf("poll %d: GetData = %+v, %v; want 14074000 USB", i+1, data, err)
+				}
+			}
+			sent := rig.sent()
+			var checks int
+			for _, cmd := range sent {
+				if cmd == `\chk_vfo` {
+					checks++
+				}
+			}
+			if checks != 1 || sent[0] != `\chk_vfo` {
+				t.Errorf("\\chk_vfo sent %d times (commands %q), want once on connecting", checks, sent)
+			}
+			var polled []string
+			for _, cmd := range sent[1:] {
+				if cmd != `\get_powerstat` {
+					polled = append(polled, cmd)
+				}
+			}
+			if !reflect.DeepEqual(polled[:len(tt.want)], tt.want) {
+				t.Errorf("polled with %q, want %q first", polled, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinimalPayloadSerialization(t *testing.T) {
+	data := RigData{
+		FreqVFOA: 14074000, FreqVFOB: 14076000, Mode: "PKTUSB", ModeB: "PKTUSB", Split: 1,
+		Power: 50, Bandwidth: 3000, BandwidthB: 3000, RIT: 100, GridSquare: "FN31pr", ReadAt: time.Now(),
+	}
+	config := ProfileConfig{
+		WavelogKey: "key", RadioName: "IC-7300", StationID: "OP2", SendBandwidth: true, SendSubmode: true,
+		DataModes: []string{"FT4"}, SendTimestamp: "epoch", SendVersion: true, SendBand: true,
+	}
+	tests := []struct {
+		name    string
+		minimal bool
+		fields  []string
+	}{
+		{"full", false, []string{"key", "radio", "frequency", "mode", "power", "frequency_rx", "mode_rx", "bandwidth", "bandwidth_rx", "my_gridsquare", "station_id", "timestamp", "software", "band"}},
+		{"minimal", true, []string{"key", "radio", "frequency", "mode"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+			config := config
+			config.MinimalPayload = tt.minimal
+			if err := wavelog.post(t, config, data); err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal([]byte(wavelog.bodies[0]), &fields); err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range tt.fields {
+				if _, ok := fields[f]; !ok {
+					t.Errorf("payload %s has no %s", wavelog.bodies[0], f)
+				}
+			}
+			if len(fields) != len(tt.fields) {
+				t.Errorf("payload %s has %d fields, want %d", wavelog.bodies[0], len(fields), len(tt.fields))
+			}
+			if tt.minimal && (fields["frequency"] != 14076000.0 || fields["mode"] != "DATA" || fields["radio"] != "IC-7300") {
+				t.Errorf("minimal payload %s, want the TX frequency and translated mode", wavelog.bodies[0])
+			}
+		})
+	}
+}
+
+func TestSendVersionSerialization(t *testing.T) {
+	data := RigData{FreqVFOA: 14074000, Mode: "USB"}
+	for _, sendVersion := range []bool{false, true} {
+		wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+		if err := wavelog.post(t, ProfileConfig{WavelogKey: "key", RadioName: "IC-7300", SendVersion: sendVersion}, data); err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(wavelog.bodies[0]), &fields); err != nil {
+			t.Fatal(err)
+		}
+		software, ok := fields["software"]
+		if ok != sendVersion {
+			t.Errorf("send_version %v: payload %s, want software only when enabled", sendVersion, wavelog.bodies[0])
+		}
+		if sendVersion && software != "WaveLogGoat/"+version {
+			t.Errorf("software = %v, want WaveLogGoat/%s", software, version)
+		}
+	}
+}
+
+func TestSendBandSerialization(t *testing.T) {
+	tests := []struct {
+		name     string
+		sendBand bool
+		data     RigData
+		band     string // "" for no band field
+	}{
+		{"disabled", false, RigData{FreqVFOA: 14074000, Mode: "USB"}, ""},
+		{"20m", true, RigData{FreqVFOA: 14074000, Mode: "USB"}, "20m"},
+		{"split across bands", true, RigData{FreqVFOA: 50313000, FreqVFOB: 7074000, Split: 1, Mode: "USB", ModeB: "USB"}, "40m"},
+		{"outside the bands", true, RigData{FreqVFOA: 162550000, Mode: "FM"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+			if err := wavelog.post(t, ProfileConfig{WavelogKey: "key", RadioName: "IC-7300", SendBand: tt.sendBand}, tt.data); err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal([]byte(wavelog.bodies[0]), &fields); err != nil {
+				t.Fatal(err)
+			}
+			band, ok := fields["band"]
+			if tt.band == "" && ok {
+				t.Errorf("payload %s has a band, want none", wavelog.bodies[0])
+			} else if tt.band != "" && band != tt.band {
+				t.Errorf("payload %s has band %v, want %s", wavelog.bodies[0], band, tt.band)
+			}
+		})
+	}
+}
+
+func TestApplyTransverterOffset(t *testing.T) {
+	tests := []struct {
+		name         string
+		offset       float64
+		data         RigData
+		freqA, freqB float64
+		band         string
+	}{
+		{"no offset", 0, RigData{FreqVFOA: 28174000, FreqVFOB: 28174000}, 28174000, 28174000, "10m"},
+		{"2m on a 10m IF", 116e6, RigData{FreqVFOA: 28174000, FreqVFOB: 28300000}, 144174000, 144300000, "2m"},
+		{"23cm on a 2m IF", 1152e6, RigData{FreqVFOA: 144200000}, 1296200000, 0, "23cm"},
+		{"3cm on a 2m IF", 10224e6, RigData{FreqVFOA: 144100000, FreqVFOB: 144100000}, 10368100000, 10368100000, "3cm"},
+		{"negative offset", -116e6, RigData{FreqVFOA: 144174000, FreqVFOB: 144174000}, 28174000, 28174000, "10m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyTransverterOffset(ProfileConfig{TransverterOffsetHz: tt.offset}, tt.data)
+			if got.FreqVFOA != tt.freqA || got.FreqVFOB != tt.freqB {
+				t.Errorf("VFOs = %g, %g; want %g, %g", got.FreqVFOA, got.FreqVFOB, tt.freqA, tt.freqB)
+			}
+			if band := bandForFrequency(got.FreqVFOA); band != tt.band {
+				t.Errorf("band of %g = %q, want %q", got.FreqVFOA, band, tt.band)
+			}
+		})
+	}
+
+	// The payload, including its band, is built from the offset frequency
+	config := ProfileConfig{RadioName: "FT-817", SendBand: true, TransverterOffsetHz: 116e6}
+	data := applyTransverterOffset(config, RigData{FreqVFOA: 28174000, FreqVFOB: 28174000, Mode: "USB", ModeB: "USB", RIT: 500})
+	if payload := buildPayload(config, data); payload.Frequency != 144174000 || payload.Band != "2m" || payload.FrequencyRX != 144174500 {
+		t.Errorf("payload = %+v, want 144174000 on 2m receiving with RIT on 144174500", payload)
+	}
+}
+
+func TestRadioNameSourceSerialization(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ProfileConfig
+		source string // RigData.Source, set by failover and auto detection
+		want   string
+	}{
+		{"disabled", ProfileConfig{RadioName: "FT-891", DataSource: "flrig"}, "", "FT-891"},
+		{"flrig", ProfileConfig{RadioName: "FT-891", DataSource: "flrig", RadioNameSource: true}, "", "FT-891-flrig"},
+		{"data source in any case", ProfileConfig{RadioName: "FT-891", DataSource: "Hamlib", RadioNameSource: true}, "", "FT-891-hamlib"},
+		{"failover", ProfileConfig{RadioName: "FT-891", DataSources: []string{"flrig", "hamlib"}, RadioNameSource: true}, "hamlib", "FT-891-hamlib"},
+		{"auto detected", ProfileConfig{RadioName: "FT-891", DataSource: "auto", RadioNameSource: true}, "flrig", "FT-891-flrig"},
+		{"after placeholders", ProfileConfig{RadioName: "FT-891 {band}", DataSource: "flrig", RadioNameSource: true}, "", "FT-891 20m-flrig"},
+		{"minimal payload", ProfileConfig{RadioName: "FT-891", DataSource: "flrig", RadioNameSource: true, MinimalPayload: true}, "", "FT-891-flrig"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavelog := newFakeWavelog(t, http.StatusOK, `{"status":"success"}`)
+			config := tt.config
+			config.WavelogKey = "key"
+			if err := wavelog.post(t, config, RigData{FreqVFOA: 14074000, Mode: "USB", Source: tt.source}); err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal([]byte(wavelog.bodies[0]), &fields); err != nil {
+				t.Fatal(err)
+			}
+			if fields["radio"] != tt.want {
+				t.Errorf("payload %s, want radio %q", wavelog.bodies[0], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errWizardCancelled is returned when the -init wizard is interrupted or its input ends.
+var errWizardCancelled = errors.New("setup cancelled")
+
+// wizard prompts for profile settings, reading answers line by line so that an
+// interrupt can cancel it while it waits for input.
+type wizard struct {
+	ctx   context.Context
+	out   io.Writer
+	lines chan string
+}
+
+func newWizard(ctx context.Context, in io.Reader, out io.Writer) *wizard {
+	w := &wizard{ctx: ctx, out: out, lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			w.lines <- scanner.Text()
+		}
+		close(w.lines)
+	}()
+	return w
+}
+
+// ask prints a prompt and returns the answer, or def if the answer is empty.
+func (w *wizard) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+	select {
+	case <-w.ctx.Done():
+		return "", errWizardCancelled
+	case line, ok := <-w.lines:
+		if !ok {
+			return "", errWizardCancelled
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			return def, nil
+		}
+		return line, nil
+	}
+}
+
+// askPort asks until the answer is a valid port number.
+func (w *wizard) askPort(prompt string, def int) (int, error) {
+	for {
+		answer, err := w.ask(prompt, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+		port, err := strconv.Atoi(answer)
+		if err == nil && port > 0 && port < 65536 {
+			return port, nil
+		}
+		fmt.Fprintf(w.out, "'%s' is not a valid port number.\n", answer)
+	}
+}
+
+// confirm asks a yes/no question, defaulting to no.
+func (w *wizard) confirm(prompt string) (bool, error) {
+	answer, err := w.ask(prompt+" [y/N]", "")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// isInteractive reports whether f is a terminal rather than a pipe or file.
+func isInteractive(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runInitWizard interactively builds a profile starting from base, checks that the radio
+// and Wavelog can be reached, and stores it in cfg as the default profile under name.
+func runInitWizard(ctx context.Context, in io.Reader, out io.Writer, cfg *ConfigFile, name string, base ProfileConfig, placeholderKey string) error {
+	w := newWizard(ctx, in, out)
+	config := base
+	if config.WavelogKey == placeholderKey {
+		config.WavelogKey = ""
+	}
+	var err error
+
+	fmt.Fprintf(out, "WaveLogGoat setup for profile '%s'. Press Enter to accept [defaults], Ctrl-C to quit.\n\n", name)
+	if config.WavelogURL, err = w.ask("Wavelog API URL for radio status", config.WavelogURL); err != nil {
+		return err
+	}
+	for {
+		if config.WavelogKey, err = w.ask("Wavelog API key", config.WavelogKey); err != nil {
+			return err
+		}
+		if config.WavelogKey != "" {
+			break
+		}
+		fmt.Fprintln(out, "An API key is required; create one in Wavelog under your account's API settings.")
+	}
+	if config.RadioName, err = w.ask("Radio name", config.RadioName); err != nil {
+		return err
+	}
+	for {
+		source, err := w.ask("Data source (flrig or hamlib)", config.DataSource)
+		if err != nil {
+			return err
+		}
+		if source = strings.ToLower(source); source == "flrig" || source == "hamlib" {
+			config.DataSource = source
+			break
+		}
+		fmt.Fprintln(out, "Please answer 'flrig' or 'hamlib'.")
+	}
+	if config.DataSource == "flrig" {
+		if config.FlrigHost, err = w.ask("flrig host", config.FlrigHost); err != nil {
+			return err
+		}
+		if config.FlrigPort, err = w.askPort("flrig port", config.FlrigPort); err != nil {
+			return err
+		}
+	} else {
+		if config.HamlibHost, err = w.ask("rigctld host", config.HamlibHost); err != nil {
+			return err
+		}
+		if config.HamlibPort, err = w.askPort("rigctld port", config.HamlibPort); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(out, "\nChecking connectivity...")
+	failed := false
+	client, err := newRadioClient(config)
+	if err == nil {
+		var data RigData
+		data, err = client.GetData()
+		if closer, ok := client.(io.Closer); ok {
+			closer.Close()
+		}
+		if err == nil {
+			fmt.Fprintf(out, "  Radio:   ok (%d Hz %s)\n", freqHz(txFrequency(data)), txMode(data))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "  Radio:   FAILED: %v\n", err)
+		failed = true
+	}
+	if err := checkWavelogReachable(config); err != nil {
+		fmt.Fprintf(out, "  Wavelog: FAILED: %v\n", err)
+		failed = true
+	} else {
+		fmt.Fprintln(out, "  Wavelog: ok")
+	}
+	if failed {
+		save, err := w.confirm("Save this profile anyway?")
+		if err != nil {
+			return err
+		}
+		if !save {
+			return errWizardCancelled
+		}
+	}
+
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]ProfileConfig)
+	}
+	cfg.Profiles[name] = config
+	cfg.DefaultProfile = name
+	return nil
+}